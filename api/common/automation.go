@@ -0,0 +1,206 @@
+package common
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/onestay/MarathonTools-API/api/events"
+	"github.com/onestay/MarathonTools-API/api/models"
+	"github.com/onestay/MarathonTools-API/api/storage"
+)
+
+// Action is something a subsystem can do when an event is published
+type Action struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	run         func(events.Event) error
+}
+
+// Automation runs the registered actions for the events the rules of the active marathon map them to
+type Automation struct {
+	// mu guards rules and actions
+	mu      sync.RWMutex
+	rules   []models.AutomationRule
+	actions map[string]Action
+	b       *Controller
+}
+
+// NewAutomation loads the saved rules and subscribes to all events
+func NewAutomation(b *Controller) *Automation {
+	log.Println("Initializing automation...")
+	rules, err := loadRules(b)
+	if err != nil {
+		b.LogError("while loading the automation rules. Using the default rules", err, false)
+		rules = models.DefaultAutomationRules()
+	}
+	a := &Automation{
+		rules:   rules,
+		actions: make(map[string]Action),
+		b:       b,
+	}
+	b.Events.SubscribeAll(a.handle)
+
+	return a
+}
+
+// Reload replaces the rules with the saved rules of the active marathon. The current rules are kept if they can't be loaded
+func (a *Automation) Reload() {
+	rules, err := loadRules(a.b)
+	if err != nil {
+		a.b.LogError("while loading the automation rules. Keeping the current rules", err, false)
+		return
+	}
+
+	a.mu.Lock()
+	a.rules = rules
+	a.mu.Unlock()
+}
+
+// loadRules returns the saved rules or the default rules if none have been saved yet. Default rules missing from the
+// saved rules are added disabled and marked as new
+func loadRules(b *Controller) ([]models.AutomationRule, error) {
+	rules, err := b.Storage.Social.AutomationRules(context.Background())
+	if err == storage.ErrNotFound {
+		return models.DefaultAutomationRules(), nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	return mergeDefaultRules(rules), nil
+}
+
+func mergeDefaultRules(rules []models.AutomationRule) []models.AutomationRule {
+	for _, d := range models.DefaultAutomationRules() {
+		found := false
+		for _, r := range rules {
+			if r.Event == d.Event && r.Action == d.Action {
+				found = true
+				break
+			}
+		}
+		if !found {
+			d.Enabled = false
+			d.New = true
+			rules = append(rules, d)
+		}
+	}
+
+	return rules
+}
+
+// RegisterAction makes an action available to rules. Registering a name twice replaces the action
+func (a *Automation) RegisterAction(name, description string, run func(events.Event) error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.actions[name] = Action{Name: name, Description: description, run: run}
+}
+
+// handle runs the actions of all enabled rules for the event
+func (a *Automation) handle(e events.Event) {
+	a.mu.RLock()
+	var actions []Action
+	for _, r := range a.rules {
+		if !r.Enabled || r.Event != string(e.Type) {
+			continue
+		}
+		if action, ok := a.actions[r.Action]; ok {
+			actions = append(actions, action)
+		}
+	}
+	a.mu.RUnlock()
+
+	// the actions run one after the other so they see the events in the order they were published
+	for _, action := range actions {
+		Debugf("Running %v for %v", action.Name, e.Type)
+		if err := action.run(e); err != nil {
+			a.b.LogError(fmt.Sprintf("while running %v for %v", action.Name, e.Type), err, true)
+		}
+	}
+}
+
+// Rules returns a copy of the rules
+func (a *Automation) Rules() []models.AutomationRule {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return append([]models.AutomationRule{}, a.rules...)
+}
+
+// GetRules returns the rules of the active marathon
+func (a *Automation) GetRules(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(a.Rules())
+}
+
+// SetRules replaces the rules. Every rule needs a known event and a registered action
+func (a *Automation) SetRules(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	var rules []models.AutomationRule
+	err := json.NewDecoder(r.Body).Decode(&rules)
+	if err != nil {
+		a.b.Response("", "invalid body", http.StatusBadRequest, w)
+		return
+	}
+	if rules == nil {
+		rules = []models.AutomationRule{}
+	}
+	// saved rules have been seen by the operator
+	for i := range rules {
+		rules[i].New = false
+	}
+
+	a.mu.Lock()
+	var errs []models.FieldError
+	for i, rule := range rules {
+		if !events.Type(rule.Event).Valid() {
+			errs = append(errs, models.FieldError{Field: fmt.Sprintf("[%v].event", i), Message: fmt.Sprintf("unknown event %v", rule.Event)})
+		}
+		if _, ok := a.actions[rule.Action]; !ok {
+			errs = append(errs, models.FieldError{Field: fmt.Sprintf("[%v].action", i), Message: fmt.Sprintf("unknown action %v", rule.Action)})
+		}
+	}
+	if len(errs) != 0 {
+		a.mu.Unlock()
+		a.b.ValidationError(errs, w)
+		return
+	}
+
+	err = a.b.Storage.Social.SaveAutomationRules(r.Context(), rules)
+	if err != nil {
+		a.mu.Unlock()
+		a.b.LogError("while saving automation rules", err, false)
+		a.b.Response("", "couldn't save rules", http.StatusInternalServerError, w)
+		return
+	}
+	a.rules = rules
+	a.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rules)
+}
+
+// GetActions lists the events and the registered actions rules can use
+func (a *Automation) GetActions(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
+	a.mu.RLock()
+	actions := make([]Action, 0, len(a.actions))
+	for _, action := range a.actions {
+		actions = append(actions, action)
+	}
+	a.mu.RUnlock()
+	sort.Slice(actions, func(i, j int) bool {
+		return actions[i].Name < actions[j].Name
+	})
+
+	res := struct {
+		Events  []events.Type `json:"events"`
+		Actions []Action      `json:"actions"`
+	}{events.Types, actions}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
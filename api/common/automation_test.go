@@ -0,0 +1,57 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/onestay/MarathonTools-API/api/models"
+	"github.com/onestay/MarathonTools-API/api/storage"
+)
+
+// failingSocial returns err when the automation rules are loaded
+type failingSocial struct {
+	storage.SocialRepository
+	err error
+}
+
+func (f failingSocial) AutomationRules(context.Context) ([]models.AutomationRule, error) {
+	return nil, f.err
+}
+
+func TestReloadAutomationRules(t *testing.T) {
+	b := newTestController(t)
+	if !reflect.DeepEqual(b.Automation.Rules(), models.DefaultAutomationRules()) {
+		t.Fatalf("expected the default rules without saved rules, got %v", b.Automation.Rules())
+	}
+
+	saved := []models.AutomationRule{{Event: "runSwitched", Action: "twitch.updateInfo", Enabled: false}}
+	if err := b.Storage.Social.SaveAutomationRules(context.Background(), saved); err != nil {
+		t.Fatal(err)
+	}
+	b.Automation.Reload()
+	// the other default rules are added disabled and marked as new
+	expected := append([]models.AutomationRule{}, saved...)
+	for _, d := range models.DefaultAutomationRules()[1:] {
+		d.Enabled = false
+		d.New = true
+		expected = append(expected, d)
+	}
+	if !reflect.DeepEqual(b.Automation.Rules(), expected) {
+		t.Fatalf("expected the saved rules and the new default rules %v, got %v", expected, b.Automation.Rules())
+	}
+
+	social := b.Storage.Social
+	b.Storage.Social = failingSocial{SocialRepository: social, err: errors.New("connection lost")}
+	b.Automation.Reload()
+	if !reflect.DeepEqual(b.Automation.Rules(), expected) {
+		t.Fatalf("expected the current rules to be kept when loading fails, got %v", b.Automation.Rules())
+	}
+
+	b.Storage.Social = failingSocial{SocialRepository: social, err: storage.ErrNotFound}
+	b.Automation.Reload()
+	if !reflect.DeepEqual(b.Automation.Rules(), models.DefaultAutomationRules()) {
+		t.Fatalf("expected the default rules when none are saved, got %v", b.Automation.Rules())
+	}
+}
@@ -1,33 +1,31 @@
 package common
 
 import (
+	"context"
 	"net/http"
 
-	"github.com/go-redis/redis"
-	"gopkg.in/mgo.v2"
-
-	"github.com/onestay/MarathonTools-API/api/models"
+	"github.com/onestay/MarathonTools-API/api/events"
+	"github.com/onestay/MarathonTools-API/api/stopwatch"
+	"github.com/onestay/MarathonTools-API/api/storage"
 	"github.com/onestay/MarathonTools-API/ws"
 )
 
 // Controller is the base struct for any controller. It's used to manage state and other things.
 type Controller struct {
-	WS          *ws.Hub
-	MGS         *mgo.Session
-	Col         *mgo.Collection
-	RunIndex    int
-	CurrentRun  *models.Run
-	NextRun     *models.Run
-	PrevRun     *models.Run
-	UpNext      *models.Run
-	RedisClient *redis.Client
-	TimerState  TimerState
-	TimerTime   float64
-	HTTPClient  http.Client
-	// SocialUpdatesChan is used to communicate with the socialController on Twitter and twitch updates
-	SocialUpdatesChan chan int
-	CL                *Checklist
-	Settings          *SettingsProvider
+	WS *ws.Hub
+	// Storage holds the repositories used to persist everything
+	Storage storage.Backend
+	// State holds the current runs and the state of the main timer. It's safe for concurrent use
+	State      *Store
+	HTTPClient http.Client
+	// Events is the event bus through which subsystems learn about run switches, timer and settings changes and more
+	Events     *events.Bus
+	Automation *Automation
+	CL         *Checklist
+	Settings   *SettingsProvider
+	Setup      *SetupTracker
+	Marathons  *Marathons
+	Hosts      *HostRotation
 }
 
 type httpResponse struct {
@@ -41,39 +39,41 @@ type httpResponse struct {
 // Especially the base controller, because it couldn't import the timerState from the timer class
 
 // TimerState is an alias of int to represent timer state
-type TimerState = int
+type TimerState = stopwatch.State
 
 const (
 	// TimerRunning represents a running timer
-	TimerRunning TimerState = iota
+	TimerRunning = stopwatch.Running
 	// TimerPaused represents a paused timer
-	TimerPaused
+	TimerPaused = stopwatch.Paused
 	// TimerStopped represents a stopped timer
-	TimerStopped
+	TimerStopped = stopwatch.Stopped
 	// TimerFinished represents a finished timer
-	TimerFinished
+	TimerFinished = stopwatch.Finished
 )
 
 // NewController returns a new base controller
-func NewController(hub *ws.Hub, mgs *mgo.Session, crIndex int, rc *redis.Client) *Controller {
-	var runs []models.Run
-	err := mgs.DB("marathon").C("runs").Find(nil).All(&runs)
-	if err != nil {
-		return nil
-	}
+func NewController(hub *ws.Hub, backend storage.Backend, crIndex int) *Controller {
 	c := &Controller{
-		WS:                hub,
-		MGS:               mgs,
-		RunIndex:          crIndex,
-		Col:               mgs.DB("marathon").C("runs"),
-		RedisClient:       rc,
-		TimerState:        2,
-		TimerTime:         0,
-		HTTPClient:        http.Client{},
-		SocialUpdatesChan: make(chan int, 1),
+		WS:         hub,
+		Storage:    backend,
+		State:      NewStore(crIndex),
+		HTTPClient: http.Client{},
+		Events:     events.NewBus(),
 	}
+	c.Events.SubscribeAll(func(e events.Event) {
+		c.WSEvent(e)
+	})
+	c.Events.Subscribe(events.SettingsChanged, func(events.Event) {
+		c.WSSettingUpdate()
+	})
+	c.Marathons = NewMarathons(c)
 	c.CL = NewChecklist(c)
 	c.Settings = InitSettings(c)
+	c.Setup = NewSetupTracker(c)
+	c.Hosts = NewHostRotation(c)
+	c.Automation = NewAutomation(c)
+	c.MigrateRunners(context.Background())
 	c.UpdateActiveRuns()
 	c.UpdateUpNext()
 	return c
@@ -1,158 +1,472 @@
 package common
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 
-	"github.com/go-redis/redis"
 	"github.com/julienschmidt/httprouter"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/onestay/MarathonTools-API/api/models"
 )
 
-type item struct {
-	Key  string `json:"key"`
-	Done bool   `json:"done"`
-}
+type item = models.ChecklistItem
 
-// Checklist provides the implementation of a checklist
+// Checklist provides the implementation of a checklist. items is the template of the marathon. The checklist of the
+// current run consists of the template items which apply to it
 type Checklist struct {
-	Items []*item
+	// mu guards items, finished and override
+	mu    sync.RWMutex
+	items []*item
+	// override is set if the gate was overridden for the current run
+	override *models.ChecklistLogEntry
 	// we need to access this at some crucial times like timer start. we can't afford the time it takes for the loop to finish processing then
 	// that's why we set this variable with every call to add, remove and toggle so this variable will only have to be accessed to see if the checklist is done
-	Finished bool
+	finished bool
 	b        *Controller
 }
 
+// checklistFile is the checklist file used before the checklist was stored. It's imported once if the active marathon
+// has no saved checklist and renamed afterwards
+const checklistFile = "./config/checklist.json"
+
 // NewChecklist initializes and returns a new Checklist
 func NewChecklist(b *Controller) *Checklist {
 	log.Println("Initializing checklist...")
-	var items []*item
-	// // a checklist can be initialized in three ways
-	// // 1: through a checklist file
-	// // 2: through a checklist saved in redis
-	// // 3: a new checklist
-
-	if _, err := os.Stat("./config/checklist.json"); err == nil {
-		log.Println("Found checklist file. Importing from file.")
-		clFile, err := os.Open("./config/checklist.json")
-		if err != nil {
-			b.LogError("Couldn't open checklist file", err, false)
-			items = make([]*item, 0)
-			return &Checklist{
-				Items: items,
-				b:     b,
-			}
-		}
+	importChecklistFile(b)
+	c := &Checklist{
+		items: groupByCategory(loadChecklist(b)),
+		b:     b,
+	}
+	c.finished = c.checkDone()
+	return c
+}
 
-		defer clFile.Close()
+// Reload replaces the items with the saved checklist of the active marathon
+func (c *Checklist) Reload() {
+	items := groupByCategory(loadChecklist(c.b))
 
-		json.NewDecoder(clFile).Decode(&items)
+	c.mu.Lock()
+	c.items = items
+	c.finished = c.checkDone()
+	c.override = nil
+	c.mu.Unlock()
+}
 
-		err = os.Rename("./config/checklist.json", "./config/checklist_imported.json")
-		if err != nil {
-			b.LogError("when renaming. Please rename manually", err, false)
+// loadChecklist returns the saved checklist. Items stay checked since the state is only reset on a run switch
+func loadChecklist(b *Controller) []*item {
+	items := make([]*item, 0)
+	saved, err := b.Storage.Checklist.Get(context.Background())
+	if err != nil || len(saved) == 0 {
+		log.Println("No saved checklist found. Creating new checklist")
+		return items
+	}
+
+	log.Println("Saved checklist found. Loading saved checklist")
+	for i := range saved {
+		items = append(items, &saved[i])
+	}
+
+	return items
+}
+
+// importChecklistFile saves the items of the checklist file as checklist of the active marathon if it has none yet
+func importChecklistFile(b *Controller) {
+	f, err := os.Open(checklistFile)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	if saved, err := b.Storage.Checklist.Get(context.Background()); err == nil && len(saved) != 0 {
+		log.Printf("%v isn't imported since a checklist is saved already. Import it with POST /checklist/import", checklistFile)
+		return
+	}
+
+	log.Printf("Importing checklist from %v", checklistFile)
+	var items []models.ChecklistItem
+	if err := json.NewDecoder(f).Decode(&items); err != nil {
+		b.LogError("while reading the checklist file", err, false)
+		return
+	}
+	for i := range items {
+		items[i].Done = false
+		items[i].CheckedBy = ""
+		items[i].CheckedAt = nil
+	}
+	if err := b.Storage.Checklist.Save(context.Background(), items); err != nil {
+		b.LogError("while saving the imported checklist", err, false)
+		return
+	}
+
+	// the file has to be closed before it can be renamed on windows
+	f.Close()
+	if err := os.Rename(checklistFile, strings.TrimSuffix(checklistFile, ".json")+"_imported.json"); err != nil {
+		b.LogError("when renaming. Please rename manually", err, false)
+	}
+}
+
+var errItemNotFound = errors.New("Item doesn't exist")
+
+// mutate calls f with a copy of the template. If f succeeds and the result is valid the template is replaced, saved and
+// sent to all clients. Otherwise the template stays unchanged. It returns the status code for the response
+func (c *Checklist) mutate(f func(items []*item) ([]*item, error)) (int, error) {
+	c.mu.Lock()
+	items := make([]*item, len(c.items))
+	for i, it := range c.items {
+		cp := *it
+		items[i] = &cp
+	}
+
+	items, err := f(items)
+	if err == errItemNotFound {
+		c.mu.Unlock()
+		return http.StatusNotFound, err
+	} else if err != nil {
+		c.mu.Unlock()
+		return http.StatusBadRequest, err
+	}
+
+	keys := make(map[string]bool, len(items))
+	for _, it := range items {
+		if len(strings.TrimSpace(it.Key)) == 0 {
+			c.mu.Unlock()
+			return http.StatusBadRequest, errors.New("every item needs a key")
 		}
-	} else if b, err := b.RedisClient.Get("checklist").Bytes(); err != redis.Nil && len(b) != 0 {
-		// if a checklist was already saved on a previous run we want to keep that
-		// however it is likely that we want it set to completely false in that case
-		log.Println("Checklist found in redis. Loading checklist from redis")
-		json.Unmarshal(b, &items)
-		for _, v := range items {
-			v.Done = false
+		if keys[it.Key] {
+			c.mu.Unlock()
+			return http.StatusBadRequest, errors.New("Item already exists: " + it.Key)
 		}
-	} else {
-		log.Println("Not checklist file found. Checklist not found in Redis. Creating new checklist")
-		items = make([]*item, 0)
+		keys[it.Key] = true
 	}
 
-	c := Checklist{
-		Items: items,
-		b:     b,
+	items = groupByCategory(items)
+	if err := c.save(items); err != nil {
+		c.mu.Unlock()
+		return http.StatusInternalServerError, err
+	}
+	c.items = items
+	c.finished = c.checkDone()
+	c.mu.Unlock()
+
+	go c.b.WSChecklistUpdate()
+	return http.StatusOK, nil
+}
+
+// respond sends the items of the current run or the error of a mutation
+func (c *Checklist) respond(w http.ResponseWriter, code int, err error) {
+	if err != nil {
+		c.b.Response("", err.Error(), code, w)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(c.GetItems())
+}
+
+// itemKey returns the key of the item from the key param or the item query parameter used by the older endpoints
+func itemKey(r *http.Request, ps httprouter.Params) string {
+	if k := ps.ByName("key"); len(k) != 0 {
+		return k
+	}
+
+	return r.URL.Query().Get("item")
+}
+
+func indexOf(items []*item, key string) int {
+	for i, it := range items {
+		if it.Key == key {
+			return i
+		}
 	}
-	c.Finished = false
-	c.saveToRedis()
-	return &c
+
+	return -1
 }
 
-// AddItem will add an item to the checklist
+// AddItem will add an item to the end of its category. The item is either the JSON body or given by the item,
+// category and optional query parameters
 func (c *Checklist) AddItem(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	newItem := item{}
 	if i := r.URL.Query().Get("item"); len(i) != 0 {
-		if c.getItemIndex(i) != -1 {
-			c.b.Response("", "Item already exists", http.StatusBadRequest, w)
-			return
+		newItem.Key = i
+		newItem.Category = r.URL.Query().Get("category")
+		newItem.Optional = r.URL.Query().Get("optional") == "true"
+	} else if err := json.NewDecoder(r.Body).Decode(&newItem); err != nil {
+		c.b.Response("", "no item defined", http.StatusBadRequest, w)
+		return
+	}
+	newItem.Done = false
+	newItem.CheckedBy = ""
+	newItem.CheckedAt = nil
+
+	code, err := c.mutate(func(items []*item) ([]*item, error) {
+		return append(items, &newItem), nil
+	})
+	c.respond(w, code, err)
+}
+
+// UpdateItem applies the body as JSON merge patch to an item. Setting the key renames the item
+func (c *Checklist) UpdateItem(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	patch, err := io.ReadAll(r.Body)
+	if err != nil {
+		c.b.Response("", "couldn't read body", http.StatusBadRequest, w)
+		return
+	}
+
+	key := itemKey(r, ps)
+	code, err := c.mutate(func(items []*item) ([]*item, error) {
+		i := indexOf(items, key)
+		if i == -1 {
+			return nil, errItemNotFound
+		}
+
+		doc, _ := json.Marshal(items[i])
+		doc, err := MergePatch(doc, patch)
+		if err != nil {
+			return nil, errors.New("invalid body")
 		}
-		itemObj := item{
-			Key:  i,
-			Done: false,
+		updated := item{}
+		if err := json.Unmarshal(doc, &updated); err != nil {
+			return nil, errors.New("invalid item: " + err.Error())
 		}
 
-		c.Items = append(c.Items, &itemObj)
-		go func() {
-			c.Finished = c.CheckDone()
-			c.saveToRedis()
-		}()
-		json.NewEncoder(w).Encode(c.Items)
-		go c.b.WSChecklistUpdate()
+		// the state is only changed by toggling
+		updated.Done = items[i].Done
+		updated.CheckedBy = items[i].CheckedBy
+		updated.CheckedAt = items[i].CheckedAt
+		items[i] = &updated
+		return items, nil
+	})
+	c.respond(w, code, err)
+}
+
+// DeleteItem will delete an item from the checklist
+func (c *Checklist) DeleteItem(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	key := itemKey(r, ps)
+	if len(key) == 0 {
+		c.b.Response("", "no item defined", http.StatusBadRequest, w)
 		return
 	}
-	c.b.Response("", "no item defined", http.StatusBadRequest, w)
+
+	code, err := c.mutate(func(items []*item) ([]*item, error) {
+		i := indexOf(items, key)
+		if i == -1 {
+			return nil, errItemNotFound
+		}
+		return append(items[:i], items[i+1:]...), nil
+	})
+	c.respond(w, code, err)
 }
 
-// DeleteItem will delete an item from the checklist
-func (c *Checklist) DeleteItem(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
-	if i := r.URL.Query().Get("item"); len(i) != 0 {
-		index := c.getItemIndex(i)
+// ReorderItems orders the template by the list of keys in the body. It has to contain every key exactly once.
+// Items stay grouped by category so the first item of a category decides where the category goes
+func (c *Checklist) ReorderItems(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	var keys []string
+	if err := json.NewDecoder(r.Body).Decode(&keys); err != nil {
+		c.b.Response("", "invalid body", http.StatusBadRequest, w)
+		return
+	}
 
-		if index == -1 {
-			c.b.Response("", "Item doesn't exist", http.StatusBadRequest, w)
-			return
+	code, err := c.mutate(func(items []*item) ([]*item, error) {
+		if len(keys) != len(items) {
+			return nil, errors.New("the order has to contain every item")
 		}
-		copy(c.Items[index:], c.Items[index+1:])
-		c.Items[len(c.Items)-1] = nil
-		c.Items = c.Items[:len(c.Items)-1]
 
-		go func() {
-			c.Finished = c.CheckDone()
-			c.saveToRedis()
-		}()
-		json.NewEncoder(w).Encode(c.Items)
-		go c.b.WSChecklistUpdate()
+		ordered := make([]*item, 0, len(items))
+		for _, k := range keys {
+			i := indexOf(items, k)
+			if i == -1 {
+				return nil, errors.New("the order has to contain every item once")
+			}
+			ordered = append(ordered, items[i])
+			items[i] = &item{}
+		}
+		return ordered, nil
+	})
+	c.respond(w, code, err)
+}
+
+// ToggleItem will toggle the status of an item if it exists. The operator who did it is recorded in the item and
+// the checklist log of the current run
+func (c *Checklist) ToggleItem(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	key := itemKey(r, ps)
+	if len(key) == 0 {
+		c.b.Response("", "no item defined", http.StatusBadRequest, w)
 		return
 	}
-	c.b.Response("", "no item defined", http.StatusBadRequest, w)
+
+	entry := models.ChecklistLogEntry{
+		RunID:  c.b.State.CurrentRun().RunID,
+		Action: models.ChecklistUnchecked,
+		Key:    key,
+		By:     Operator(r),
+		Time:   time.Now(),
+	}
+
+	code, err := c.mutate(func(items []*item) ([]*item, error) {
+		i := indexOf(items, key)
+		if i == -1 {
+			return nil, errItemNotFound
+		}
+
+		it := items[i]
+		it.Done = !it.Done
+		if it.Done {
+			entry.Action = models.ChecklistChecked
+			it.CheckedBy = entry.By
+			it.CheckedAt = &entry.Time
+		} else {
+			it.CheckedBy = ""
+			it.CheckedAt = nil
+		}
+		return items, nil
+	})
+	if err == nil {
+		go c.log(entry)
+	}
+	c.respond(w, code, err)
 }
 
-// ToggleItem will toggle the status of an item if it exists
-func (c *Checklist) ToggleItem(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
-	if i := r.URL.Query().Get("item"); len(i) != 0 {
-		item := c.getItem(i)
+// ResetChecklist will set all items to not done
+func (c *Checklist) ResetChecklist() {
+	c.mu.Lock()
+	c.override = nil
+	c.mu.Unlock()
+
+	_, err := c.mutate(func(items []*item) ([]*item, error) {
+		for _, it := range items {
+			it.Done = false
+			it.CheckedBy = ""
+			it.CheckedAt = nil
+		}
+		return items, nil
+	})
+	if err != nil {
+		c.b.LogError("while resetting checklist", err, false)
+	}
+}
+
+// Refresh recomputes whether the checklist is finished. It's called when the current run changed without a run switch
+func (c *Checklist) Refresh() {
+	c.mu.Lock()
+	c.finished = c.checkDone()
+	c.mu.Unlock()
+
+	go c.b.WSChecklistUpdate()
+}
+
+// Gate returns an error if the checklist gate is enabled and required items of the current run aren't done.
+// It doesn't block if the gate was overridden for the current run
+func (c *Checklist) Gate() error {
+	if !c.b.Settings.Get().Checklist.Gate {
+		return nil
+	}
+
+	run := c.b.State.CurrentRun()
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.finished || (c.override != nil && c.override.RunID == run.RunID) {
+		return nil
+	}
 
-		if item == nil {
-			c.b.Response("", "Item doesn't exist", http.StatusBadRequest, w)
+	var missing []string
+	for _, it := range c.items {
+		if !it.Done && !it.Optional && it.AppliesTo(run) {
+			missing = append(missing, it.Key)
+		}
+	}
+
+	return fmt.Errorf("checklist isn't done: %v", strings.Join(missing, ", "))
+}
+
+// Override lets the timer start and runs switch for the current run even though the checklist isn't done.
+// The operator and an optional reason from the body are recorded in the checklist log
+func (c *Checklist) Override(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	body := struct {
+		Reason string `json:"reason"`
+	}{}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			c.b.Response("", "invalid body", http.StatusBadRequest, w)
 			return
 		}
+	}
 
-		item.Done = !item.Done
+	entry := models.ChecklistLogEntry{
+		RunID:  c.b.State.CurrentRun().RunID,
+		Action: models.ChecklistOverridden,
+		Reason: body.Reason,
+		By:     Operator(r),
+		Time:   time.Now(),
+	}
+
+	c.mu.Lock()
+	c.override = &entry
+	c.mu.Unlock()
+
+	go c.log(entry)
+	c.b.Response("", "", http.StatusOK, w)
+	go c.b.WSChecklistUpdate()
+}
 
-		go c.b.WSChecklistUpdate()
-		json.NewEncoder(w).Encode(c.Items)
-		c.Finished = c.CheckDone()
+// GetLog returns the checklist log of the run given by the run query parameter or of the current run
+func (c *Checklist) GetLog(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	runID := c.b.State.CurrentRun().RunID
+	if id := r.URL.Query().Get("run"); len(id) != 0 {
+		var err error
+		runID, err = primitive.ObjectIDFromHex(id)
+		if err != nil {
+			c.b.Response("", "invalid bson id", http.StatusBadRequest, w)
+			return
+		}
+	}
+
+	entries, err := c.b.Storage.Checklist.Log(r.Context(), runID)
+	if err != nil {
+		c.b.Response("", err.Error(), http.StatusInternalServerError, w)
 		return
 	}
-	c.b.Response("", "no item defined", http.StatusBadRequest, w)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entries)
 }
 
-func (c *Checklist) ResetChecklist() {
-	for _, item := range c.Items {
-		item.Done = false
+// Overridden returns the override of the current run or nil if the checklist wasn't overridden
+func (c *Checklist) Overridden() *models.ChecklistLogEntry {
+	run := c.b.State.CurrentRun()
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.override == nil || c.override.RunID != run.RunID {
+		return nil
 	}
+	o := *c.override
+	return &o
+}
 
-	go c.b.WSChecklistUpdate()
-	c.Finished = false
+func (c *Checklist) log(entry models.ChecklistLogEntry) {
+	if entry.RunID.IsZero() {
+		return
+	}
+
+	err := c.b.Storage.Checklist.AddLog(context.Background(), entry)
+	if err != nil {
+		c.b.LogError("while saving checklist log", err, false)
+	}
 }
 
-// CheckDoneHTTP will return whether all the items in the checklist are done
+// CheckDoneHTTP will return whether all the required items in the checklist of the current run are done
 func (c *Checklist) CheckDoneHTTP(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
 	res := struct {
 		Ok   bool `json:"ok"`
@@ -162,45 +476,135 @@ func (c *Checklist) CheckDoneHTTP(w http.ResponseWriter, _ *http.Request, _ http
 	json.NewEncoder(w).Encode(res)
 }
 
-// CheckDone will return whether all the items in the checklist are done
+// CheckDone will return whether all the required items in the checklist of the current run are done
 func (c *Checklist) CheckDone() bool {
-	for _, v := range c.Items {
-		if !v.Done {
-			return false
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.checkDone()
+}
+
+// Finished returns whether all required items of the current run are done without looping over the items
+func (c *Checklist) Finished() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.finished
+}
+
+// GetItems returns a copy of the items which apply to the current run
+func (c *Checklist) GetItems() []item {
+	run := c.b.State.CurrentRun()
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	items := make([]item, 0, len(c.items))
+	for _, it := range c.items {
+		if it.AppliesTo(run) {
+			items = append(items, *it)
 		}
 	}
-	return true
+
+	return items
+}
+
+// Template returns a copy of all items of the template
+func (c *Checklist) Template() []item {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	items := make([]item, len(c.items))
+	for i, it := range c.items {
+		items[i] = *it
+	}
+
+	return items
 }
 
-//GetChecklist will get all items from the checklist
+// GetChecklist will get the items of the checklist of the current run
 func (c *Checklist) GetChecklist(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
-	json.NewEncoder(w).Encode(c.Items)
+	json.NewEncoder(w).Encode(c.GetItems())
 }
 
-func (c *Checklist) saveToRedis() {
-	b, _ := json.Marshal(c.Items)
-	err := c.b.RedisClient.Set("checklist", b, 0).Err()
+// GetTemplate will get all items of the template including those which don't apply to the current run
+func (c *Checklist) GetTemplate(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
+	json.NewEncoder(w).Encode(c.Template())
+}
+
+// SetTemplate replaces the template. It's also used to import an exported checklist. Items are grouped by category in
+// the order the categories first appear. Items which were done before stay done
+func (c *Checklist) SetTemplate(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	var template []item
+	err := json.NewDecoder(r.Body).Decode(&template)
+	if err != nil {
+		c.b.Response("", "invalid body", http.StatusBadRequest, w)
+		return
+	}
+
+	code, err := c.mutate(func(items []*item) ([]*item, error) {
+		res := make([]*item, len(template))
+		for i := range template {
+			it := template[i]
+			it.Done, it.CheckedBy, it.CheckedAt = false, "", nil
+			if j := indexOf(items, it.Key); j != -1 {
+				it.Done, it.CheckedBy, it.CheckedAt = items[j].Done, items[j].CheckedBy, items[j].CheckedAt
+			}
+			res[i] = &it
+		}
+		return res, nil
+	})
 	if err != nil {
-		c.b.LogError("while saving checklist to redis", err, false)
+		c.b.Response("", err.Error(), code, w)
+		return
 	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(c.Template())
 }
 
-func (c *Checklist) getItem(key string) *item {
-	for _, item := range c.Items {
-		if item.Key == key {
-			return item
-		}
+// ExportTemplate sends the template without the state of the items as file download. It can be imported with SetTemplate
+func (c *Checklist) ExportTemplate(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
+	items := c.Template()
+	for i := range items {
+		items[i].Done = false
+		items[i].CheckedBy = ""
+		items[i].CheckedAt = nil
 	}
 
-	return nil
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", `attachment; filename="checklist.json"`)
+	json.NewEncoder(w).Encode(items)
 }
 
-func (c *Checklist) getItemIndex(key string) int {
-	for i, item := range c.Items {
-		if item.Key == key {
-			return i
+func (c *Checklist) save(items []*item) error {
+	saved := make([]item, len(items))
+	for i, it := range items {
+		saved[i] = *it
+	}
+
+	return c.b.Storage.Checklist.Save(context.Background(), saved)
+}
+
+// groupByCategory sorts the items by category. Categories are ordered by their first item, items keep their order
+func groupByCategory(items []*item) []*item {
+	order := map[string]int{}
+	for _, it := range items {
+		if _, ok := order[it.Category]; !ok {
+			order[it.Category] = len(order)
 		}
 	}
+	sort.SliceStable(items, func(i, j int) bool {
+		return order[items[i].Category] < order[items[j].Category]
+	})
 
-	return -1
+	return items
+}
+
+// the following functions have to be called with the lock held
+
+func (c *Checklist) checkDone() bool {
+	run := c.b.State.CurrentRun()
+	for _, v := range c.items {
+		if !v.Done && !v.Optional && v.AppliesTo(run) {
+			return false
+		}
+	}
+	return true
 }
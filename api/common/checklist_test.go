@@ -0,0 +1,99 @@
+package common
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/onestay/MarathonTools-API/api/storage"
+	"github.com/onestay/MarathonTools-API/api/storage/boltstore"
+	"github.com/onestay/MarathonTools-API/ws"
+)
+
+// openTestController returns a base controller on the embedded database at path and a function closing it
+func openTestController(t *testing.T, path string) (*Controller, func()) {
+	t.Helper()
+	s, err := boltstore.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hub := ws.NewHub()
+	go hub.Run()
+
+	return NewController(hub, s.Backend(storage.NewActive(storage.DefaultMarathon)), 0), func() { s.Close() }
+}
+
+func toggle(c *Controller, key string) int {
+	w := httptest.NewRecorder()
+	c.CL.ToggleItem(w, httptest.NewRequest("POST", "/checklist/items/"+key+"/toggle", nil), httprouter.Params{{Key: "key", Value: key}})
+	return w.Code
+}
+
+func TestChecklistStateSurvivesRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	c, closeDB := openTestController(t, path)
+
+	w := httptest.NewRecorder()
+	c.CL.AddItem(w, httptest.NewRequest("POST", "/checklist/items?item=stream&category=obs", nil), nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("adding an item returned %v", w.Code)
+	}
+	if code := toggle(c, "stream"); code != http.StatusOK {
+		t.Fatalf("toggling returned %v", code)
+	}
+	closeDB()
+
+	c, closeDB = openTestController(t, path)
+	defer closeDB()
+	items := c.CL.Template()
+	if len(items) != 1 || !items[0].Done {
+		t.Fatalf("checked state was lost on restart: %+v", items)
+	}
+
+	c.CL.ResetChecklist()
+	if c.CL.Template()[0].Done {
+		t.Error("item is still checked after the reset of a run switch")
+	}
+}
+
+func TestChecklistFileImport(t *testing.T) {
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	os.Mkdir("config", 0755)
+	err = os.WriteFile(checklistFile, []byte(`[{"key": "stream", "done": true}, {"key": "audio"}]`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, closeDB := openTestController(t, filepath.Join(dir, "test.db"))
+	defer closeDB()
+
+	items := c.CL.Template()
+	if len(items) != 2 {
+		t.Fatalf("imported %v items, want 2", len(items))
+	}
+	for _, it := range items {
+		if it.Done {
+			t.Errorf("imported item %v is checked", it.Key)
+		}
+	}
+	if _, err := os.Stat(checklistFile); !os.IsNotExist(err) {
+		t.Error("checklist file wasn't renamed")
+	}
+	if _, err := os.Stat("config/checklist_imported.json"); err != nil {
+		t.Errorf("renamed checklist file is missing: %v", err)
+	}
+}
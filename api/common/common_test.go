@@ -0,0 +1,24 @@
+package common
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/onestay/MarathonTools-API/api/storage"
+	"github.com/onestay/MarathonTools-API/api/storage/boltstore"
+	"github.com/onestay/MarathonTools-API/ws"
+)
+
+// newTestController returns a base controller on an empty embedded database
+func newTestController(t *testing.T) *Controller {
+	t.Helper()
+	s, err := boltstore.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hub := ws.NewHub()
+	go hub.Run()
+
+	return NewController(hub, s.Backend(storage.NewActive(storage.DefaultMarathon)), 0)
+}
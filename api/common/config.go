@@ -1,73 +1,139 @@
 package common
 
 import (
+	"context"
 	"encoding/json"
+	"io"
 	"log"
 	"net/http"
-
-	"github.com/go-redis/redis"
+	"sync"
 
 	"github.com/julienschmidt/httprouter"
+
+	"github.com/onestay/MarathonTools-API/api/events"
+	"github.com/onestay/MarathonTools-API/api/models"
 )
 
 // Settings provides just some general settings
-type Settings struct {
-	Currency            string `json:"currency"`
-	Chat                string `json:"chat"`
-	SocialCircleTime    int    `json:"socialCircleTime"`
-	TwitchUpdateChannel string `json:"twitchUpdateChannel"`
-}
+type Settings = models.Settings
 
 // SettingsProvider provides something idk
 type SettingsProvider struct {
-	S *Settings
-	b *Controller
+	mu sync.RWMutex
+	s  Settings
+	b  *Controller
 }
 
 // InitSettings will return a SettingsProvider
 func InitSettings(b *Controller) *SettingsProvider {
-	s := Settings{}
 	log.Println("Initializing settings...")
-	if b, err := b.RedisClient.Get("settings").Bytes(); err != redis.Nil && len(b) != 0 {
-		log.Println("Found settings in redis")
-		json.Unmarshal(b, &s)
-	} else {
-		log.Println("No saved settings found. Initializing with default values")
-		s.Chat = "onestay"
-		s.Currency = "$"
-		s.SocialCircleTime = 30000
-		s.TwitchUpdateChannel = ""
-	}
-
 	return &SettingsProvider{
-		S: &s,
+		s: loadSettings(b),
 		b: b,
 	}
 }
 
-// SetSettings is used to set the settings
-func (s *SettingsProvider) SetSettings(_ http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+// Reload replaces the settings with the saved settings of the active marathon
+func (s *SettingsProvider) Reload() {
+	settings := loadSettings(s.b)
+
+	s.mu.Lock()
+	s.s = settings
+	s.mu.Unlock()
+}
+
+func loadSettings(b *Controller) Settings {
+	saved, err := b.Storage.Settings.Get(context.Background())
+	if err != nil {
+		log.Println("No saved settings found. Initializing with default values")
+		return models.DefaultSettings()
+	}
+
+	log.Println("Found saved settings")
+	return saved
+}
+
+// Get returns a copy of the current settings
+func (s *SettingsProvider) Get() Settings {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.s
+}
+
+// SetSettings replaces all settings. Settings missing in the body are set to their default value
+func (s *SettingsProvider) SetSettings(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 	newSettings := Settings{}
+	err := json.NewDecoder(r.Body).Decode(&newSettings)
+	if err != nil {
+		s.b.Response("", "invalid body", http.StatusBadRequest, w)
+		return
+	}
+
+	s.update(w, func(_ Settings) (Settings, error) {
+		return newSettings, nil
+	})
+}
+
+// PatchSettings applies the body as JSON merge patch to the settings so only the settings in the body are changed
+func (s *SettingsProvider) PatchSettings(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	patch, err := io.ReadAll(r.Body)
+	if err != nil {
+		s.b.Response("", "couldn't read body", http.StatusBadRequest, w)
+		return
+	}
+
+	s.update(w, func(current Settings) (Settings, error) {
+		doc, _ := json.Marshal(current)
+		doc, err := MergePatch(doc, patch)
+		if err != nil {
+			return current, err
+		}
+
+		updated := Settings{}
+		err = json.Unmarshal(doc, &updated)
+		return updated, err
+	})
+}
 
-	json.NewDecoder(r.Body).Decode(&newSettings)
+// update validates and saves the settings returned by f. Clients are only notified once the settings are saved
+func (s *SettingsProvider) update(w http.ResponseWriter, f func(current Settings) (Settings, error)) {
+	s.mu.Lock()
+	updated, err := f(s.s)
+	if err != nil {
+		s.mu.Unlock()
+		s.b.Response("", "invalid body", http.StatusBadRequest, w)
+		return
+	}
+	if errs := updated.Validate(); len(errs) != 0 {
+		s.mu.Unlock()
+		s.b.ValidationError(errs, w)
+		return
+	}
 
-	s.S = &newSettings
-	go func() {
-		s.b.SocialUpdatesChan <- 3
-	}()
-	go s.b.WSSettingUpdate()
-	go s.saveToRedis()
+	err = s.b.Storage.Settings.Save(context.Background(), updated)
+	if err != nil {
+		s.mu.Unlock()
+		s.b.LogError("while saving settings", err, false)
+		s.b.Response("", "couldn't save settings", http.StatusInternalServerError, w)
+		return
+	}
+	s.s = updated
+	s.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(updated)
+
+	s.b.Events.Publish(events.Event{Type: events.SettingsChanged, Settings: &updated})
 }
 
 // GetSettings returns all settings
 func (s *SettingsProvider) GetSettings(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
-	json.NewEncoder(w).Encode(s.S)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.Get())
 }
 
-func (s *SettingsProvider) saveToRedis() {
-	b, _ := json.Marshal(s.S)
-	err := s.b.RedisClient.Set("settings", b, 0).Err()
-	if err != nil {
-		s.b.LogError("while saving settings to redis", err, false)
-	}
+// GetSchema describes every setting with its type, default value and limits
+func (s *SettingsProvider) GetSchema(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(models.SettingsSchema())
 }
@@ -1,48 +1,40 @@
 package common
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
-	"log"
 	"net/http"
 
 	"github.com/onestay/MarathonTools-API/api/models"
 )
 
-// UpdateActiveRuns will update the the previous, current and next run in the base controller struct
+// UpdateActiveRuns will update the the previous, current and next run in the state of the base controller
 func (c *Controller) UpdateActiveRuns() {
-	runs := []models.Run{}
-	c.Col.Find(nil).All(&runs)
-	if len(runs) == 0 {
-		c.CurrentRun = &models.Run{
-			GameInfo: models.GameInfo{
-				GameName: "No runs found. Please add a run over the config>runs menu.",
-			},
-		}
-		c.PrevRun = &models.Run{}
-		c.NextRun = &models.Run{}
+	runs, err := c.Storage.Runs.All(context.Background())
+	if err != nil {
+		c.LogError("while getting runs", err, true)
 		return
 	}
-	c.CurrentRun = &runs[c.RunIndex]
-
-	if c.RunIndex == 0 {
-		c.PrevRun = &models.Run{}
-	} else {
-		c.PrevRun = &runs[c.RunIndex-1]
-	}
-	if len(runs) <= c.RunIndex+1 {
-		c.NextRun = &models.Run{}
-	} else {
-		c.NextRun = &runs[c.RunIndex+1]
-	}
+	c.State.SetActiveRuns(runs)
+	c.CL.Refresh()
 }
 
-// UpdateUpNext will set the UpNext field on the base controller object to next run. That means NextRun und UpNext can be updated at different times. For displaying up next in overlay
+// UpdateUpNext will set the up next run in the state to the next run. That means NextRun und UpNext can be updated at different times. For displaying up next in overlay
 func (c *Controller) UpdateUpNext() {
-	c.UpNext = c.NextRun
+	c.State.SetUpNext()
 	go c.WSUpNextUpdate()
 }
 
+// Operator returns the name of the person doing the request. Clients send it in the X-Operator header
+func Operator(r *http.Request) string {
+	if o := r.Header.Get("X-Operator"); len(o) != 0 {
+		return o
+	}
+
+	return "unknown"
+}
+
 // Response will send out a generic response
 func (c Controller) Response(res, err string, code int, w http.ResponseWriter) {
 	w.Header().Set("Content-Type", "application/json")
@@ -61,6 +53,39 @@ func (c Controller) Response(res, err string, code int, w http.ResponseWriter) {
 	json.NewEncoder(w).Encode(resStruct)
 }
 
+// validationResponse is sent when a request body fails validation. Fields is set for a single run and Runs for a list of runs
+type validationResponse struct {
+	Ok     bool                `json:"ok"`
+	Err    string              `json:"error"`
+	Fields []models.FieldError `json:"fields,omitempty"`
+	Runs   []models.RunErrors  `json:"runs,omitempty"`
+}
+
+// ValidationError sends the field errors of a single run with status 422
+func (c Controller) ValidationError(fields []models.FieldError, w http.ResponseWriter) {
+	c.validationResponse(validationResponse{Err: "validation failed", Fields: fields}, w)
+}
+
+// LinkedPlayersError sends the edits of players linked to a runner which were rejected with status 400
+func (c Controller) LinkedPlayersError(fields []models.FieldError, w http.ResponseWriter) {
+	c.validationResponseCode(validationResponse{Err: "linked players can't be edited", Fields: fields}, http.StatusBadRequest, w)
+}
+
+// RunsValidationError sends the errors of a list of runs with status 422
+func (c Controller) RunsValidationError(runs []models.RunErrors, w http.ResponseWriter) {
+	c.validationResponse(validationResponse{Err: "validation failed", Runs: runs}, w)
+}
+
+func (c Controller) validationResponse(res validationResponse, w http.ResponseWriter) {
+	c.validationResponseCode(res, http.StatusUnprocessableEntity, w)
+}
+
+func (c Controller) validationResponseCode(res validationResponse, code int, w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(res)
+}
+
 // LogError is a helper function to log any errors and send a message informing the client about the error over websocket if wanted
 func (c Controller) LogError(action string, err error, sendToClient bool) {
 	msg := fmt.Sprintf("An error occurred while %v. The error is %v\n", action, err)
@@ -69,5 +94,5 @@ func (c Controller) LogError(action string, err error, sendToClient bool) {
 			c.WSReportError(msg)
 		}
 	}()
-	log.Printf(msg)
+	Errorf("%v", msg)
 }
@@ -0,0 +1,75 @@
+package common
+
+import (
+	"context"
+	"time"
+
+	"github.com/onestay/MarathonTools-API/api/models"
+	"github.com/onestay/MarathonTools-API/api/storage"
+)
+
+// SystemAuthor is the author of schedule versions which weren't caused by an operator
+const SystemAuthor = "system"
+
+// ScheduleSnapshot returns all runs before a change so the change can be recorded with RecordSchedule afterwards
+func (c Controller) ScheduleSnapshot(ctx context.Context) []models.Run {
+	return c.scheduleSnapshot(ctx, c.Storage)
+}
+
+// RecordSchedule stores the schedule after a change as a new version. If there is no version yet the schedule before
+// the change is stored first so it can be restored. Every change of the runs has to be recorded with it
+func (c Controller) RecordSchedule(ctx context.Context, author, action string, before []models.Run) {
+	c.recordSchedule(ctx, c.Storage, author, action, before)
+}
+
+func (c Controller) scheduleSnapshot(ctx context.Context, b storage.Backend) []models.Run {
+	runs, err := b.Runs.All(ctx)
+	if err != nil {
+		c.LogError("while getting runs for the schedule history", err, false)
+	}
+
+	return runs
+}
+
+// recordSchedule records a change of the schedule of the marathon of b
+func (c Controller) recordSchedule(ctx context.Context, b storage.Backend, author, action string, before []models.Run) {
+	after, err := b.Runs.All(ctx)
+	if err != nil {
+		c.LogError("while getting runs for the schedule history", err, false)
+		return
+	}
+
+	changes := models.DiffRuns(before, after)
+	if len(changes) == 0 {
+		return
+	}
+
+	versions, err := b.History.List(ctx)
+	if err != nil {
+		c.LogError("while getting the schedule history", err, false)
+		return
+	}
+	if len(versions) == 0 && len(before) != 0 {
+		_, err = b.History.Add(ctx, models.ScheduleVersion{
+			Author:  SystemAuthor,
+			Created: time.Now(),
+			Action:  "initial",
+			Changes: models.DiffRuns(nil, before),
+			Runs:    before,
+		})
+		if err != nil {
+			c.LogError("while saving the initial schedule version", err, false)
+		}
+	}
+
+	_, err = b.History.Add(ctx, models.ScheduleVersion{
+		Author:  author,
+		Created: time.Now(),
+		Action:  action,
+		Changes: changes,
+		Runs:    after,
+	})
+	if err != nil {
+		c.LogError("while saving schedule version", err, false)
+	}
+}
@@ -0,0 +1,59 @@
+package common
+
+import (
+	"context"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/onestay/MarathonTools-API/api/models"
+	"github.com/onestay/MarathonTools-API/api/storage"
+)
+
+// hasVersion reports whether the schedule history of b has a version by author for action
+func hasVersion(t *testing.T, b storage.Backend, author, action string) bool {
+	t.Helper()
+	versions, err := b.History.List(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range versions {
+		if v.Author == author && v.Action == action {
+			return true
+		}
+	}
+
+	return false
+}
+
+func TestSetupResultIsRecorded(t *testing.T) {
+	c := newTestController(t)
+	run := models.Run{RunID: primitive.NewObjectID(), GameInfo: models.GameInfo{GameName: "A"}}
+	if err := c.Storage.Runs.Insert(context.Background(), run); err != nil {
+		t.Fatal(err)
+	}
+
+	c.Setup.Start(&run)
+	c.Setup.Stop()
+
+	if !hasVersion(t, c.Storage, SystemAuthor, "setup") {
+		t.Error("the setup result wasn't recorded in the schedule history")
+	}
+}
+
+func TestRecordScheduleSkipsUnchanged(t *testing.T) {
+	c := newTestController(t)
+	ctx := context.Background()
+	if err := c.Storage.Runs.Insert(ctx, models.Run{RunID: primitive.NewObjectID()}); err != nil {
+		t.Fatal(err)
+	}
+
+	c.RecordSchedule(ctx, "tester", "update", c.ScheduleSnapshot(ctx))
+	versions, err := c.Storage.History.List(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 0 {
+		t.Errorf("recorded %v versions without a change", len(versions))
+	}
+}
@@ -0,0 +1,252 @@
+package common
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/onestay/MarathonTools-API/api/models"
+)
+
+// hostCheckInterval is how often the rotation is checked for a new host
+const hostCheckInterval = 5 * time.Second
+
+// HostRotation holds the host schedule. It's independent of the runs and the current host is the one whose slot
+// covers the current time
+type HostRotation struct {
+	// editMu is held while the rotation is changed and saved so concurrent edits don't overwrite each other. It's
+	// separate from mu so reading the rotation isn't blocked by the database
+	editMu sync.Mutex
+	// mu guards slots and current
+	mu    sync.RWMutex
+	slots []models.HostSlot
+	// current is the id of the slot which was current at the last check
+	current primitive.ObjectID
+	b       *Controller
+}
+
+// NewHostRotation loads the saved host rotation and starts watching for host changes
+func NewHostRotation(b *Controller) *HostRotation {
+	log.Println("Initializing host rotation...")
+	h := &HostRotation{
+		slots: loadHosts(b),
+		b:     b,
+	}
+	go h.watch()
+
+	return h
+}
+
+// Reload replaces the rotation with the saved rotation of the active marathon
+func (h *HostRotation) Reload() {
+	h.editMu.Lock()
+	defer h.editMu.Unlock()
+	slots := loadHosts(h.b)
+
+	h.mu.Lock()
+	h.slots = slots
+	h.mu.Unlock()
+
+	go h.check()
+}
+
+func loadHosts(b *Controller) []models.HostSlot {
+	slots, err := b.Storage.Hosts.Get(context.Background())
+	if err != nil {
+		return []models.HostSlot{}
+	}
+
+	return slots
+}
+
+// Current returns the current host. ok is false if no slot covers the current time
+func (h *HostRotation) Current() (host models.Person, ok bool) {
+	slot, ok := h.currentSlot(time.Now())
+	return slot.Host, ok
+}
+
+func (h *HostRotation) currentSlot(t time.Time) (models.HostSlot, bool) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for _, s := range h.slots {
+		if s.Covers(t) {
+			return s, true
+		}
+	}
+
+	return models.HostSlot{}, false
+}
+
+// Slots returns a copy of all slots sorted by start
+func (h *HostRotation) Slots() []models.HostSlot {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return append([]models.HostSlot{}, h.slots...)
+}
+
+// watch sends a host update whenever the current host changes
+func (h *HostRotation) watch() {
+	t := time.NewTicker(hostCheckInterval)
+	for range t.C {
+		h.check()
+	}
+}
+
+func (h *HostRotation) check() {
+	slot, _ := h.currentSlot(time.Now())
+
+	h.mu.Lock()
+	changed := slot.ID != h.current
+	h.current = slot.ID
+	h.mu.Unlock()
+
+	if changed {
+		h.b.WSHostUpdate()
+	}
+}
+
+// GetHosts returns the host rotation
+func (h *HostRotation) GetHosts(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.Slots())
+}
+
+// GetCurrentHost returns the current host and the commentators of the current run
+func (h *HostRotation) GetCurrentHost(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.b.onAir())
+}
+
+// AddHost adds a slot to the rotation. Slots may not overlap
+func (h *HostRotation) AddHost(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	slot := models.HostSlot{}
+	err := json.NewDecoder(r.Body).Decode(&slot)
+	if err != nil {
+		h.b.Response("", "invalid body", http.StatusBadRequest, w)
+		return
+	}
+	slot.ID = primitive.NewObjectID()
+
+	h.replace(w, r, func(slots []models.HostSlot) ([]models.HostSlot, error) {
+		return append(slots, slot), nil
+	})
+}
+
+// SetHosts replaces the whole rotation
+func (h *HostRotation) SetHosts(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	var slots []models.HostSlot
+	err := json.NewDecoder(r.Body).Decode(&slots)
+	if err != nil {
+		h.b.Response("", "invalid body", http.StatusBadRequest, w)
+		return
+	}
+	for i := range slots {
+		if slots[i].ID.IsZero() {
+			slots[i].ID = primitive.NewObjectID()
+		}
+	}
+
+	h.replace(w, r, func(_ []models.HostSlot) ([]models.HostSlot, error) {
+		return slots, nil
+	})
+}
+
+// DeleteHost removes a slot from the rotation
+func (h *HostRotation) DeleteHost(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	id, err := primitive.ObjectIDFromHex(ps.ByName("id"))
+	if err != nil {
+		h.b.Response("", "invalid bson id", http.StatusBadRequest, w)
+		return
+	}
+
+	h.replace(w, r, func(slots []models.HostSlot) ([]models.HostSlot, error) {
+		res := slots[:0]
+		for _, s := range slots {
+			if s.ID != id {
+				res = append(res, s)
+			}
+		}
+		if len(res) == len(slots) {
+			return nil, errSlotNotFound
+		}
+		return res, nil
+	})
+}
+
+// errSlotNotFound is returned by an edit of the rotation if the slot to edit doesn't exist
+var errSlotNotFound = errors.New("slot not found")
+
+// replace validates and saves the slots returned by f and sends the new rotation. f gets a copy of the current slots
+// and no other edit can happen until the slots are saved
+func (h *HostRotation) replace(w http.ResponseWriter, r *http.Request, f func([]models.HostSlot) ([]models.HostSlot, error)) {
+	h.editMu.Lock()
+	defer h.editMu.Unlock()
+
+	slots, err := f(h.Slots())
+	if err == errSlotNotFound {
+		h.b.Response("", err.Error(), http.StatusNotFound, w)
+		return
+	} else if err != nil {
+		h.b.Response("", err.Error(), http.StatusBadRequest, w)
+		return
+	}
+	sort.Slice(slots, func(i, j int) bool {
+		return slots[i].Start.Before(slots[j].Start)
+	})
+
+	for i, s := range slots {
+		if len(s.Host.DisplayName) == 0 {
+			h.b.Response("", "every slot needs a host", http.StatusBadRequest, w)
+			return
+		}
+		if !s.End.After(s.Start) {
+			h.b.Response("", "a slot has to end after it starts", http.StatusBadRequest, w)
+			return
+		}
+		if i > 0 && slots[i-1].End.After(s.Start) {
+			h.b.Response("", "slots may not overlap", http.StatusBadRequest, w)
+			return
+		}
+	}
+
+	err = h.b.Storage.Hosts.Save(r.Context(), slots)
+	if err != nil {
+		h.b.Response("", err.Error(), http.StatusInternalServerError, w)
+		return
+	}
+
+	h.mu.Lock()
+	h.slots = slots
+	h.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(slots)
+
+	go h.b.WSHostUpdate()
+}
+
+// onAir is the current host and the commentators of the current run
+type onAir struct {
+	Host         *models.Person  `json:"host"`
+	Commentators []models.Person `json:"commentators"`
+}
+
+func (c Controller) onAir() onAir {
+	o := onAir{Commentators: c.State.CurrentRun().Commentators}
+	if o.Commentators == nil {
+		o.Commentators = []models.Person{}
+	}
+	if host, ok := c.Hosts.Current(); ok {
+		o.Host = &host
+	}
+
+	return o
+}
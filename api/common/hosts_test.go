@@ -0,0 +1,89 @@
+package common
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/onestay/MarathonTools-API/api/models"
+)
+
+func TestHostRotationConcurrentEdits(t *testing.T) {
+	c := newTestController(t)
+	start := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	const n = 20
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			slot := models.HostSlot{
+				Host:  models.Person{DisplayName: "host"},
+				Start: start.Add(time.Duration(i) * time.Hour),
+				End:   start.Add(time.Duration(i+1) * time.Hour),
+			}
+			body, _ := json.Marshal(slot)
+			w := httptest.NewRecorder()
+			c.Hosts.AddHost(w, httptest.NewRequest("POST", "/hosts", bytes.NewReader(body)), nil)
+			if w.Code != http.StatusOK {
+				t.Errorf("adding slot %v returned %v: %v", i, w.Code, w.Body)
+			}
+		}(i)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.Hosts.Slots()
+			c.Hosts.Current()
+		}()
+	}
+	wg.Wait()
+
+	if got := len(c.Hosts.Slots()); got != n {
+		t.Errorf("rotation has %v slots, want %v", got, n)
+	}
+	saved, err := c.Storage.Hosts.Get(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(saved) != n {
+		t.Errorf("%v slots were saved, want %v", len(saved), n)
+	}
+}
+
+func TestHostRotationDelete(t *testing.T) {
+	c := newTestController(t)
+	start := time.Now().Add(-time.Minute)
+	body, _ := json.Marshal(models.HostSlot{Host: models.Person{DisplayName: "host"}, Start: start, End: start.Add(time.Hour)})
+	w := httptest.NewRecorder()
+	c.Hosts.AddHost(w, httptest.NewRequest("POST", "/hosts", bytes.NewReader(body)), nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("adding slot returned %v", w.Code)
+	}
+	if host, ok := c.Hosts.Current(); !ok || host.DisplayName != "host" {
+		t.Errorf("current host is %+v", host)
+	}
+	id := c.Hosts.Slots()[0].ID.Hex()
+
+	del := func() int {
+		w := httptest.NewRecorder()
+		c.Hosts.DeleteHost(w, httptest.NewRequest("DELETE", "/hosts/"+id, nil), httprouter.Params{{Key: "id", Value: id}})
+		return w.Code
+	}
+	if code := del(); code != http.StatusOK {
+		t.Errorf("deleting the slot returned %v", code)
+	}
+	if code := del(); code != http.StatusNotFound {
+		t.Errorf("deleting a missing slot returned %v", code)
+	}
+	if len(c.Hosts.Slots()) != 0 {
+		t.Error("slot wasn't deleted")
+	}
+}
@@ -0,0 +1,48 @@
+package common
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync/atomic"
+)
+
+// errorLog is used for errors. It's the only logger the error log level doesn't silence
+var errorLog = log.New(os.Stderr, "", log.LstdFlags)
+
+// debug is 1 if the log level is debug
+var debug int32
+
+// SetLogLevel applies a log level. debug logs everything including Debugf, info (the default) everything except
+// Debugf and error only logs errors
+func SetLogLevel(level string) error {
+	switch level {
+	case "debug", "info":
+		log.SetOutput(os.Stderr)
+	case "error":
+		log.SetOutput(io.Discard)
+	default:
+		return fmt.Errorf("unknown log level %q", level)
+	}
+
+	var d int32
+	if level == "debug" {
+		d = 1
+	}
+	atomic.StoreInt32(&debug, d)
+
+	return nil
+}
+
+// Debugf logs a message if the log level is debug
+func Debugf(format string, v ...interface{}) {
+	if atomic.LoadInt32(&debug) == 1 {
+		log.Printf(format, v...)
+	}
+}
+
+// Errorf logs an error at every log level
+func Errorf(format string, v ...interface{}) {
+	errorLog.Printf(format, v...)
+}
@@ -0,0 +1,113 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/onestay/MarathonTools-API/api/models"
+	"github.com/onestay/MarathonTools-API/api/storage"
+)
+
+// Marathons manages the active marathon. Everything the base controller holds belongs to the active marathon and is
+// reloaded when switching to another one
+type Marathons struct {
+	// mu serializes switches and guards onSwitch
+	mu       sync.Mutex
+	onSwitch []func(models.Marathon)
+	b        *Controller
+}
+
+// NewMarathons makes sure the default marathon exists and sets the active marathon of the storage backend to the one
+// which was active last time
+func NewMarathons(b *Controller) *Marathons {
+	log.Println("Initializing marathons...")
+	ctx := context.Background()
+	_, err := b.Storage.Marathons.Get(ctx, storage.DefaultMarathon)
+	if err == storage.ErrNotFound {
+		log.Println("No marathon found. Creating default marathon")
+		err = b.Storage.Marathons.Insert(ctx, models.Marathon{
+			ID:      storage.DefaultMarathon,
+			Name:    "Marathon",
+			Active:  true,
+			Created: time.Now(),
+		})
+	}
+	if err != nil {
+		b.LogError("while initializing the default marathon", err, false)
+	}
+
+	if id, err := b.Storage.Marathons.Active(ctx); err == nil {
+		b.Storage.Active.Set(id)
+	} else {
+		b.Storage.Active.Set(storage.DefaultMarathon)
+	}
+	log.Printf("Active marathon is %v", b.Storage.Active.ID())
+
+	return &Marathons{b: b}
+}
+
+// Active returns the active marathon
+func (m *Marathons) Active(ctx context.Context) (models.Marathon, error) {
+	return m.b.Storage.Marathons.Get(ctx, m.b.Storage.Active.ID())
+}
+
+// OnSwitch registers f to be called after the active marathon has been switched
+func (m *Marathons) OnSwitch(f func(models.Marathon)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.onSwitch = append(m.onSwitch, f)
+}
+
+// Switch makes the marathon with the given id the active one and reloads everything belonging to it.
+// It fails if the timer isn't stopped or the marathon is archived
+func (m *Marathons) Switch(ctx context.Context, id string) (models.Marathon, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.b.State.TimerState() != TimerStopped {
+		return models.Marathon{}, errors.New("can't switch marathons while timer is running")
+	}
+
+	marathon, err := m.b.Storage.Marathons.Get(ctx, id)
+	if err != nil {
+		return marathon, err
+	}
+	if marathon.Archived {
+		return marathon, errors.New("can't switch to an archived marathon")
+	}
+
+	err = m.b.Storage.Marathons.SetActive(ctx, id)
+	if err != nil {
+		return marathon, err
+	}
+	marathon.Active = true
+	m.b.Storage.Active.Set(id)
+
+	m.b.Setup.Reset()
+	m.b.Settings.Reload()
+	m.b.Hosts.Reload()
+	m.b.Automation.Reload()
+	m.b.MigrateRunners(ctx)
+	runs, err := m.b.Storage.Runs.All(ctx)
+	if err != nil {
+		m.b.LogError("while getting runs", err, true)
+	}
+	m.b.State.Reset(runs)
+	// the checklist depends on the current run
+	m.b.CL.Reload()
+	m.b.UpdateUpNext()
+
+	for _, f := range m.onSwitch {
+		go f(marathon)
+	}
+
+	go m.b.WSMarathonUpdate(marathon)
+	go m.b.WSRunUpdate()
+	go m.b.WSChecklistUpdate()
+	go m.b.WSSettingUpdate()
+
+	return marathon, nil
+}
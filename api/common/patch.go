@@ -0,0 +1,48 @@
+package common
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// MergePatch applies a JSON merge patch (RFC 7396) to doc. Objects are merged recursively, null removes a member and
+// every other value including arrays replaces the value in doc
+func MergePatch(doc, patch []byte) ([]byte, error) {
+	var d, p interface{}
+	if err := decodeNumbers(doc, &d); err != nil {
+		return nil, err
+	}
+	if err := decodeNumbers(patch, &p); err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(mergePatch(d, p))
+}
+
+func mergePatch(target, patch interface{}) interface{} {
+	p, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	t, ok := target.(map[string]interface{})
+	if !ok {
+		t = map[string]interface{}{}
+	}
+	for k, v := range p {
+		if v == nil {
+			delete(t, k)
+		} else {
+			t[k] = mergePatch(t[k], v)
+		}
+	}
+
+	return t
+}
+
+// decodeNumbers decodes data keeping numbers as json.Number so they aren't changed by a round trip through float64
+func decodeNumbers(data []byte, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	return dec.Decode(v)
+}
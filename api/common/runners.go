@@ -0,0 +1,201 @@
+package common
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/onestay/MarathonTools-API/api/models"
+	"github.com/onestay/MarathonTools-API/api/storage"
+)
+
+// runnerIndex is the runner directory indexed by id and lower case display name
+type runnerIndex struct {
+	byID   map[primitive.ObjectID]models.Runner
+	byName map[string]models.Runner
+}
+
+func (c *Controller) loadRunners(ctx context.Context) (*runnerIndex, error) {
+	runners, err := c.Storage.Runners.All(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	idx := &runnerIndex{
+		byID:   make(map[primitive.ObjectID]models.Runner, len(runners)),
+		byName: make(map[string]models.Runner, len(runners)),
+	}
+	for _, r := range runners {
+		idx.add(r)
+	}
+
+	return idx, nil
+}
+
+func (idx *runnerIndex) add(r models.Runner) {
+	idx.byID[r.ID] = r
+	if _, ok := idx.byName[strings.ToLower(r.DisplayName)]; !ok {
+		idx.byName[strings.ToLower(r.DisplayName)] = r
+	}
+}
+
+// ResolvePlayers links every player of the runs to a runner of the directory and copies the profile of the runner into
+// the player. Players without a runner id are matched by display name and a new runner is created if there is none with
+// that name. It returns the indexes of the runs which changed
+func (c *Controller) ResolvePlayers(ctx context.Context, runs []models.Run) ([]int, error) {
+	idx, err := c.loadRunners(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var changed []int
+	for i := range runs {
+		runChanged := false
+		for j := range runs[i].Players {
+			p := &runs[i].Players[j]
+
+			runner, ok := idx.byID[p.RunnerID]
+			if !ok {
+				if len(strings.TrimSpace(p.DisplayName)) == 0 {
+					continue
+				}
+				runner, ok = idx.byName[strings.ToLower(p.DisplayName)]
+			}
+			if !ok {
+				runner = models.RunnerFromPlayer(*p)
+				if err := c.Storage.Runners.Insert(ctx, runner); err != nil {
+					return changed, err
+				}
+				idx.add(runner)
+			}
+
+			if runner.Apply(p) {
+				runChanged = true
+			}
+		}
+		if runChanged {
+			changed = append(changed, i)
+		}
+	}
+
+	return changed, nil
+}
+
+// CheckLinkedPlayers returns an error for every profile field of a player linked to a runner which was changed. The
+// profile of a linked player is always copied from the runner so the change has to be made in the runner directory
+func (c *Controller) CheckLinkedPlayers(ctx context.Context, run models.Run) ([]models.FieldError, error) {
+	idx, err := c.loadRunners(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var errs []models.FieldError
+	for i, p := range run.Players {
+		runner, ok := idx.byID[p.RunnerID]
+		if p.RunnerID.IsZero() || !ok {
+			continue
+		}
+		for _, f := range runner.Differs(p) {
+			errs = append(errs, models.FieldError{
+				Field:   fmt.Sprintf("players[%v].%v", i, f),
+				Message: fmt.Sprintf("the player is linked to runner %v, change the runner in the runner directory instead", runner.DisplayName),
+			})
+		}
+	}
+
+	return errs, nil
+}
+
+// MigrateRunners moves the players embedded in the runs of the active marathon into the runner directory
+func (c *Controller) MigrateRunners(ctx context.Context) {
+	runs, err := c.Storage.Runs.All(ctx)
+	if err != nil {
+		c.LogError("while getting runs for the runner migration", err, false)
+		return
+	}
+	before := copyRuns(runs)
+
+	changed, err := c.ResolvePlayers(ctx, runs)
+	if err != nil {
+		c.LogError("while migrating runners", err, false)
+	}
+	for _, i := range changed {
+		if err := c.Storage.Runs.Update(ctx, runs[i]); err != nil {
+			c.LogError("while saving migrated run", err, false)
+		}
+	}
+	if len(changed) != 0 {
+		c.RecordSchedule(ctx, SystemAuthor, "migrate runners", before)
+		log.Printf("Linked the players of %v runs to the runner directory", len(changed))
+	}
+}
+
+// copyRuns returns a deep copy of runs so they can be recorded as the schedule before changing them in place
+func copyRuns(runs []models.Run) []models.Run {
+	res := make([]models.Run, len(runs))
+	for i, r := range runs {
+		res[i] = r.Copy()
+	}
+
+	return res
+}
+
+// PropagateRunner copies the profile of the runner into all runs of every marathon the runner is part of. The changes
+// are recorded in the schedule history of each marathon with author
+func (c *Controller) PropagateRunner(ctx context.Context, author string, runner models.Runner) error {
+	marathons, err := c.Storage.Marathons.All(ctx)
+	if err != nil {
+		return err
+	}
+
+	activeChanged := false
+	for _, m := range marathons {
+		changed, err := c.propagateRunner(ctx, c.Storage.Event(m.ID), author, runner)
+		if err != nil {
+			return fmt.Errorf("marathon %v: %v", m.ID, err)
+		}
+		if changed && m.ID == c.Storage.Active.ID() {
+			activeChanged = true
+		}
+	}
+
+	if activeChanged {
+		c.UpdateActiveRuns()
+		go c.WSRunUpdate()
+	}
+
+	return nil
+}
+
+// propagateRunner copies the profile of the runner into the runs of the marathon of b. It reports whether any run changed
+func (c *Controller) propagateRunner(ctx context.Context, b storage.Backend, author string, runner models.Runner) (bool, error) {
+	runs, err := b.Runs.All(ctx)
+	if err != nil {
+		return false, err
+	}
+	before := copyRuns(runs)
+
+	changed := false
+	for i := range runs {
+		runChanged := false
+		for j := range runs[i].Players {
+			if runs[i].Players[j].RunnerID == runner.ID && runner.Apply(&runs[i].Players[j]) {
+				runChanged = true
+			}
+		}
+		if runChanged {
+			changed = true
+			if err := b.Runs.Update(ctx, runs[i]); err != nil {
+				return changed, err
+			}
+		}
+	}
+	if changed {
+		c.recordSchedule(ctx, b, author, "update runner", before)
+	}
+
+	return changed, nil
+}
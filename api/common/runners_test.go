@@ -0,0 +1,89 @@
+package common
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/onestay/MarathonTools-API/api/models"
+)
+
+func TestCheckLinkedPlayers(t *testing.T) {
+	c := newTestController(t)
+	ctx := context.Background()
+	runner := models.Runner{ID: primitive.NewObjectID(), DisplayName: "runner", Country: "de", TwitchName: "runner"}
+	if err := c.Storage.Runners.Insert(ctx, runner); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		player models.PlayerInfo
+		fields []string
+	}{
+		{"unchanged", models.PlayerInfo{RunnerID: runner.ID, DisplayName: "runner", Country: "de", TwitchName: "runner"}, nil},
+		{"only the id", models.PlayerInfo{RunnerID: runner.ID}, nil},
+		{"edited", models.PlayerInfo{RunnerID: runner.ID, DisplayName: "other", Country: "us"}, []string{"players[0].displayName", "players[0].country"}},
+		{"not linked", models.PlayerInfo{DisplayName: "other", Country: "us"}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs, err := c.CheckLinkedPlayers(ctx, models.Run{Players: []models.PlayerInfo{tt.player}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(errs) != len(tt.fields) {
+				t.Fatalf("got errors %+v, want errors for %v", errs, tt.fields)
+			}
+			for i, e := range errs {
+				if e.Field != tt.fields[i] {
+					t.Errorf("got error for %v, want %v", e.Field, tt.fields[i])
+				}
+			}
+		})
+	}
+}
+
+func TestPropagateRunnerUpdatesAllMarathons(t *testing.T) {
+	c := newTestController(t)
+	ctx := context.Background()
+	runner := models.Runner{ID: primitive.NewObjectID(), DisplayName: "runner"}
+	if err := c.Storage.Runners.Insert(ctx, runner); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Storage.Marathons.Insert(ctx, models.Marathon{ID: "other", Name: "Other", Created: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+
+	ids := []string{c.Storage.Active.ID(), "other"}
+	for _, id := range ids {
+		run := models.Run{RunID: primitive.NewObjectID(), Players: []models.PlayerInfo{{RunnerID: runner.ID, DisplayName: "runner"}}}
+		if err := c.Storage.Event(id).Runs.Insert(ctx, run); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	runner.DisplayName = "renamed"
+	if err := c.PropagateRunner(ctx, "tester", runner); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, id := range ids {
+		runs, err := c.Storage.Event(id).Runs.All(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if name := runs[0].Players[0].DisplayName; name != "renamed" {
+			t.Errorf("player in marathon %v is called %v", id, name)
+		}
+		if !hasVersion(t, c.Storage.Event(id), "tester", "update runner") {
+			t.Errorf("the change in marathon %v wasn't recorded in its schedule history", id)
+		}
+	}
+	if name := c.State.CurrentRun().Players[0].DisplayName; name != "renamed" {
+		t.Errorf("current run wasn't refreshed, player is called %v", name)
+	}
+}
@@ -0,0 +1,153 @@
+package common
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/onestay/MarathonTools-API/api/models"
+)
+
+// SetupTracker tracks the setup time between runs. The setup clock is started when switching to a run and stopped when the timer starts
+type SetupTracker struct {
+	mu        sync.Mutex
+	running   bool
+	startedAt time.Time
+	runID     primitive.ObjectID
+	planned   float64
+	b         *Controller
+}
+
+type setupState struct {
+	Running   bool               `json:"running"`
+	StartedAt time.Time          `json:"startedAt"`
+	Elapsed   float64            `json:"elapsed"`
+	Planned   float64            `json:"planned"`
+	RunID     primitive.ObjectID `json:"runID,omitempty"`
+}
+
+// NewSetupTracker returns a new setup tracker with a stopped setup clock
+func NewSetupTracker(b *Controller) *SetupTracker {
+	return &SetupTracker{b: b}
+}
+
+// Start starts the setup clock for the given run. A setup clock which is already running is restarted
+func (s *SetupTracker) Start(r *models.Run) {
+	planned, _ := models.ParseEstimate(r.RunInfo.Setup)
+
+	s.mu.Lock()
+	s.running = true
+	s.startedAt = time.Now()
+	s.runID = r.RunID
+	s.planned = planned.Seconds()
+	state := s.state()
+	s.mu.Unlock()
+
+	go s.b.WSSetupUpdate(state)
+}
+
+// Stop stops the setup clock and records the setup result on the run the clock was started for
+func (s *SetupTracker) Stop() {
+	s.mu.Lock()
+	if !s.running {
+		s.mu.Unlock()
+		return
+	}
+	s.running = false
+	res := models.SetupResult{
+		Planned: s.planned,
+		Actual:  time.Since(s.startedAt).Seconds(),
+	}
+	res.Difference = res.Actual - res.Planned
+	runID := s.runID
+	state := s.state()
+	s.mu.Unlock()
+
+	go s.b.WSSetupUpdate(state)
+
+	if runID.IsZero() {
+		return
+	}
+
+	ctx := context.Background()
+	before := s.b.ScheduleSnapshot(ctx)
+	err := s.b.Storage.Runs.SetSetupResult(ctx, runID, res)
+	if err != nil {
+		s.b.LogError("while saving setup result", err, true)
+		return
+	}
+	s.b.RecordSchedule(ctx, SystemAuthor, "setup", before)
+
+	s.b.State.UpdateCurrentRun(func(r *models.Run) {
+		if r.RunID == runID {
+			r.SetupResult = &res
+			r.Version++
+		}
+	})
+	go s.b.WSRunsOnlyUpdate()
+}
+
+// Reset stops the setup clock without recording a result
+func (s *SetupTracker) Reset() {
+	s.mu.Lock()
+	s.running = false
+	s.runID = primitive.NilObjectID
+	s.planned = 0
+	state := s.state()
+	s.mu.Unlock()
+
+	go s.b.WSSetupUpdate(state)
+}
+
+// State returns the current state of the setup clock
+func (s *SetupTracker) State() setupState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.state()
+}
+
+// state has to be called with the lock held
+func (s *SetupTracker) state() setupState {
+	st := setupState{
+		Running:   s.running,
+		StartedAt: s.startedAt,
+		Planned:   s.planned,
+		RunID:     s.runID,
+	}
+	if s.running {
+		st.Elapsed = time.Since(s.startedAt).Seconds()
+	}
+
+	return st
+}
+
+// GetSetup returns the state of the setup clock and the total setup difference over all runs
+func (s *SetupTracker) GetSetup(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	runs, err := s.b.Storage.Runs.All(r.Context())
+	if err != nil {
+		s.b.Response("", err.Error(), http.StatusInternalServerError, w)
+		return
+	}
+
+	var total float64
+	for _, r := range runs {
+		if r.SetupResult != nil {
+			total += r.SetupResult.Difference
+		}
+	}
+
+	s.mu.Lock()
+	res := struct {
+		setupState
+		TotalDifference float64 `json:"totalDifference"`
+	}{s.state(), total}
+	s.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
@@ -0,0 +1,235 @@
+package common
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/onestay/MarathonTools-API/api/models"
+)
+
+// Store holds the live state of the marathon which is shared between all controllers and goroutines.
+// All access goes through its methods. Runs are always copied in and out so no one can modify them without holding the lock
+type Store struct {
+	mu         sync.RWMutex
+	runIndex   int
+	prevRun    models.Run
+	currentRun models.Run
+	nextRun    models.Run
+	upNext     models.Run
+	timerState TimerState
+	timerTime  float64
+}
+
+// Snapshot is a consistent copy of the state at one point in time
+type Snapshot struct {
+	RunIndex   int
+	PrevRun    models.Run
+	CurrentRun models.Run
+	NextRun    models.Run
+	UpNext     models.Run
+	TimerState TimerState
+	TimerTime  float64
+}
+
+// NewStore returns a new store with a stopped timer
+func NewStore(runIndex int) *Store {
+	return &Store{
+		runIndex:   runIndex,
+		timerState: TimerStopped,
+	}
+}
+
+// Snapshot returns a copy of the whole state
+func (s *Store) Snapshot() Snapshot {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return Snapshot{
+		RunIndex:   s.runIndex,
+		PrevRun:    s.prevRun.Copy(),
+		CurrentRun: s.currentRun.Copy(),
+		NextRun:    s.nextRun.Copy(),
+		UpNext:     s.upNext.Copy(),
+		TimerState: s.timerState,
+		TimerTime:  s.timerTime,
+	}
+}
+
+// RunIndex returns the index of the current run
+func (s *Store) RunIndex() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.runIndex
+}
+
+// CurrentRun returns a copy of the current run
+func (s *Store) CurrentRun() models.Run {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.currentRun.Copy()
+}
+
+// NextRun returns a copy of the next run
+func (s *Store) NextRun() models.Run {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.nextRun.Copy()
+}
+
+// UpNext returns a copy of the run shown as up next
+func (s *Store) UpNext() models.Run {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.upNext.Copy()
+}
+
+// TimerState returns the state of the main timer
+func (s *Store) TimerState() TimerState {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.timerState
+}
+
+// TimerTime returns the last time of the main timer
+func (s *Store) TimerTime() float64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.timerTime
+}
+
+// SetTimerState sets the state of the main timer
+func (s *Store) SetTimerState(state TimerState) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.timerState = state
+}
+
+// SetTimerTime sets the time of the main timer
+func (s *Store) SetTimerTime(t float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.timerTime = t
+}
+
+// SetUpNext sets the up next run to the next run
+func (s *Store) SetUpNext() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.upNext = s.nextRun.Copy()
+}
+
+// UpdateCurrentRun calls f with the current run while holding the lock and returns a copy of the modified run
+func (s *Store) UpdateCurrentRun(f func(r *models.Run)) models.Run {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f(&s.currentRun)
+	return s.currentRun.Copy()
+}
+
+// RefreshRun replaces every active run and the up next run which has the same id as run. The timers of the current run
+// are kept since they belong to the live state. It reports whether any run was replaced
+func (s *Store) RefreshRun(run models.Run) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if run.RunID.IsZero() {
+		return false
+	}
+
+	replaced := false
+	for _, r := range []*models.Run{&s.prevRun, &s.currentRun, &s.nextRun, &s.upNext} {
+		if r.RunID != run.RunID {
+			continue
+		}
+
+		updated := run.Copy()
+		if r == &s.currentRun {
+			keepTimers(&updated, *r)
+		}
+		*r = updated
+		replaced = true
+	}
+
+	return replaced
+}
+
+// SetActiveRuns updates the previous, current and next run from all runs based on the current run index
+func (s *Store) SetActiveRuns(runs []models.Run) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.setActiveRuns(runs)
+}
+
+// SwitchRun sets the run index and updates the active runs. It fails if the timer isn't stopped
+func (s *Store) SwitchRun(index int, runs []models.Run) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.timerState != TimerStopped {
+		return errors.New("can't switch runs while timer is running")
+	}
+	if index < 0 || index >= len(runs) {
+		return errors.New("run index out of range")
+	}
+
+	s.runIndex = index
+	s.setActiveRuns(runs)
+	return nil
+}
+
+// Reset sets the run index back to the first run and updates the active runs. It's used when switching marathons
+func (s *Store) Reset(runs []models.Run) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.runIndex = 0
+	s.timerTime = 0
+	s.setActiveRuns(runs)
+}
+
+func (s *Store) setActiveRuns(runs []models.Run) {
+	if len(runs) == 0 {
+		s.currentRun = models.Run{
+			GameInfo: models.GameInfo{
+				GameName: "No runs found. Please add a run over the config>runs menu.",
+			},
+		}
+		s.prevRun = models.Run{}
+		s.nextRun = models.Run{}
+		return
+	}
+
+	// runs might have been deleted since the index was set
+	if s.runIndex >= len(runs) {
+		s.runIndex = len(runs) - 1
+	}
+	current := runs[s.runIndex].Copy()
+	if current.RunID == s.currentRun.RunID {
+		keepTimers(&current, s.currentRun)
+	}
+	s.currentRun = current
+
+	if s.runIndex == 0 {
+		s.prevRun = models.Run{}
+	} else {
+		s.prevRun = runs[s.runIndex-1].Copy()
+	}
+	if len(runs) <= s.runIndex+1 {
+		s.nextRun = models.Run{}
+	} else {
+		s.nextRun = runs[s.runIndex+1].Copy()
+	}
+}
+
+// keepTimers copies the player and team timers of old into run
+func keepTimers(run *models.Run, old models.Run) {
+	for i := range run.Players {
+		if i < len(old.Players) {
+			run.Players[i].Timer = old.Players[i].Timer
+		}
+	}
+	for i := range run.Teams {
+		if i < len(old.Teams) {
+			run.Teams[i].Timer = old.Teams[i].Timer
+		}
+	}
+}
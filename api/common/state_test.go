@@ -0,0 +1,140 @@
+package common
+
+import (
+	"sync"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/onestay/MarathonTools-API/api/models"
+)
+
+func testRuns(n int) []models.Run {
+	runs := make([]models.Run, n)
+	for i := range runs {
+		runs[i] = models.Run{
+			RunID:    primitive.NewObjectID(),
+			GameInfo: models.GameInfo{GameName: string(rune('A' + i))},
+			Players:  []models.PlayerInfo{{DisplayName: "runner"}},
+		}
+	}
+
+	return runs
+}
+
+func TestStoreConcurrentAccess(t *testing.T) {
+	runs := testRuns(5)
+	s := NewStore(0)
+	s.SetActiveRuns(runs)
+
+	var wg sync.WaitGroup
+	run := func(n int, f func(i int)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < n; i++ {
+				f(i)
+			}
+		}()
+	}
+
+	run(500, func(i int) {
+		// a stopped timer has to be set again since the other goroutine changes it
+		s.SetTimerState(TimerStopped)
+		s.SwitchRun(i%len(runs), runs)
+	})
+	run(500, func(i int) {
+		s.SetTimerState(TimerRunning)
+		s.SetTimerTime(float64(i))
+	})
+	run(500, func(i int) {
+		r := runs[i%len(runs)].Copy()
+		r.RunInfo.Category = "refreshed"
+		s.RefreshRun(r)
+	})
+	run(500, func(int) {
+		s.UpdateCurrentRun(func(r *models.Run) {
+			r.Players[0].Timer.Time++
+		})
+	})
+	run(500, func(int) {
+		snap := s.Snapshot()
+		// the runs of a snapshot belong to the same index
+		if snap.CurrentRun.RunID != runs[snap.RunIndex].RunID {
+			t.Errorf("current run %v doesn't belong to index %v", snap.CurrentRun.RunID, snap.RunIndex)
+		}
+		if snap.RunIndex > 0 && snap.PrevRun.RunID != runs[snap.RunIndex-1].RunID {
+			t.Errorf("previous run %v doesn't belong to index %v", snap.PrevRun.RunID, snap.RunIndex)
+		}
+		// modifying a snapshot mustn't change the store
+		if len(snap.CurrentRun.Players) != 0 {
+			snap.CurrentRun.Players[0].DisplayName = "changed"
+		}
+	})
+	run(500, func(int) {
+		s.CurrentRun()
+		s.NextRun()
+		s.TimerState()
+		s.RunIndex()
+	})
+	wg.Wait()
+
+	if name := s.CurrentRun().Players[0].DisplayName; name != "runner" {
+		t.Errorf("snapshot changed the store, display name is %v", name)
+	}
+}
+
+func TestStoreSwitchRun(t *testing.T) {
+	runs := testRuns(3)
+	s := NewStore(0)
+	s.SetActiveRuns(runs)
+
+	s.SetTimerState(TimerRunning)
+	if err := s.SwitchRun(1, runs); err == nil {
+		t.Error("switched runs while the timer is running")
+	}
+
+	s.SetTimerState(TimerStopped)
+	if err := s.SwitchRun(3, runs); err == nil {
+		t.Error("switched to an index out of range")
+	}
+	if err := s.SwitchRun(2, runs); err != nil {
+		t.Fatal(err)
+	}
+
+	snap := s.Snapshot()
+	if snap.RunIndex != 2 || snap.CurrentRun.RunID != runs[2].RunID || snap.PrevRun.RunID != runs[1].RunID {
+		t.Errorf("wrong active runs after switch: %+v", snap)
+	}
+	if !snap.NextRun.RunID.IsZero() {
+		t.Errorf("last run has a next run %v", snap.NextRun.RunID)
+	}
+}
+
+func TestStoreRefreshRunKeepsTimers(t *testing.T) {
+	runs := testRuns(2)
+	s := NewStore(0)
+	s.SetActiveRuns(runs)
+	s.UpdateCurrentRun(func(r *models.Run) {
+		r.Players[0].Timer.Finished = true
+		r.Players[0].Timer.Time = 42
+	})
+
+	updated := runs[0].Copy()
+	updated.GameInfo.GameName = "updated"
+	if !s.RefreshRun(updated) {
+		t.Fatal("current run wasn't replaced")
+	}
+
+	cur := s.CurrentRun()
+	if cur.GameInfo.GameName != "updated" {
+		t.Errorf("game name is %v, want updated", cur.GameInfo.GameName)
+	}
+	if !cur.Players[0].Timer.Finished || cur.Players[0].Timer.Time != 42 {
+		t.Errorf("timers of the current run weren't kept: %+v", cur.Players[0].Timer)
+	}
+
+	if s.RefreshRun(models.Run{}) {
+		t.Error("a run without id replaced an active run")
+	}
+}
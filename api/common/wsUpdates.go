@@ -1,41 +1,60 @@
 package common
 
 import (
+	"context"
 	"encoding/json"
+	"time"
 
+	"github.com/onestay/MarathonTools-API/api/events"
 	"github.com/onestay/MarathonTools-API/api/models"
 )
 
 // SendInitialData will send some initial data over the websocket
 func (c Controller) SendInitialData() []byte {
-	var runs []models.Run
-	c.Col.Find(nil).All(&runs)
-
-	data := struct {
-		DataType       string       `json:"dataType"`
-		Runs           []models.Run `json:"runs"`
-		PrevRun        models.Run   `json:"prevRun"`
-		CurrentRun     models.Run   `json:"currentRun"`
-		NextRun        models.Run   `json:"nextRun"`
-		RunIndex       int          `json:"runIndex"`
-		TimerState     TimerState   `json:"timerState"`
-		UpNextRun      models.Run   `json:"upNext"`
-		ChecklistItems []*item      `json:"checklistItems"`
-		Settings       Settings     `json:"settings"`
+	runs, _ := c.Storage.Runs.All(context.Background())
+	marathon, _ := c.Marathons.Active(context.Background())
+	st := c.State.Snapshot()
+
+	data := struct {
+		DataType       string          `json:"dataType"`
+		Runs           []models.Run    `json:"runs"`
+		PrevRun        models.Run      `json:"prevRun"`
+		CurrentRun     models.Run      `json:"currentRun"`
+		NextRun        models.Run      `json:"nextRun"`
+		RunIndex       int             `json:"runIndex"`
+		TimerState     TimerState      `json:"timerState"`
+		UpNextRun      models.Run      `json:"upNext"`
+		ChecklistItems []item          `json:"checklistItems"`
+		Settings       Settings        `json:"settings"`
+		Setup          setupState      `json:"setup"`
+		Marathon       models.Marathon `json:"marathon"`
+		OnAir          onAir           `json:"onAir"`
 		// FIXME spell initial correctly. Need to change on client side too!
-	}{"initalData", runs, *c.PrevRun, *c.CurrentRun, *c.NextRun, c.RunIndex, c.TimerState, *c.UpNext, c.CL.Items, *c.Settings.S}
+	}{"initalData", runs, st.PrevRun, st.CurrentRun, st.NextRun, st.RunIndex, st.TimerState, st.UpNext, c.CL.GetItems(), c.Settings.Get(), c.Setup.State(), marathon.Public(), c.onAir()}
 
 	d, _ := json.Marshal(data)
 
 	return d
 }
 
+// WSEvent forwards an event of the event bus
+func (c Controller) WSEvent(e events.Event) {
+	data := struct {
+		DataType string       `json:"dataType"`
+		Event    events.Event `json:"event"`
+	}{"event", e}
+
+	d, _ := json.Marshal(data)
+
+	c.WS.Broadcast <- d
+}
+
 // WSSettingUpdate sends a settings update
 func (c Controller) WSSettingUpdate() {
 	data := struct {
 		DataType string   `json:"dataType"`
 		Settings Settings `json:"settings"`
-	}{"settingsUpdate", *c.Settings.S}
+	}{"settingsUpdate", c.Settings.Get()}
 
 	d, _ := json.Marshal(data)
 
@@ -44,8 +63,8 @@ func (c Controller) WSSettingUpdate() {
 
 // WSRunUpdate sends an update for all runs over the websocket and current runs over the websocket.
 func (c Controller) WSRunUpdate() {
-	var runs []models.Run
-	c.Col.Find(nil).All(&runs)
+	runs, _ := c.Storage.Runs.All(context.Background())
+	st := c.State.Snapshot()
 
 	data := struct {
 		DataType   string       `json:"dataType"`
@@ -55,7 +74,7 @@ func (c Controller) WSRunUpdate() {
 		NextRun    models.Run   `json:"nextRun"`
 		RunIndex   int          `json:"runIndex"`
 		UpNextRun  models.Run   `json:"upNext"`
-	}{"runUpdate", runs, *c.PrevRun, *c.CurrentRun, *c.NextRun, c.RunIndex, *c.UpNext}
+	}{"runUpdate", runs, st.PrevRun, st.CurrentRun, st.NextRun, st.RunIndex, st.UpNext}
 
 	d, _ := json.Marshal(data)
 
@@ -67,7 +86,7 @@ func (c Controller) WSUpNextUpdate() {
 	data := struct {
 		DataType  string     `json:"dataType"`
 		UpNextRun models.Run `json:"upNextRun"`
-	}{"upNextUpdate", *c.UpNext}
+	}{"upNextUpdate", c.State.UpNext()}
 
 	d, _ := json.Marshal(data)
 
@@ -77,9 +96,10 @@ func (c Controller) WSUpNextUpdate() {
 // WSChecklistUpdate sends a checklist update to the websocket
 func (c Controller) WSChecklistUpdate() {
 	data := struct {
-		DataType       string  `json:"dataType"`
-		ChecklistItems []*item `json:"checklistItems"`
-	}{"checklistUpdate", c.CL.Items}
+		DataType       string                    `json:"dataType"`
+		ChecklistItems []item                    `json:"checklistItems"`
+		Override       *models.ChecklistLogEntry `json:"override"`
+	}{"checklistUpdate", c.CL.GetItems(), c.CL.Overridden()}
 
 	d, _ := json.Marshal(data)
 
@@ -88,8 +108,7 @@ func (c Controller) WSChecklistUpdate() {
 
 // WSRunsOnlyUpdate only updates runs and not current runs
 func (c Controller) WSRunsOnlyUpdate() {
-	var runs []models.Run
-	c.Col.Find(nil).All(&runs)
+	runs, _ := c.Storage.Runs.All(context.Background())
 
 	data := struct {
 		DataType string       `json:"dataType"`
@@ -103,6 +122,7 @@ func (c Controller) WSRunsOnlyUpdate() {
 
 // WSCurrentUpdate sends ws data with the current runs
 func (c Controller) WSCurrentUpdate() {
+	st := c.State.Snapshot()
 	data := struct {
 		DataType   string     `json:"dataType"`
 		PrevRun    models.Run `json:"prevRun"`
@@ -110,7 +130,19 @@ func (c Controller) WSCurrentUpdate() {
 		NextRun    models.Run `json:"nextRun"`
 		UpNextRun  models.Run `json:"upNext"`
 		RunIndex   int        `json:"runIndex"`
-	}{"runCurrentUpdate", *c.PrevRun, *c.CurrentRun, *c.NextRun, *c.UpNext, c.RunIndex}
+	}{"runCurrentUpdate", st.PrevRun, st.CurrentRun, st.NextRun, st.UpNext, st.RunIndex}
+
+	d, _ := json.Marshal(data)
+
+	c.WS.Broadcast <- d
+}
+
+// WSHostUpdate sends the current host and the commentators of the current run
+func (c Controller) WSHostUpdate() {
+	data := struct {
+		DataType string `json:"dataType"`
+		onAir
+	}{"hostUpdate", c.onAir()}
 
 	d, _ := json.Marshal(data)
 
@@ -122,7 +154,7 @@ func (c Controller) WSTimeUpdate() {
 	data := struct {
 		DataType string  `json:"dataType"`
 		T        float64 `json:"t"`
-	}{"timeUpdate", c.TimerTime}
+	}{"timeUpdate", c.State.TimerTime()}
 
 	d, _ := json.Marshal(data)
 
@@ -134,7 +166,7 @@ func (c Controller) WSStateUpdate() {
 	data := struct {
 		DataType string     `json:"dataType"`
 		State    TimerState `json:"state"`
-	}{"stateUpdate", c.TimerState}
+	}{"stateUpdate", c.State.TimerState()}
 
 	d, _ := json.Marshal(data)
 
@@ -166,3 +198,80 @@ func (c Controller) WSDonationUpdate(oldAmount, newAmount float64) {
 
 	c.WS.Broadcast <- d
 }
+
+// WSNamedTimeUpdate sends a time update for a named timer
+func (c Controller) WSNamedTimeUpdate(name string, t float64) {
+	data := struct {
+		DataType string  `json:"dataType"`
+		Timer    string  `json:"timer"`
+		T        float64 `json:"t"`
+	}{"namedTimeUpdate", name, t}
+
+	d, _ := json.Marshal(data)
+
+	c.WS.Broadcast <- d
+}
+
+// WSNamedStateUpdate sends a state update for a named timer
+func (c Controller) WSNamedStateUpdate(name string, state TimerState) {
+	data := struct {
+		DataType string     `json:"dataType"`
+		Timer    string     `json:"timer"`
+		State    TimerState `json:"state"`
+	}{"namedStateUpdate", name, state}
+
+	d, _ := json.Marshal(data)
+
+	c.WS.Broadcast <- d
+}
+
+// WSNamedTimerDelete informs the client that a named timer has been removed
+func (c Controller) WSNamedTimerDelete(name string) {
+	data := struct {
+		DataType string `json:"dataType"`
+		Timer    string `json:"timer"`
+	}{"namedTimerDelete", name}
+
+	d, _ := json.Marshal(data)
+
+	c.WS.Broadcast <- d
+}
+
+// WSSetupUpdate sends an update about the setup clock
+func (c Controller) WSSetupUpdate(s setupState) {
+	data := struct {
+		DataType string     `json:"dataType"`
+		Setup    setupState `json:"setup"`
+	}{"setupUpdate", s}
+
+	d, _ := json.Marshal(data)
+
+	c.WS.Broadcast <- d
+}
+
+// WSCountdownUpdate sends the remaining time of a countdown. running is false once the countdown is finished or cancelled
+func (c Controller) WSCountdownUpdate(name string, target time.Time, remaining float64, running bool) {
+	data := struct {
+		DataType  string    `json:"dataType"`
+		Name      string    `json:"name"`
+		Target    time.Time `json:"target"`
+		Remaining float64   `json:"remaining"`
+		Running   bool      `json:"running"`
+	}{"countdownUpdate", name, target, remaining, running}
+
+	d, _ := json.Marshal(data)
+
+	c.WS.Broadcast <- d
+}
+
+// WSMarathonUpdate sends the active marathon after it has been switched
+func (c Controller) WSMarathonUpdate(m models.Marathon) {
+	data := struct {
+		DataType string          `json:"dataType"`
+		Marathon models.Marathon `json:"marathon"`
+	}{"marathonUpdate", m.Public()}
+
+	d, _ := json.Marshal(data)
+
+	c.WS.Broadcast <- d
+}
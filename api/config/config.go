@@ -0,0 +1,286 @@
+// Package config loads the configuration of the API from a YAML file and env vars.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/onestay/MarathonTools-API/api/models"
+)
+
+// DefaultPath is where the config file is read from if CONFIG_FILE isn't set
+const DefaultPath = "./config/config.yml"
+
+// Config is the configuration of the API. Values in the file are overridden by env vars
+type Config struct {
+	Server    ServerConfig   `yaml:"server"`
+	Storage   StorageConfig  `yaml:"storage"`
+	Donations DonationConfig `yaml:"donations"`
+	Social    SocialConfig   `yaml:"social"`
+	Timer     TimerConfig    `yaml:"timer"`
+	Log       LogConfig      `yaml:"log"`
+}
+
+// ServerConfig configures the http server
+type ServerConfig struct {
+	// Port is the address to listen on, e.g. :3000
+	Port string `yaml:"port"`
+}
+
+// StorageConfig selects and configures the storage backend
+type StorageConfig struct {
+	// Backend is either mongo or embedded
+	Backend     string `yaml:"backend"`
+	MongoServer string `yaml:"mongoServer"`
+	RedisServer string `yaml:"redisServer"`
+	// DataFile is the database file of the embedded backend
+	DataFile string `yaml:"dataFile"`
+}
+
+// DonationConfig configures the donation provider of marathons without their own provider
+type DonationConfig struct {
+	// Provider is either gdq, srcom or empty to disable donations
+	Provider     string `yaml:"provider"`
+	MarathonSlug string `yaml:"marathonSlug"`
+	GDQURL       string `yaml:"gdqURL"`
+	GDQEventID   string `yaml:"gdqEventID"`
+	GDQUsername  string `yaml:"gdqUsername"`
+	GDQPassword  string `yaml:"gdqPassword"`
+}
+
+// SocialConfig holds the credentials for twitch, twitter, the social auth service and featured channels
+type SocialConfig struct {
+	// TwitchBackend is helix to call twitch directly or socialAuth to go through the social auth service. If it's empty
+	// socialAuth is used if authURL is set
+	TwitchBackend       string `yaml:"twitchBackend"`
+	TwitchClientID      string `yaml:"twitchClientID"`
+	TwitchClientSecret  string `yaml:"twitchClientSecret"`
+	TwitchCallback      string `yaml:"twitchCallback"`
+	TwitterKey          string `yaml:"twitterKey"`
+	TwitterSecret       string `yaml:"twitterSecret"`
+	TwitterCallback     string `yaml:"twitterCallback"`
+	AuthURL             string `yaml:"authURL"`
+	AuthKey             string `yaml:"authKey"`
+	FeaturedChannelsKey string `yaml:"featuredChannelsKey"`
+}
+
+// TimerConfig configures the timers
+type TimerConfig struct {
+	// RefreshInterval is the interval in ms in which timers send time updates
+	RefreshInterval int `yaml:"refreshInterval"`
+}
+
+// LogConfig configures logging
+type LogConfig struct {
+	// Level is debug, info or error
+	Level string `yaml:"level"`
+}
+
+// Default returns the config used for everything which isn't set
+func Default() Config {
+	return Config{
+		Server: ServerConfig{
+			Port: ":3000",
+		},
+		Storage: StorageConfig{
+			Backend:  "mongo",
+			DataFile: "./data/marathon.db",
+		},
+		Timer: TimerConfig{
+			RefreshInterval: 100,
+		},
+		Log: LogConfig{
+			Level: "info",
+		},
+	}
+}
+
+// Load reads the config file at path, applies the env vars and validates the result.
+// A missing file isn't an error so the API can still be configured with env vars only
+func Load(path string) (Config, error) {
+	cfg := Default()
+
+	data, err := os.ReadFile(path)
+	if err == nil {
+		if err := yaml.Unmarshal(data, &cfg); err != nil {
+			return cfg, fmt.Errorf("couldn't parse %v: %v", path, err)
+		}
+	} else if !os.IsNotExist(err) {
+		return cfg, fmt.Errorf("couldn't read %v: %v", path, err)
+	}
+
+	if err := cfg.applyEnv(); err != nil {
+		return cfg, err
+	}
+
+	// a bare port number is the most common mistake
+	if _, err := strconv.Atoi(cfg.Server.Port); err == nil {
+		cfg.Server.Port = ":" + cfg.Server.Port
+	}
+
+	return cfg, cfg.Validate()
+}
+
+// env maps the env vars to the values they override
+func (c *Config) env() map[string]*string {
+	return map[string]*string{
+		"HTTP_PORT":             &c.Server.Port,
+		"STORAGE_BACKEND":       &c.Storage.Backend,
+		"MONGO_SERVER":          &c.Storage.MongoServer,
+		"REDIS_SERVER":          &c.Storage.RedisServer,
+		"DATA_FILE":             &c.Storage.DataFile,
+		"DONATION_PROVIDER":     &c.Donations.Provider,
+		"MARATHON_SLUG":         &c.Donations.MarathonSlug,
+		"GDQ_TRACKER_URL":       &c.Donations.GDQURL,
+		"GDQ_TRACKER_EVENT_ID":  &c.Donations.GDQEventID,
+		"GDQ_TRACKER_USERNAME":  &c.Donations.GDQUsername,
+		"GDQ_TRACKER_PASSWORD":  &c.Donations.GDQPassword,
+		"TWITCH_CLIENT_ID":      &c.Social.TwitchClientID,
+		"TWITCH_CLIENT_SECRET":  &c.Social.TwitchClientSecret,
+		"TWITCH_CALLBACK":       &c.Social.TwitchCallback,
+		"TWITTER_KEY":           &c.Social.TwitterKey,
+		"TWITTER_SECRET":        &c.Social.TwitterSecret,
+		"TWITTER_CALLBACK":      &c.Social.TwitterCallback,
+		"SOCIAL_AUTH_URL":       &c.Social.AuthURL,
+		"SOCIAL_AUTH_KEY":       &c.Social.AuthKey,
+		"FEATURED_CHANNELS_KEY": &c.Social.FeaturedChannelsKey,
+		"TWITCH_BACKEND":        &c.Social.TwitchBackend,
+		"LOG_LEVEL":             &c.Log.Level,
+	}
+}
+
+func (c *Config) applyEnv() error {
+	for name, v := range c.env() {
+		if e, ok := os.LookupEnv(name); ok && len(e) != 0 {
+			*v = e
+		}
+	}
+
+	if e := os.Getenv("REFRESH_INTERVAL"); len(e) != 0 {
+		i, err := strconv.Atoi(e)
+		if err != nil {
+			return fmt.Errorf("REFRESH_INTERVAL has to be a number of milliseconds, got %v", e)
+		}
+		c.Timer.RefreshInterval = i
+	}
+
+	return nil
+}
+
+// Validate checks the config and returns an error listing every problem
+func (c Config) Validate() error {
+	var errs []string
+	add := func(format string, a ...interface{}) {
+		errs = append(errs, fmt.Sprintf(format, a...))
+	}
+
+	if _, _, err := net.SplitHostPort(c.Server.Port); err != nil {
+		add("server.port has to be an address like :3000, got %q", c.Server.Port)
+	}
+
+	switch c.Storage.Backend {
+	case "mongo":
+		if len(c.Storage.MongoServer) == 0 {
+			add("storage.mongoServer (MONGO_SERVER) is required for the mongo backend")
+		}
+		if len(c.Storage.RedisServer) == 0 {
+			add("storage.redisServer (REDIS_SERVER) is required for the mongo backend")
+		}
+	case "embedded":
+		if len(c.Storage.DataFile) == 0 {
+			add("storage.dataFile (DATA_FILE) is required for the embedded backend")
+		}
+	default:
+		add("storage.backend has to be mongo or embedded, got %q", c.Storage.Backend)
+	}
+
+	switch c.Donations.Provider {
+	case "":
+	case "gdq":
+		if len(c.Donations.GDQURL) == 0 || len(c.Donations.GDQEventID) == 0 {
+			add("donations.gdqURL and donations.gdqEventID are required for the gdq donation provider")
+		}
+	case "srcom":
+		if len(c.Donations.MarathonSlug) == 0 {
+			add("donations.marathonSlug (MARATHON_SLUG) is required for the srcom donation provider")
+		}
+	default:
+		add("donations.provider has to be gdq, srcom or empty, got %q", c.Donations.Provider)
+	}
+
+	if len(c.Social.AuthURL) != 0 && len(c.Social.AuthKey) == 0 {
+		add("social.authKey (SOCIAL_AUTH_KEY) is required if social.authURL is set")
+	}
+	switch c.Social.TwitchBackend {
+	case "", "helix":
+		if c.Social.Twitch() == "helix" && len(c.Social.TwitchClientID) != 0 && (len(c.Social.TwitchClientSecret) == 0 || len(c.Social.TwitchCallback) == 0) {
+			add("social.twitchClientSecret and social.twitchCallback are required for the helix twitch backend")
+		}
+	case "socialAuth":
+		if len(c.Social.AuthURL) == 0 {
+			add("social.authURL (SOCIAL_AUTH_URL) is required for the socialAuth twitch backend")
+		}
+	default:
+		add("social.twitchBackend has to be helix, socialAuth or empty, got %q", c.Social.TwitchBackend)
+	}
+
+	if c.Timer.RefreshInterval < 10 || c.Timer.RefreshInterval > 10000 {
+		add("timer.refreshInterval has to be between 10 and 10000 ms, got %v", c.Timer.RefreshInterval)
+	}
+
+	switch c.Log.Level {
+	case "debug", "info", "error":
+	default:
+		add("log.level has to be debug, info or error, got %q", c.Log.Level)
+	}
+
+	if len(errs) != 0 {
+		return errors.New("invalid config:\n  " + strings.Join(errs, "\n  "))
+	}
+
+	return nil
+}
+
+// Twitch returns the twitch backend to use
+func (s SocialConfig) Twitch() string {
+	if len(s.TwitchBackend) != 0 {
+		return s.TwitchBackend
+	}
+	if len(s.AuthURL) != 0 {
+		return "socialAuth"
+	}
+
+	return "helix"
+}
+
+// Model returns the donation config in the format marathons use
+func (d DonationConfig) Model() models.DonationConfig {
+	return models.DonationConfig{
+		Provider:     d.Provider,
+		MarathonSlug: d.MarathonSlug,
+		GDQURL:       d.GDQURL,
+		GDQEventID:   d.GDQEventID,
+		GDQUsername:  d.GDQUsername,
+		GDQPassword:  d.GDQPassword,
+	}
+}
+
+// RestartRequired returns the sections which differ between c and other and can only be applied by a restart.
+// Only the listen address and the storage backend can't be changed while the API is running
+func (c Config) RestartRequired(other Config) []string {
+	var sections []string
+	if c.Server != other.Server {
+		sections = append(sections, "server")
+	}
+	if c.Storage != other.Storage {
+		sections = append(sections, "storage")
+	}
+
+	return sections
+}
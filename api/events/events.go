@@ -0,0 +1,123 @@
+// Package events is the internal event bus. Subsystems publish what happened and others subscribe to it instead of
+// being called directly.
+package events
+
+import (
+	"sync"
+	"time"
+
+	"github.com/onestay/MarathonTools-API/api/models"
+)
+
+// Type is the type of an event
+type Type string
+
+const (
+	// RunSwitched is published after the current run changed. Run is the new current run
+	RunSwitched Type = "runSwitched"
+	// TimerStarted is published when the main timer is started for a run. Run is the current run
+	TimerStarted Type = "timerStarted"
+	// TimerFinished is published when the main timer is finished. Run is the finished run and Time its final time
+	TimerFinished Type = "timerFinished"
+	// DonationMilestone is published when the donation total passes a multiple of the milestone setting
+	DonationMilestone Type = "donationMilestone"
+	// SettingsChanged is published after the settings were saved. Settings are the new settings
+	SettingsChanged Type = "settingsChanged"
+)
+
+// Types are all event types
+var Types = []Type{RunSwitched, TimerStarted, TimerFinished, DonationMilestone, SettingsChanged}
+
+// Valid reports whether t is a known event type
+func (t Type) Valid() bool {
+	for _, e := range Types {
+		if e == t {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Event is something that happened. Which fields are set depends on the type
+type Event struct {
+	Type Type        `json:"type"`
+	At   time.Time   `json:"at"`
+	Run  *models.Run `json:"run,omitempty"`
+	// Time is the final time of the run in seconds
+	Time float64 `json:"time,omitempty"`
+	// Total is the donation total and Milestone the milestone it passed
+	Total     float64          `json:"total,omitempty"`
+	Milestone float64          `json:"milestone,omitempty"`
+	Settings  *models.Settings `json:"settings,omitempty"`
+}
+
+// Handler handles a published event
+type Handler func(Event)
+
+// queueSize is the number of events a subscriber can fall behind before Publish blocks
+const queueSize = 256
+
+// subscriber delivers the events of one handler in the order they were published
+type subscriber struct {
+	h     Handler
+	queue chan Event
+}
+
+func newSubscriber(h Handler) *subscriber {
+	s := &subscriber{h: h, queue: make(chan Event, queueSize)}
+	go s.work()
+
+	return s
+}
+
+// work runs the handler for every queued event, one after the other
+func (s *subscriber) work() {
+	for e := range s.queue {
+		s.h(e)
+	}
+}
+
+// Bus delivers published events to the subscribed handlers. It's safe for concurrent use
+type Bus struct {
+	// mu guards subs and all
+	mu   sync.RWMutex
+	subs map[Type][]*subscriber
+	all  []*subscriber
+}
+
+// NewBus returns a bus without subscribers
+func NewBus() *Bus {
+	return &Bus{subs: make(map[Type][]*subscriber)}
+}
+
+// Subscribe calls h for every event of type t
+func (b *Bus) Subscribe(t Type, h Handler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.subs[t] = append(b.subs[t], newSubscriber(h))
+}
+
+// SubscribeAll calls h for every event
+func (b *Bus) SubscribeAll(h Handler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.all = append(b.all, newSubscriber(h))
+}
+
+// Publish queues e for all subscribers. Every subscriber has its own goroutine which gets the events in the order they
+// were published, so a slow handler doesn't block the publisher or other handlers unless its queue is full
+func (b *Bus) Publish(e Event) {
+	if e.At.IsZero() {
+		e.At = time.Now()
+	}
+
+	// the lock isn't held while queueing since a full queue blocks until its handler is done
+	b.mu.RLock()
+	subs := append(append([]*subscriber{}, b.subs[e.Type]...), b.all...)
+	b.mu.RUnlock()
+
+	for _, s := range subs {
+		s.queue <- e
+	}
+}
@@ -0,0 +1,63 @@
+package events
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPublishKeepsOrder(t *testing.T) {
+	const n = 1000
+	b := NewBus()
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	collect := func(got *[]float64) Handler {
+		return func(e Event) {
+			*got = append(*got, e.Time)
+			if len(*got) == n {
+				wg.Done()
+			}
+		}
+	}
+	var typed, all []float64
+	b.Subscribe(TimerFinished, collect(&typed))
+	b.SubscribeAll(collect(&all))
+
+	for i := 0; i < n; i++ {
+		b.Publish(Event{Type: TimerFinished, Time: float64(i)})
+	}
+	wg.Wait()
+
+	for _, got := range [][]float64{typed, all} {
+		for i, v := range got {
+			if v != float64(i) {
+				t.Fatalf("event %v was delivered at position %v", v, i)
+			}
+		}
+	}
+}
+
+func TestSlowHandlerDoesntBlockOthers(t *testing.T) {
+	b := NewBus()
+	block := make(chan struct{})
+	defer close(block)
+	b.SubscribeAll(func(Event) {
+		<-block
+	})
+
+	got := make(chan Event, 1)
+	b.Subscribe(RunSwitched, func(e Event) {
+		got <- e
+	})
+
+	b.Publish(Event{Type: RunSwitched})
+	select {
+	case e := <-got:
+		if e.At.IsZero() {
+			t.Error("publish didn't set the time of the event")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("a slow handler blocked another subscriber")
+	}
+}
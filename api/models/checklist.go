@@ -0,0 +1,67 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ChecklistItem is a single item of the checklist template. Items without platforms and runs apply to every run
+type ChecklistItem struct {
+	Key         string `json:"key"`
+	Done        bool   `json:"done"`
+	Description string `json:"description,omitempty"`
+	// Assignee is the person responsible for the item
+	Assignee string `json:"assignee,omitempty"`
+	Category string `json:"category,omitempty"`
+	// Optional items don't have to be done for the checklist to be finished
+	Optional bool `json:"optional,omitempty"`
+	// Platforms limits the item to runs on one of the platforms
+	Platforms []string `json:"platforms,omitempty"`
+	// Runs limits the item to the runs with these ids
+	Runs []primitive.ObjectID `json:"runs,omitempty"`
+	// CheckedBy and CheckedAt are set when the item is checked
+	CheckedBy string     `json:"checkedBy,omitempty"`
+	CheckedAt *time.Time `json:"checkedAt,omitempty"`
+}
+
+const (
+	// ChecklistChecked is logged when an item is checked
+	ChecklistChecked = "checked"
+	// ChecklistUnchecked is logged when an item is unchecked
+	ChecklistUnchecked = "unchecked"
+	// ChecklistOverridden is logged when the checklist gate is overridden
+	ChecklistOverridden = "overridden"
+)
+
+// ChecklistLogEntry records who changed the checklist of a run and when
+type ChecklistLogEntry struct {
+	RunID  primitive.ObjectID `json:"runID"`
+	Action string             `json:"action"`
+	// Key is the key of the item. It's empty for overrides
+	Key    string    `json:"key,omitempty"`
+	Reason string    `json:"reason,omitempty"`
+	By     string    `json:"by"`
+	Time   time.Time `json:"time"`
+}
+
+// AppliesTo returns whether the item is part of the checklist for run
+func (i ChecklistItem) AppliesTo(run Run) bool {
+	if len(i.Platforms) == 0 && len(i.Runs) == 0 {
+		return true
+	}
+
+	for _, p := range i.Platforms {
+		if strings.EqualFold(strings.TrimSpace(p), strings.TrimSpace(run.RunInfo.Platform)) {
+			return true
+		}
+	}
+	for _, id := range i.Runs {
+		if id == run.RunID {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,27 @@
+package models
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ParseEstimate parses a duration in the format used for estimates and setup times (hh:mm:ss, mm:ss or ss)
+func ParseEstimate(s string) (time.Duration, error) {
+	parts := strings.Split(strings.TrimSpace(s), ":")
+	if len(parts) > 3 || len(parts[0]) == 0 {
+		return 0, errors.New("invalid estimate " + s)
+	}
+
+	var d time.Duration
+	for _, p := range parts {
+		i, err := strconv.Atoi(p)
+		if err != nil || i < 0 {
+			return 0, errors.New("invalid estimate " + s)
+		}
+		d = d*60 + time.Duration(i)
+	}
+
+	return d * time.Second, nil
+}
@@ -0,0 +1,148 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ScheduleVersion is the schedule after a single change. Every version holds all runs so the schedule can be viewed as
+// of any version and rolled back to it
+type ScheduleVersion struct {
+	Version int       `json:"version" bson:"_id"`
+	Author  string    `json:"author" bson:"author"`
+	Created time.Time `json:"created" bson:"created"`
+	// Action is what created the version, e.g. add, update, delete, move, upload, rollback, setup or twitchCategory
+	Action  string      `json:"action" bson:"action"`
+	Changes []RunChange `json:"changes" bson:"changes"`
+	Runs    []Run       `json:"runs,omitempty" bson:"runs"`
+}
+
+// Types of a RunChange
+const (
+	RunAdded   = "added"
+	RunRemoved = "removed"
+	RunUpdated = "updated"
+	RunMoved   = "moved"
+)
+
+// RunChange describes what happened to a single run between two versions
+type RunChange struct {
+	Type     string             `json:"type" bson:"type"`
+	RunID    primitive.ObjectID `json:"runID" bson:"runID"`
+	GameName string             `json:"gameName" bson:"gameName"`
+	// Fields are the names of the changed fields of an updated run
+	Fields []string `json:"fields,omitempty" bson:"fields,omitempty"`
+}
+
+// DiffRuns returns the changes from the runs in before to the runs in after
+func DiffRuns(before, after []Run) []RunChange {
+	changes := []RunChange{}
+
+	old := make(map[primitive.ObjectID]Run, len(before))
+	for _, r := range before {
+		old[r.RunID] = r
+	}
+	kept := make(map[primitive.ObjectID]bool, len(after))
+	for _, r := range after {
+		kept[r.RunID] = true
+	}
+
+	// runs which are in both schedules in their order before and after
+	var oldOrder, newOrder []primitive.ObjectID
+	for _, r := range before {
+		if !kept[r.RunID] {
+			changes = append(changes, RunChange{Type: RunRemoved, RunID: r.RunID, GameName: r.GameInfo.GameName})
+			continue
+		}
+		oldOrder = append(oldOrder, r.RunID)
+	}
+
+	for _, r := range after {
+		o, ok := old[r.RunID]
+		if !ok {
+			changes = append(changes, RunChange{Type: RunAdded, RunID: r.RunID, GameName: r.GameInfo.GameName})
+			continue
+		}
+		newOrder = append(newOrder, r.RunID)
+
+		if fields := changedFields(o, r); len(fields) != 0 {
+			changes = append(changes, RunChange{Type: RunUpdated, RunID: r.RunID, GameName: r.GameInfo.GameName, Fields: fields})
+		}
+	}
+
+	// every run which isn't part of the longest common order has been moved
+	inOrder := lcs(oldOrder, newOrder)
+	for _, r := range after {
+		if _, ok := old[r.RunID]; ok && !inOrder[r.RunID] {
+			changes = append(changes, RunChange{Type: RunMoved, RunID: r.RunID, GameName: r.GameInfo.GameName})
+		}
+	}
+
+	return changes
+}
+
+// changedFields compares the json representation of the runs and returns the names of the top level fields which differ
+func changedFields(a, b Run) []string {
+	var ma, mb map[string]json.RawMessage
+	ja, _ := json.Marshal(a)
+	jb, _ := json.Marshal(b)
+	json.Unmarshal(ja, &ma)
+	json.Unmarshal(jb, &mb)
+
+	// the version changes with every update so it isn't a change of its own
+	delete(ma, "version")
+	delete(mb, "version")
+
+	var fields []string
+	for k, v := range mb {
+		if !bytes.Equal(ma[k], v) {
+			fields = append(fields, k)
+		}
+	}
+	for k := range ma {
+		if _, ok := mb[k]; !ok {
+			fields = append(fields, k)
+		}
+	}
+	sort.Strings(fields)
+
+	return fields
+}
+
+// lcs returns the ids which are part of the longest common subsequence of a and b
+func lcs(a, b []primitive.ObjectID) map[primitive.ObjectID]bool {
+	l := make([][]int, len(a)+1)
+	for i := range l {
+		l[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				l[i][j] = l[i+1][j+1] + 1
+			} else if l[i+1][j] >= l[i][j+1] {
+				l[i][j] = l[i+1][j]
+			} else {
+				l[i][j] = l[i][j+1]
+			}
+		}
+	}
+
+	res := make(map[primitive.ObjectID]bool)
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		if a[i] == b[j] {
+			res[a[i]] = true
+			i++
+			j++
+		} else if l[i+1][j] >= l[i][j+1] {
+			i++
+		} else {
+			j++
+		}
+	}
+
+	return res
+}
@@ -0,0 +1,28 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Person is a commentator or host
+type Person struct {
+	DisplayName string `json:"displayName" bson:"displayName"`
+	Pronouns    string `json:"pronouns,omitempty" bson:"pronouns,omitempty"`
+	TwitchName  string `json:"twitchName,omitempty" bson:"twitchName,omitempty"`
+	TwitterName string `json:"twitterName,omitempty" bson:"twitterName,omitempty"`
+}
+
+// HostSlot is a single shift of the host rotation. The rotation is independent of the runs
+type HostSlot struct {
+	ID    primitive.ObjectID `json:"id" bson:"_id"`
+	Host  Person             `json:"host" bson:"host"`
+	Start time.Time          `json:"start" bson:"start"`
+	End   time.Time          `json:"end" bson:"end"`
+}
+
+// Covers reports whether t is within the slot
+func (h HostSlot) Covers(t time.Time) bool {
+	return !t.Before(h.Start) && t.Before(h.End)
+}
@@ -1,10 +1,37 @@
 package models
 
-// Marathon represents the general Marathon
+import "time"
+
+// Marathon represents a single event. Every marathon has its own runs, settings, checklist, social templates and
+// donation provider
 type Marathon struct {
-	Name       string `json:"name" bson:"name"`
-	Runs       []Run  `json:"runs" bson:"runs"`
-	RunCount   int    `json:"runCount" bson:"runCount"`
-	CurrentRun string `json:"currentRun" bson:"currentRun"`
-	IsRunning  bool   `bson:"isRunning"`
+	ID       string    `json:"id" bson:"_id"`
+	Name     string    `json:"name" bson:"name"`
+	Active   bool      `json:"active" bson:"active"`
+	Archived bool      `json:"archived" bson:"archived"`
+	Created  time.Time `json:"created" bson:"created"`
+	// Start is the planned start of the first run. It's used to calculate the start times of all runs
+	Start     time.Time      `json:"start,omitempty" bson:"start,omitempty"`
+	Donations DonationConfig `json:"donations" bson:"donations"`
+}
+
+// DonationConfig configures the donation provider of a marathon. If no provider is set the one configured for the
+// API is used
+type DonationConfig struct {
+	// Provider is either gdq, srcom or empty
+	Provider     string `json:"provider,omitempty" bson:"provider,omitempty"`
+	MarathonSlug string `json:"marathonSlug,omitempty" bson:"marathonSlug,omitempty"`
+	GDQURL       string `json:"gdqURL,omitempty" bson:"gdqURL,omitempty"`
+	GDQEventID   string `json:"gdqEventID,omitempty" bson:"gdqEventID,omitempty"`
+	GDQUsername  string `json:"gdqUsername,omitempty" bson:"gdqUsername,omitempty"`
+	GDQPassword  string `json:"gdqPassword,omitempty" bson:"gdqPassword,omitempty"`
+}
+
+// Public returns a copy of the marathon without credentials so it can be sent to clients
+func (m Marathon) Public() Marathon {
+	if m.Donations.GDQPassword != "" {
+		m.Donations.GDQPassword = "********"
+	}
+
+	return m
 }
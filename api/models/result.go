@@ -0,0 +1,16 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// RunResult is the result of a run which is saved once the timer is finished
+type RunResult struct {
+	RunID    primitive.ObjectID `json:"runID" bson:"_id"`
+	Time     float64            `json:"time" bson:"time"`
+	Players  []PlayerInfo       `json:"players" bson:"players"`
+	Teams    []TeamResult       `json:"teams,omitempty" bson:"teams,omitempty"`
+	Finished time.Time          `json:"finished" bson:"finished"`
+}
@@ -1,38 +1,132 @@
 package models
 
 import (
-	"gopkg.in/mgo.v2/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 // Run represents a single run
 type Run struct {
-	RunID    bson.ObjectId `json:"runID" bson:"_id"`
-	GameInfo GameInfo      `json:"gameInfo" bson:"gameInfo"`
-	RunInfo  runInfo       `json:"runInfo" bson:"runInfo"`
-	Players  []PlayerInfo  `json:"players" bson:"playerInfo"`
+	RunID    primitive.ObjectID `json:"runID" bson:"_id"`
+	GameInfo GameInfo           `json:"gameInfo" bson:"gameInfo"`
+	RunInfo  runInfo            `json:"runInfo" bson:"runInfo"`
+	Players  []PlayerInfo       `json:"players" bson:"playerInfo"`
+	Teams    []Team             `json:"teams,omitempty" bson:"teams,omitempty"`
+	// Commentators are the people commentating the run
+	Commentators []Person `json:"commentators,omitempty" bson:"commentators,omitempty"`
+	// SetupResult is set once the setup before this run is done
+	SetupResult *SetupResult `json:"setupResult,omitempty" bson:"setupResult,omitempty"`
+	// Version is incremented on every update. It's used to detect concurrent edits
+	Version int `json:"version" bson:"version"`
 }
 
 type GameInfo struct {
 	GameName    string `json:"gameName" bson:"gameName"`
 	ReleaseYear int    `json:"releaseYear" bson:"releaseYear"`
+	// Twitch is the twitch category of the game. It's set to override the game name or once the category was resolved
+	Twitch *TwitchCategory `json:"twitch,omitempty" bson:"twitch,omitempty"`
+}
+
+// TwitchCategory is a twitch category. ID is empty until the name was resolved
+type TwitchCategory struct {
+	ID   string `json:"id,omitempty" bson:"id,omitempty"`
+	Name string `json:"name" bson:"name"`
+	// BoxArtURL is only set in search results
+	BoxArtURL string `json:"boxArtURL,omitempty" bson:"-"`
+	// ResolvedFrom is the game name the category was resolved from automatically. It's empty for overrides
+	ResolvedFrom string `json:"resolvedFrom,omitempty" bson:"resolvedFrom,omitempty"`
+}
+
+// TwitchCategory returns the twitch category of the run. Without an override the category is the game name. A
+// category resolved from a different game name than the current one is ignored
+func (r Run) TwitchCategory() TwitchCategory {
+	c := TwitchCategory{Name: r.GameInfo.GameName}
+	if r.GameInfo.Twitch != nil && !r.staleTwitchCategory() {
+		c = *r.GameInfo.Twitch
+		if len(c.Name) == 0 {
+			c.Name = r.GameInfo.GameName
+		}
+	}
+
+	return c
+}
+
+// TwitchOverride reports whether the twitch category was set by a user instead of being resolved from the game name
+func (r Run) TwitchOverride() bool {
+	return r.GameInfo.Twitch != nil && len(r.GameInfo.Twitch.ResolvedFrom) == 0
+}
+
+func (r Run) staleTwitchCategory() bool {
+	t := r.GameInfo.Twitch
+	return t != nil && len(t.ResolvedFrom) != 0 && t.ResolvedFrom != r.GameInfo.GameName
+}
+
+// ClearStaleTwitchCategory removes the twitch category if it was resolved from a game name which has been changed since.
+// Overrides are kept
+func (r *Run) ClearStaleTwitchCategory() {
+	if r.staleTwitchCategory() {
+		r.GameInfo.Twitch = nil
+	}
 }
 
 type runInfo struct {
 	Estimate string `json:"estimate" bson:"estimate"`
 	Category string `json:"category" bson:"category"`
 	Platform string `json:"platform" bso:"platform"`
+	// Setup is the planned setup time before the run in the same format as the estimate
+	Setup string `json:"setup" bson:"setup"`
+}
+
+// SetupResult holds the actual and planned setup time before a run in seconds
+type SetupResult struct {
+	Planned    float64 `json:"planned" bson:"planned"`
+	Actual     float64 `json:"actual" bson:"actual"`
+	Difference float64 `json:"difference" bson:"difference"`
 }
 
+// PlayerInfo is a player of a run. The profile fields are copies of the runner with RunnerID from the runner directory
 type PlayerInfo struct {
-	DisplayName string          `json:"displayName" bson:"displayName"`
-	Country     string          `json:"country" bson:"country"`
-	TwitterName string          `json:"twitterName" bson:"twitterName"`
-	TwitchName  string          `json:"twitchName" bson:"twitchName"`
-	YoutubeName string          `json:"youtubeName" bson:"youtubeName"`
-	Timer       timerPlayerInfo `json:"timer" bson:"timer"`
+	RunnerID    primitive.ObjectID `json:"runnerID,omitempty" bson:"runnerID,omitempty"`
+	DisplayName string             `json:"displayName" bson:"displayName"`
+	Pronouns    string             `json:"pronouns,omitempty" bson:"pronouns,omitempty"`
+	Country     string             `json:"country" bson:"country"`
+	TwitterName string             `json:"twitterName" bson:"twitterName"`
+	TwitchName  string             `json:"twitchName" bson:"twitchName"`
+	YoutubeName string             `json:"youtubeName" bson:"youtubeName"`
+	AvatarURL   string             `json:"avatarURL,omitempty" bson:"avatarURL,omitempty"`
+	Timer       timerPlayerInfo    `json:"timer" bson:"timer"`
 }
 
 type timerPlayerInfo struct {
 	Finished bool    `json:"finished" bson:"finished"`
 	Time     float64 `json:"time" bson:"time"`
 }
+
+// Copy returns a deep copy of the run
+func (r Run) Copy() Run {
+	if r.Players != nil {
+		players := make([]PlayerInfo, len(r.Players))
+		copy(players, r.Players)
+		r.Players = players
+	}
+	if r.Teams != nil {
+		teams := make([]Team, len(r.Teams))
+		for i, t := range r.Teams {
+			teams[i] = t
+			teams[i].Members = append([]int(nil), t.Members...)
+		}
+		r.Teams = teams
+	}
+	if r.Commentators != nil {
+		r.Commentators = append([]Person(nil), r.Commentators...)
+	}
+	if r.SetupResult != nil {
+		res := *r.SetupResult
+		r.SetupResult = &res
+	}
+	if r.GameInfo.Twitch != nil {
+		t := *r.GameInfo.Twitch
+		r.GameInfo.Twitch = &t
+	}
+
+	return r
+}
@@ -0,0 +1,35 @@
+package models
+
+import "testing"
+
+func TestTwitchCategory(t *testing.T) {
+	tests := []struct {
+		name     string
+		game     string
+		twitch   *TwitchCategory
+		want     TwitchCategory
+		override bool
+		cleared  bool
+	}{
+		{"game name", "Celeste", nil, TwitchCategory{Name: "Celeste"}, false, false},
+		{"resolved", "Celeste", &TwitchCategory{ID: "1", Name: "Celeste", ResolvedFrom: "Celeste"}, TwitchCategory{ID: "1", Name: "Celeste", ResolvedFrom: "Celeste"}, false, false},
+		{"game name changed", "Celeste 64", &TwitchCategory{ID: "1", Name: "Celeste", ResolvedFrom: "Celeste"}, TwitchCategory{Name: "Celeste 64"}, false, true},
+		{"override", "Celeste 64", &TwitchCategory{ID: "2", Name: "Retro"}, TwitchCategory{ID: "2", Name: "Retro"}, true, false},
+		{"override without name", "Celeste", &TwitchCategory{ID: "2"}, TwitchCategory{ID: "2", Name: "Celeste"}, true, false},
+	}
+
+	for _, tt := range tests {
+		r := Run{GameInfo: GameInfo{GameName: tt.game, Twitch: tt.twitch}}
+		if got := r.TwitchCategory(); got != tt.want {
+			t.Errorf("%v: category %+v, want %+v", tt.name, got, tt.want)
+		}
+		if got := r.TwitchOverride(); got != tt.override {
+			t.Errorf("%v: override %v, want %v", tt.name, got, tt.override)
+		}
+
+		r.ClearStaleTwitchCategory()
+		if cleared := tt.twitch != nil && r.GameInfo.Twitch == nil; cleared != tt.cleared {
+			t.Errorf("%v: cleared %v, want %v", tt.name, cleared, tt.cleared)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package models
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+// Runner is a profile in the runner directory. Runs reference runners through PlayerInfo.RunnerID
+type Runner struct {
+	ID          primitive.ObjectID `json:"id" bson:"_id"`
+	DisplayName string             `json:"displayName" bson:"displayName"`
+	Pronouns    string             `json:"pronouns,omitempty" bson:"pronouns,omitempty"`
+	Country     string             `json:"country,omitempty" bson:"country,omitempty"`
+	TwitterName string             `json:"twitterName,omitempty" bson:"twitterName,omitempty"`
+	TwitchName  string             `json:"twitchName,omitempty" bson:"twitchName,omitempty"`
+	YoutubeName string             `json:"youtubeName,omitempty" bson:"youtubeName,omitempty"`
+	AvatarURL   string             `json:"avatarURL,omitempty" bson:"avatarURL,omitempty"`
+}
+
+// RunnerFromPlayer creates a new runner from the profile fields of an embedded player
+func RunnerFromPlayer(p PlayerInfo) Runner {
+	return Runner{
+		ID:          primitive.NewObjectID(),
+		DisplayName: p.DisplayName,
+		Pronouns:    p.Pronouns,
+		Country:     p.Country,
+		TwitterName: p.TwitterName,
+		TwitchName:  p.TwitchName,
+		YoutubeName: p.YoutubeName,
+		AvatarURL:   p.AvatarURL,
+	}
+}
+
+// Differs returns the json names of the profile fields of the player which are set to something else than in the
+// runner. Empty fields aren't compared since they are filled from the runner
+func (r Runner) Differs(p PlayerInfo) []string {
+	var fields []string
+	for _, f := range []struct {
+		name          string
+		runner, value string
+	}{
+		{"displayName", r.DisplayName, p.DisplayName},
+		{"pronouns", r.Pronouns, p.Pronouns},
+		{"country", r.Country, p.Country},
+		{"twitterName", r.TwitterName, p.TwitterName},
+		{"twitchName", r.TwitchName, p.TwitchName},
+		{"youtubeName", r.YoutubeName, p.YoutubeName},
+		{"avatarURL", r.AvatarURL, p.AvatarURL},
+	} {
+		if len(f.value) != 0 && f.value != f.runner {
+			fields = append(fields, f.name)
+		}
+	}
+
+	return fields
+}
+
+// Apply copies the profile of the runner into the player. It reports whether the player changed
+func (r Runner) Apply(p *PlayerInfo) bool {
+	before := *p
+	p.RunnerID = r.ID
+	p.DisplayName = r.DisplayName
+	p.Pronouns = r.Pronouns
+	p.Country = r.Country
+	p.TwitterName = r.TwitterName
+	p.TwitchName = r.TwitchName
+	p.YoutubeName = r.YoutubeName
+	p.AvatarURL = r.AvatarURL
+
+	return before != *p
+}
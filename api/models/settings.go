@@ -0,0 +1,296 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+// Settings are the settings of a marathon grouped by the part of the API they belong to
+type Settings struct {
+	General   GeneralSettings   `json:"general"`
+	Twitch    TwitchChannels    `json:"twitch"`
+	Social    SocialSettings    `json:"social"`
+	Checklist ChecklistSettings `json:"checklist"`
+	Donations DonationSettings  `json:"donations"`
+	ChatBot   ChatBotSettings   `json:"chatBot"`
+}
+
+// GeneralSettings are settings used by all layouts
+type GeneralSettings struct {
+	Currency string `json:"currency"`
+}
+
+// TwitchChannels are the twitch channels used by the marathon
+type TwitchChannels struct {
+	// Chat is the channel whose chat is shown in layouts
+	Chat string `json:"chat"`
+	// UpdateChannel is the channel whose title and game are updated on run switches
+	UpdateChannel string `json:"updateChannel"`
+}
+
+// SocialSettings configure the social media circle in layouts
+type SocialSettings struct {
+	// CircleTime is how long every social media account is shown in milliseconds
+	CircleTime int `json:"circleTime"`
+}
+
+// ChecklistSettings configure the checklist
+type ChecklistSettings struct {
+	// Gate refuses to start the timer or switch runs while required checklist items aren't done
+	Gate bool `json:"gate"`
+}
+
+// DonationSettings configure the donation updates
+type DonationSettings struct {
+	// Milestone publishes a donation milestone every time the total passes a multiple of it. 0 disables milestones
+	Milestone int `json:"milestone"`
+}
+
+// ChatBotSettings configure the bot in the chat of twitch.chat
+type ChatBotSettings struct {
+	// Enabled connects the bot to the chat
+	Enabled bool `json:"enabled"`
+	// RunMessage is posted on every run switch. It's a template with the same fields as the twitch title. Empty
+	// disables it
+	RunMessage string `json:"runMessage"`
+	// Commands makes the bot answer !runner, !schedule, !total and !incentive
+	Commands bool `json:"commands"`
+	// Incentive is the answer to !incentive
+	Incentive string `json:"incentive"`
+}
+
+// Reached returns the milestone passed when the total went from old to new or 0 if none was passed
+func (d DonationSettings) Reached(old, new float64) float64 {
+	if d.Milestone <= 0 {
+		return 0
+	}
+	step := float64(d.Milestone)
+	if m := math.Floor(new/step) * step; m > old {
+		return m
+	}
+
+	return 0
+}
+
+// DefaultSettings returns the settings of a new marathon
+func DefaultSettings() Settings {
+	return Settings{
+		General: GeneralSettings{
+			Currency: "$",
+		},
+		Twitch: TwitchChannels{
+			Chat: "onestay",
+		},
+		Social: SocialSettings{
+			CircleTime: 30000,
+		},
+		ChatBot: ChatBotSettings{
+			RunMessage: "Now running: {{.Game}} ({{.Category}}) by {{range $i, $r := .Runner}}{{if $i}}, {{end}}{{$r.DisplayName}}{{end}}",
+			Commands:   true,
+		},
+	}
+}
+
+// UnmarshalJSON decodes settings on top of the defaults so missing settings keep their default value.
+// It also accepts the flat format settings were saved in before they were grouped
+func (s *Settings) UnmarshalJSON(data []byte) error {
+	type settings Settings
+	res := settings(DefaultSettings())
+	if err := json.Unmarshal(data, &res); err != nil {
+		return err
+	}
+
+	var legacy struct {
+		Currency            *string `json:"currency"`
+		Chat                *string `json:"chat"`
+		SocialCircleTime    *int    `json:"socialCircleTime"`
+		TwitchUpdateChannel *string `json:"twitchUpdateChannel"`
+		ChecklistGate       *bool   `json:"checklistGate"`
+	}
+	if err := json.Unmarshal(data, &legacy); err != nil {
+		return err
+	}
+	if legacy.Currency != nil {
+		res.General.Currency = *legacy.Currency
+	}
+	if legacy.Chat != nil {
+		res.Twitch.Chat = *legacy.Chat
+	}
+	if legacy.SocialCircleTime != nil {
+		res.Social.CircleTime = *legacy.SocialCircleTime
+	}
+	if legacy.TwitchUpdateChannel != nil {
+		res.Twitch.UpdateChannel = *legacy.TwitchUpdateChannel
+	}
+	if legacy.ChecklistGate != nil {
+		res.Checklist.Gate = *legacy.ChecklistGate
+	}
+
+	*s = Settings(res)
+	return nil
+}
+
+// SettingSchema describes a single setting so admin interfaces can be generated from it
+type SettingSchema struct {
+	// Key is the json path of the setting, e.g. general.currency
+	Key         string      `json:"key"`
+	Group       string      `json:"group"`
+	Type        string      `json:"type"`
+	Title       string      `json:"title"`
+	Description string      `json:"description"`
+	Default     interface{} `json:"default"`
+	Required    bool        `json:"required,omitempty"`
+	Min         *int        `json:"min,omitempty"`
+	Max         *int        `json:"max,omitempty"`
+	MaxLength   int         `json:"maxLength,omitempty"`
+	Pattern     string      `json:"pattern,omitempty"`
+}
+
+const (
+	maxCurrencyLength = 5
+	minCircleTime     = 1000
+	maxCircleTime     = 600000
+	// MaxChatMessageLength is the limit of twitch chat messages
+	MaxChatMessageLength = 500
+)
+
+var twitchLoginRe = regexp.MustCompile(`^[a-zA-Z0-9_]{0,25}$`)
+
+// SettingsSchema returns the description of all settings
+func SettingsSchema() []SettingSchema {
+	d := DefaultSettings()
+	min, max, zero := minCircleTime, maxCircleTime, 0
+
+	return []SettingSchema{
+		{
+			Key:         "general.currency",
+			Group:       "general",
+			Type:        "string",
+			Title:       "Currency",
+			Description: "Symbol shown in front of donation amounts",
+			Default:     d.General.Currency,
+			Required:    true,
+			MaxLength:   maxCurrencyLength,
+		},
+		{
+			Key:         "twitch.chat",
+			Group:       "twitch",
+			Type:        "string",
+			Title:       "Chat channel",
+			Description: "Twitch channel whose chat is shown in layouts",
+			Default:     d.Twitch.Chat,
+			Pattern:     twitchLoginRe.String(),
+		},
+		{
+			Key:         "twitch.updateChannel",
+			Group:       "twitch",
+			Type:        "string",
+			Title:       "Update channel",
+			Description: "Twitch channel whose title and game are updated when the run is switched",
+			Default:     d.Twitch.UpdateChannel,
+			Pattern:     twitchLoginRe.String(),
+		},
+		{
+			Key:         "social.circleTime",
+			Group:       "social",
+			Type:        "integer",
+			Title:       "Social circle time",
+			Description: "Milliseconds every social media account is shown in layouts",
+			Default:     d.Social.CircleTime,
+			Required:    true,
+			Min:         &min,
+			Max:         &max,
+		},
+		{
+			Key:         "checklist.gate",
+			Group:       "checklist",
+			Type:        "boolean",
+			Title:       "Checklist gate",
+			Description: "Refuse to start the timer or switch runs while required checklist items aren't done",
+			Default:     d.Checklist.Gate,
+		},
+		{
+			Key:         "donations.milestone",
+			Group:       "donations",
+			Type:        "integer",
+			Title:       "Donation milestone",
+			Description: "Publish a donation milestone every time the total passes a multiple of this amount. 0 disables milestones",
+			Default:     d.Donations.Milestone,
+			Min:         &zero,
+		},
+		{
+			Key:         "chatBot.enabled",
+			Group:       "chatBot",
+			Type:        "boolean",
+			Title:       "Chat bot",
+			Description: "Connect the chat bot to the chat channel. Twitch has to be authorized with the helix backend",
+			Default:     d.ChatBot.Enabled,
+		},
+		{
+			Key:         "chatBot.runMessage",
+			Group:       "chatBot",
+			Type:        "string",
+			Title:       "Run message",
+			Description: "Message posted on every run switch. It's a template with the same fields as the twitch title. Empty disables it",
+			Default:     d.ChatBot.RunMessage,
+			MaxLength:   MaxChatMessageLength,
+		},
+		{
+			Key:         "chatBot.commands",
+			Group:       "chatBot",
+			Type:        "boolean",
+			Title:       "Chat commands",
+			Description: "Answer !runner, !schedule, !total and !incentive",
+			Default:     d.ChatBot.Commands,
+		},
+		{
+			Key:         "chatBot.incentive",
+			Group:       "chatBot",
+			Type:        "string",
+			Title:       "Incentive",
+			Description: "Answer to !incentive",
+			Default:     d.ChatBot.Incentive,
+			MaxLength:   MaxChatMessageLength,
+		},
+	}
+}
+
+// Validate checks the settings against the limits of the schema. It returns nil if they are valid
+func (s Settings) Validate() []FieldError {
+	var errs []FieldError
+	add := func(field, format string, a ...interface{}) {
+		errs = append(errs, FieldError{Field: field, Message: fmt.Sprintf(format, a...)})
+	}
+
+	if c := strings.TrimSpace(s.General.Currency); len(c) == 0 {
+		add("general.currency", "currency is required")
+	} else if len([]rune(c)) > maxCurrencyLength {
+		add("general.currency", "currency can't be longer than %v characters", maxCurrencyLength)
+	}
+	if !twitchLoginRe.MatchString(s.Twitch.Chat) {
+		add("twitch.chat", "%v isn't a valid twitch channel", s.Twitch.Chat)
+	}
+	if !twitchLoginRe.MatchString(s.Twitch.UpdateChannel) {
+		add("twitch.updateChannel", "%v isn't a valid twitch channel", s.Twitch.UpdateChannel)
+	}
+	if s.Social.CircleTime < minCircleTime || s.Social.CircleTime > maxCircleTime {
+		add("social.circleTime", "circle time has to be between %v and %v", minCircleTime, maxCircleTime)
+	}
+	if s.Donations.Milestone < 0 {
+		add("donations.milestone", "milestone can't be negative")
+	}
+	if len([]rune(s.ChatBot.RunMessage)) > MaxChatMessageLength {
+		add("chatBot.runMessage", "run message can't be longer than %v characters", MaxChatMessageLength)
+	} else if _, err := template.New("run").Parse(s.ChatBot.RunMessage); err != nil {
+		add("chatBot.runMessage", "run message isn't a valid template: %v", err)
+	}
+	if len([]rune(s.ChatBot.Incentive)) > MaxChatMessageLength {
+		add("chatBot.incentive", "incentive can't be longer than %v characters", MaxChatMessageLength)
+	}
+
+	return errs
+}
@@ -0,0 +1,80 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// TwitchSettings defines the settings for twitch integration
+type TwitchSettings struct {
+	Update         bool   `json:"update"`
+	Viewers        bool   `json:"viewers"`
+	TemplateString string `json:"templateString"`
+}
+
+// TwitchToken is the oauth token of the twitch account the API acts as
+type TwitchToken struct {
+	AccessToken  string    `json:"accessToken"`
+	RefreshToken string    `json:"refreshToken"`
+	Expires      time.Time `json:"expires"`
+	Scope        []string  `json:"scope"`
+	// UserID and Login belong to the account which authorized the API
+	UserID string `json:"userID"`
+	Login  string `json:"login"`
+}
+
+// VODMarker is the position of a run in the VOD of the stream. It's recorded on run switches, timer starts and timer
+// finishes
+type VODMarker struct {
+	// Event is the type of the event the marker was recorded for, e.g. runSwitched
+	Event string             `json:"event"`
+	RunID primitive.ObjectID `json:"runID"`
+	// Title is the name of the run
+	Title string    `json:"title"`
+	At    time.Time `json:"at"`
+	// StreamStart is when the stream started. It's the time of the first marker of the stream if twitch couldn't be
+	// asked
+	StreamStart time.Time `json:"streamStart"`
+	// Offset is the position in the VOD in seconds
+	Offset float64 `json:"offset"`
+	// TwitchID is the id of the twitch stream marker. It's empty if no marker could be created and Error says why
+	TwitchID string `json:"twitchID,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// TwitterSettings contains the settings for Twitter
+type TwitterSettings struct {
+	SendTweets bool `json:"sendTweets"`
+}
+
+// TwitterTemplate is a template for a tweet sent at the start of a run
+type TwitterTemplate struct {
+	Text        string              `json:"text,omitempty"`
+	ForMultiple bool                `json:"forMultiple,omitempty"`
+	ForRun      *primitive.ObjectID `json:"forRun,omitempty"`
+}
+
+// AutomationRule runs an action every time an event of a type is published
+type AutomationRule struct {
+	// Event is the type of the event, e.g. runSwitched
+	Event string `json:"event"`
+	// Action is the name of a registered action, e.g. twitch.updateInfo
+	Action  string `json:"action"`
+	Enabled bool   `json:"enabled"`
+	// New is set on default rules which were added after the rules had been saved. They stay disabled until enabled
+	New bool `json:"new,omitempty"`
+}
+
+// DefaultAutomationRules are the rules of a marathon which hasn't saved its own. They do what was done on every run
+// switch before rules could be configured
+func DefaultAutomationRules() []AutomationRule {
+	return []AutomationRule{
+		{Event: "runSwitched", Action: "twitch.updateInfo", Enabled: true},
+		{Event: "runSwitched", Action: "twitter.sendUpdate", Enabled: true},
+		{Event: "runSwitched", Action: "twitch.featuredChannels", Enabled: true},
+		{Event: "runSwitched", Action: "twitch.marker", Enabled: true},
+		{Event: "timerStarted", Action: "twitch.marker", Enabled: true},
+		{Event: "timerFinished", Action: "twitch.marker", Enabled: true},
+	}
+}
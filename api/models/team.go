@@ -0,0 +1,114 @@
+package models
+
+import "sort"
+
+const (
+	// TeamFinishAll means a team is finished once every member has finished, e.g. for co-op races
+	TeamFinishAll = "all"
+	// TeamFinishLast means a team is finished once its last member has finished, e.g. for relay races
+	TeamFinishLast = "last"
+)
+
+// Team represents a team in a race. Members are the indices of the players in Run.Players belonging to the team
+type Team struct {
+	Name       string          `json:"name" bson:"name"`
+	Color      string          `json:"color" bson:"color"`
+	Members    []int           `json:"members" bson:"members"`
+	FinishMode string          `json:"finishMode" bson:"finishMode"`
+	Timer      timerPlayerInfo `json:"timer" bson:"timer"`
+}
+
+// TeamResult is the result of a single team in a run
+type TeamResult struct {
+	Place    int     `json:"place" bson:"place"`
+	Name     string  `json:"name" bson:"name"`
+	Color    string  `json:"color" bson:"color"`
+	Finished bool    `json:"finished" bson:"finished"`
+	Time     float64 `json:"time" bson:"time"`
+}
+
+// TeamPlayers returns the players of the team with index i
+func (r *Run) TeamPlayers(i int) []PlayerInfo {
+	players := make([]PlayerInfo, 0, len(r.Teams[i].Members))
+	for _, m := range r.Teams[i].Members {
+		if m >= 0 && m < len(r.Players) {
+			players = append(players, r.Players[m])
+		}
+	}
+
+	return players
+}
+
+// PlayerTeam returns the index of the team the player with index p belongs to or -1 if the player isn't in a team
+func (r *Run) PlayerTeam(p int) int {
+	for i, t := range r.Teams {
+		for _, m := range t.Members {
+			if m == p {
+				return i
+			}
+		}
+	}
+
+	return -1
+}
+
+// TeamDone checks whether the team with index i is done based on its finish mode
+func (r *Run) TeamDone(i int) bool {
+	t := r.Teams[i]
+	if len(t.Members) == 0 {
+		return false
+	}
+
+	if t.FinishMode == TeamFinishLast {
+		last := t.Members[len(t.Members)-1]
+		return last >= 0 && last < len(r.Players) && r.Players[last].Timer.Finished
+	}
+
+	for _, m := range t.Members {
+		if m < 0 || m >= len(r.Players) || !r.Players[m].Timer.Finished {
+			return false
+		}
+	}
+
+	return true
+}
+
+// TeamResults returns the results of all teams ordered by their time. Teams which haven't finished are placed last
+func (r *Run) TeamResults() []TeamResult {
+	res := make([]TeamResult, len(r.Teams))
+	for i, t := range r.Teams {
+		res[i] = TeamResult{
+			Name:     t.Name,
+			Color:    t.Color,
+			Finished: t.Timer.Finished,
+			Time:     t.Timer.Time,
+		}
+	}
+
+	sort.SliceStable(res, func(i, j int) bool {
+		if res[i].Finished != res[j].Finished {
+			return res[i].Finished
+		}
+		return res[i].Time < res[j].Time
+	})
+
+	for i := range res {
+		if res[i].Finished {
+			res[i].Place = i + 1
+		}
+	}
+
+	return res
+}
+
+// ResetTimers resets the timer info of all players and teams
+func (r *Run) ResetTimers() {
+	for i := range r.Players {
+		r.Players[i].Timer.Finished = false
+		r.Players[i].Timer.Time = 0
+	}
+	for i := range r.Teams {
+		r.Teams[i].Timer.Finished = false
+		r.Teams[i].Timer.Time = 0
+	}
+}
@@ -0,0 +1,122 @@
+package models
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// MaxPlayers is the maximum number of players a run can have
+const MaxPlayers = 8
+
+// FieldError is a validation error of a single field. Field is the json path of the field, e.g. players[0].country
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// RunErrors are the validation errors of a run in a list of runs
+type RunErrors struct {
+	Index  int          `json:"index"`
+	Game   string       `json:"game,omitempty"`
+	Fields []FieldError `json:"fields"`
+}
+
+// Validate checks the run for missing or malformed fields. It returns nil if the run is valid
+func (r Run) Validate() []FieldError {
+	var errs []FieldError
+	add := func(field, format string, a ...interface{}) {
+		errs = append(errs, FieldError{Field: field, Message: fmt.Sprintf(format, a...)})
+	}
+
+	if len(strings.TrimSpace(r.GameInfo.GameName)) == 0 {
+		add("gameInfo.gameName", "game name is required")
+	}
+
+	if len(strings.TrimSpace(r.RunInfo.Estimate)) == 0 {
+		add("runInfo.estimate", "estimate is required")
+	} else if _, err := ParseEstimate(r.RunInfo.Estimate); err != nil {
+		add("runInfo.estimate", "estimate has to be in the format hh:mm:ss")
+	}
+	if len(strings.TrimSpace(r.RunInfo.Setup)) != 0 {
+		if _, err := ParseEstimate(r.RunInfo.Setup); err != nil {
+			add("runInfo.setup", "setup has to be in the format hh:mm:ss")
+		}
+	}
+
+	if len(r.Players) == 0 {
+		add("players", "at least one player is required")
+	} else if len(r.Players) > MaxPlayers {
+		add("players", "a run can't have more than %v players", MaxPlayers)
+	}
+	for i, p := range r.Players {
+		if len(strings.TrimSpace(p.DisplayName)) == 0 {
+			add(fmt.Sprintf("players[%v].displayName", i), "display name is required")
+		}
+		if len(p.Country) != 0 && !ValidCountry(p.Country) {
+			add(fmt.Sprintf("players[%v].country", i), "%v is not an ISO 3166-1 alpha-2 country code", p.Country)
+		}
+	}
+
+	for i, t := range r.Teams {
+		for j, m := range t.Members {
+			if m < 0 || m >= len(r.Players) {
+				add(fmt.Sprintf("teams[%v].members[%v]", i, j), "player %v doesn't exist", m)
+			}
+		}
+	}
+
+	return errs
+}
+
+// ValidCountry checks whether c is an ISO 3166-1 alpha-2 country code. The case is ignored
+func ValidCountry(c string) bool {
+	return countries[strings.ToUpper(c)]
+}
+
+// FindDuplicate returns the index of a run in runs with the same game, category and players as run or -1 if there is
+// none. A run with the same id as run isn't a duplicate
+func FindDuplicate(run Run, runs []Run) int {
+	key := run.duplicateKey()
+	for i, r := range runs {
+		if r.RunID == run.RunID && !r.RunID.IsZero() {
+			continue
+		}
+		if r.duplicateKey() == key {
+			return i
+		}
+	}
+
+	return -1
+}
+
+func (r Run) duplicateKey() string {
+	players := make([]string, len(r.Players))
+	for i, p := range r.Players {
+		players[i] = strings.ToLower(strings.TrimSpace(p.DisplayName))
+	}
+	sort.Strings(players)
+
+	return strings.Join([]string{
+		strings.ToLower(strings.TrimSpace(r.GameInfo.GameName)),
+		strings.ToLower(strings.TrimSpace(r.RunInfo.Category)),
+		strings.Join(players, "\x00"),
+	}, "\x01")
+}
+
+// ValidateRuns validates a whole schedule. Besides the errors of every run it reports runs which are duplicates of
+// an earlier run in the list
+func ValidateRuns(runs []Run) []RunErrors {
+	res := []RunErrors{}
+	for i, run := range runs {
+		errs := run.Validate()
+		if d := FindDuplicate(run, runs[:i]); d != -1 {
+			errs = append(errs, FieldError{Field: "run", Message: fmt.Sprintf("duplicate of run %v", d)})
+		}
+		if len(errs) != 0 {
+			res = append(res, RunErrors{Index: i, Game: run.GameInfo.GameName, Fields: errs})
+		}
+	}
+
+	return res
+}
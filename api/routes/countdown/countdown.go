@@ -0,0 +1,221 @@
+package countdown
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/onestay/MarathonTools-API/api/common"
+	"github.com/onestay/MarathonTools-API/api/models"
+	"github.com/onestay/MarathonTools-API/api/storage"
+)
+
+// Countdown counts down to a target time. Once it reaches zero it can start the timer and/or switch to a run
+type Countdown struct {
+	Name   string    `json:"name"`
+	Target time.Time `json:"target"`
+	// StartTimer will start the main timer when the countdown reaches zero
+	StartTimer bool `json:"startTimer"`
+	// SwitchRun is the id of the run to switch to when the countdown reaches zero. It's done before starting the timer
+	SwitchRun primitive.ObjectID `json:"switchRun,omitempty"`
+	ticker    *time.Ticker
+	done      chan struct{}
+}
+
+// Controller manages all countdowns
+type Controller struct {
+	b          *common.Controller
+	mu         sync.Mutex
+	countdowns map[string]*Countdown
+	startTimer func() error
+	switchRun  func(primitive.ObjectID) error
+}
+
+func (c *Controller) registerRoutes(r *httprouter.Router) {
+	r.GET("/countdown", c.GetCountdowns)
+	r.POST("/countdown", c.AddCountdown)
+	r.DELETE("/countdown/:name", c.DeleteCountdown)
+}
+
+// NewCountdownController returns a new countdown controller. startTimer and switchRun are called when a countdown reaches zero and is configured to do so
+func NewCountdownController(b *common.Controller, startTimer func() error, switchRun func(primitive.ObjectID) error, router *httprouter.Router) *Controller {
+	c := &Controller{
+		b:          b,
+		countdowns: make(map[string]*Countdown),
+		startTimer: startTimer,
+		switchRun:  switchRun,
+	}
+
+	c.registerRoutes(router)
+
+	return c
+}
+
+// GetCountdowns returns all running countdowns
+func (c *Controller) GetCountdowns(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
+	c.mu.Lock()
+	countdowns := make([]Countdown, 0, len(c.countdowns))
+	for _, cd := range c.countdowns {
+		countdowns = append(countdowns, *cd)
+	}
+	c.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(countdowns)
+}
+
+// AddCountdown adds a new countdown. Either a target time or a duration in the estimate format has to be provided. A countdown with the same name is replaced
+func (c *Controller) AddCountdown(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	body := struct {
+		Name       string             `json:"name"`
+		Target     time.Time          `json:"target"`
+		Duration   string             `json:"duration"`
+		StartTimer bool               `json:"startTimer"`
+		SwitchRun  primitive.ObjectID `json:"switchRun"`
+	}{}
+
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		c.b.Response("", "couldn't unmarshal body", http.StatusBadRequest, w)
+		return
+	}
+
+	if len(body.Name) == 0 {
+		c.b.Response("", "no name defined", http.StatusBadRequest, w)
+		return
+	}
+
+	target := body.Target
+	if len(body.Duration) != 0 {
+		d, err := models.ParseEstimate(body.Duration)
+		if err != nil {
+			c.b.Response("", err.Error(), http.StatusBadRequest, w)
+			return
+		}
+		target = time.Now().Add(d)
+	}
+
+	if !target.After(time.Now()) {
+		c.b.Response("", "target has to be in the future", http.StatusBadRequest, w)
+		return
+	}
+
+	// the run is checked now since an unknown run would only be noticed when the countdown reaches zero
+	if !body.SwitchRun.IsZero() {
+		_, err := c.b.Storage.Runs.Get(r.Context(), body.SwitchRun)
+		if err == storage.ErrNotFound {
+			c.b.Response("", "run to switch to not found", http.StatusNotFound, w)
+			return
+		} else if err != nil {
+			c.b.Response("", err.Error(), http.StatusInternalServerError, w)
+			return
+		}
+	}
+
+	cd := &Countdown{
+		Name:       body.Name,
+		Target:     target,
+		StartTimer: body.StartTimer,
+		SwitchRun:  body.SwitchRun,
+	}
+
+	c.mu.Lock()
+	if old, ok := c.countdowns[cd.Name]; ok {
+		old.stop()
+	}
+	c.countdowns[cd.Name] = cd
+	c.run(cd)
+	c.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(cd)
+}
+
+// DeleteCountdown cancels a countdown
+func (c *Controller) DeleteCountdown(w http.ResponseWriter, _ *http.Request, ps httprouter.Params) {
+	name := ps.ByName("name")
+
+	c.mu.Lock()
+	cd, ok := c.countdowns[name]
+	if ok {
+		cd.stop()
+		delete(c.countdowns, name)
+	}
+	c.mu.Unlock()
+
+	if !ok {
+		c.b.Response("", "countdown doesn't exist", http.StatusNotFound, w)
+		return
+	}
+
+	go c.b.WSCountdownUpdate(name, cd.Target, 0, false)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// run sends the remaining time every second and fires the countdown once it reaches zero. It has to be called with the lock held
+func (c *Controller) run(cd *Countdown) {
+	cd.ticker = time.NewTicker(time.Second)
+	cd.done = make(chan struct{})
+
+	go c.b.WSCountdownUpdate(cd.Name, cd.Target, time.Until(cd.Target).Seconds(), true)
+
+	go func(ticker *time.Ticker, done chan struct{}) {
+		for {
+			select {
+			case <-ticker.C:
+				remaining := time.Until(cd.Target)
+				if remaining > 0 {
+					c.b.WSCountdownUpdate(cd.Name, cd.Target, remaining.Seconds(), true)
+					continue
+				}
+
+				c.mu.Lock()
+				// the countdown might have been replaced or deleted in the meantime
+				if c.countdowns[cd.Name] != cd {
+					c.mu.Unlock()
+					return
+				}
+				cd.stop()
+				delete(c.countdowns, cd.Name)
+				c.mu.Unlock()
+
+				c.b.WSCountdownUpdate(cd.Name, cd.Target, 0, false)
+				c.fire(cd)
+				return
+			case <-done:
+				return
+			}
+		}
+	}(cd.ticker, cd.done)
+}
+
+// fire executes the actions of a countdown which reached zero
+func (c *Controller) fire(cd *Countdown) {
+	if !cd.SwitchRun.IsZero() {
+		if err := c.switchRun(cd.SwitchRun); err != nil {
+			c.b.LogError("while switching run after countdown "+cd.Name, err, true)
+			return
+		}
+	}
+
+	if cd.StartTimer {
+		if err := c.startTimer(); err != nil {
+			c.b.LogError("while starting timer after countdown "+cd.Name, err, true)
+		}
+	}
+}
+
+// stop has to be called with the lock of the controller held
+func (cd *Countdown) stop() {
+	if cd.ticker == nil {
+		return
+	}
+	cd.ticker.Stop()
+	close(cd.done)
+	cd.ticker = nil
+}
@@ -0,0 +1,68 @@
+package countdown
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/onestay/MarathonTools-API/api/common"
+	"github.com/onestay/MarathonTools-API/api/models"
+	"github.com/onestay/MarathonTools-API/api/storage"
+	"github.com/onestay/MarathonTools-API/api/storage/boltstore"
+	"github.com/onestay/MarathonTools-API/ws"
+)
+
+func TestAddCountdownChecksSwitchRun(t *testing.T) {
+	s, err := boltstore.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	backend := s.Backend(storage.NewActive(storage.DefaultMarathon))
+
+	run := models.Run{RunID: primitive.NewObjectID(), GameInfo: models.GameInfo{GameName: "A"}}
+	if err := backend.Runs.ReplaceAll(context.Background(), []models.Run{run}); err != nil {
+		t.Fatal(err)
+	}
+
+	hub := ws.NewHub()
+	go hub.Run()
+	router := httprouter.New()
+	c := NewCountdownController(common.NewController(hub, backend, 0), func() error { return nil }, func(primitive.ObjectID) error { return nil }, router)
+
+	tests := []struct {
+		name string
+		run  primitive.ObjectID
+		want int
+	}{
+		{"unknown", primitive.NewObjectID(), http.StatusNotFound},
+		{"known", run.RunID, http.StatusOK},
+		{"none", primitive.NilObjectID, http.StatusOK},
+	}
+	for _, tt := range tests {
+		body := `{"name": "` + tt.name + `", "duration": "1:00:00"`
+		if !tt.run.IsZero() {
+			body += `, "switchRun": "` + tt.run.Hex() + `"`
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("POST", "/countdown", strings.NewReader(body+"}")))
+		if w.Code != tt.want {
+			t.Errorf("%v run: got %v, want %v", tt.name, w.Code, tt.want)
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.countdowns["unknown"]; ok {
+		t.Error("countdown with an unknown run was created")
+	}
+	for _, cd := range c.countdowns {
+		cd.stop()
+	}
+}
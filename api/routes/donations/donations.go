@@ -4,11 +4,13 @@ import (
 	"encoding/json"
 	"net/http"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/julienschmidt/httprouter"
 
 	"github.com/onestay/MarathonTools-API/api/common"
+	"github.com/onestay/MarathonTools-API/api/events"
 )
 
 // DonationProvider is the interface that has to be satisfied for something to work as a donation provider
@@ -33,9 +35,12 @@ type Donation struct {
 
 // DonationController represents the donation controller
 type DonationController struct {
-	base          *common.Controller
+	base *common.Controller
+	// mu guards d, enabled, t, done and donationTotal
+	mu            sync.Mutex
 	d             DonationProvider
 	t             *time.Ticker
+	done          chan struct{}
 	donationTotal float64
 	enabled       bool
 }
@@ -47,6 +52,13 @@ func NewDonationController(b *common.Controller, d DonationProvider, e bool) *Do
 		d:       d,
 		enabled: e,
 	}
+	b.Automation.RegisterAction("donations.updateTotal", "Get the donation total and send it to the clients", func(events.Event) error {
+		p, enabled := dController.provider()
+		if !enabled {
+			return nil
+		}
+		return dController.updateTotal(p)
+	})
 
 	if !e {
 		return dController
@@ -58,14 +70,68 @@ func NewDonationController(b *common.Controller, d DonationProvider, e bool) *Do
 	return dController
 }
 
+// updateTotal gets the total from p, sends it to the clients and publishes a milestone if one was passed
+func (d *DonationController) updateTotal(p DonationProvider) error {
+	t, err := p.GetTotalAmount()
+	if err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	old := d.donationTotal
+	d.donationTotal = t
+	d.mu.Unlock()
+	d.base.WSDonationUpdate(old, t)
+
+	if m := d.base.Settings.Get().Donations.Reached(old, t); m != 0 {
+		d.base.Events.Publish(events.Event{Type: events.DonationMilestone, Total: t, Milestone: m})
+	}
+
+	return nil
+}
+
+// SetProvider replaces the donation provider. It's used when the active marathon is switched. A running total update is stopped
+func (d *DonationController) SetProvider(p DonationProvider, e bool) {
+	var total float64
+	if e {
+		total, _ = p.GetTotalAmount()
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.t != nil {
+		d.t.Stop()
+		close(d.done)
+		d.t = nil
+	}
+	d.d = p
+	d.enabled = e
+	d.donationTotal = total
+}
+
+// Total returns the last donation total and whether donations are enabled
+func (d *DonationController) Total() (float64, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.donationTotal, d.enabled
+}
+
+// provider returns the donation provider and whether donations are enabled
+func (d *DonationController) provider() (DonationProvider, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.d, d.enabled
+}
+
 // GetTotal will get the total amount of money donated
 func (d *DonationController) GetTotal(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
-	if !d.enabled {
+	p, enabled := d.provider()
+	if !enabled {
 		d.base.Response("", "Donations have not been enabled.", http.StatusBadRequest, w)
 		return
 	}
 
-	amount, err := d.d.GetTotalAmount()
+	amount, err := p.GetTotalAmount()
 	if err != nil {
 		d.base.Response("", "An error occurred getting total donation amount", 500, w)
 		return
@@ -81,12 +147,13 @@ func (d *DonationController) GetTotal(w http.ResponseWriter, _ *http.Request, _
 
 // GetAll will return all donations
 func (d *DonationController) GetAll(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
-	if !d.enabled {
+	p, enabled := d.provider()
+	if !enabled {
 		d.base.Response("", "Donations have not been enabled.", http.StatusBadRequest, w)
 		return
 	}
 
-	donations, err := d.d.GetDonations()
+	donations, err := p.GetDonations()
 	if err != nil {
 		d.base.Response("", "An error occurred getting donations", 500, w)
 		return
@@ -102,12 +169,13 @@ func (d *DonationController) GetAll(w http.ResponseWriter, _ *http.Request, _ ht
 
 // GetTotalDonations will return the number of all donations
 func (d *DonationController) GetTotalDonations(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
-	if !d.enabled {
+	p, enabled := d.provider()
+	if !enabled {
 		d.base.Response("", "Donations have not been enabled.", http.StatusBadRequest, w)
 		return
 	}
 
-	amount, err := d.d.GetTotalDonations()
+	amount, err := p.GetTotalDonations()
 	if err != nil {
 		d.base.Response("", "An error occurred getting donations", 500, w)
 		return
@@ -122,11 +190,12 @@ func (d *DonationController) GetTotalDonations(w http.ResponseWriter, _ *http.Re
 }
 
 func (d *DonationController) StartTotalUpdate(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
 	if !d.enabled {
 		d.base.Response("", "Donations have not been enabled.", http.StatusBadRequest, w)
 		return
 	}
-
 	if d.t != nil {
 		d.base.Response("", "already running", 400, w)
 		return
@@ -138,34 +207,38 @@ func (d *DonationController) StartTotalUpdate(w http.ResponseWriter, r *http.Req
 	}
 
 	d.t = time.NewTicker(time.Duration(interval) * time.Second)
+	d.done = make(chan struct{})
 
-	go func() {
+	go func(p DonationProvider, ticker *time.Ticker, done chan struct{}) {
 		for {
-			<-d.t.C
-			t, err := d.d.GetTotalAmount()
-			if err != nil {
-				d.base.LogError("while getting donation total", err, false)
+			select {
+			case <-ticker.C:
+				if err := d.updateTotal(p); err != nil {
+					d.base.LogError("while getting donation total", err, false)
+				}
+			case <-done:
+				return
 			}
-			d.base.WSDonationUpdate(d.donationTotal, t)
-			d.donationTotal = t
 		}
-	}()
+	}(d.d, d.t, d.done)
 
 	w.WriteHeader(http.StatusNoContent)
 
 }
 
 func (d *DonationController) StopTotalUpdate(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
 	if !d.enabled {
 		d.base.Response("", "Donations have not been enabled.", http.StatusBadRequest, w)
 		return
 	}
-
 	if d.t == nil {
 		d.base.Response("", "not running", 400, w)
 		return
 	}
 	d.t.Stop()
+	close(d.done)
 	d.t = nil
 	w.WriteHeader(http.StatusNoContent)
 }
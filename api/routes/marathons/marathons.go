@@ -0,0 +1,233 @@
+package marathons
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/onestay/MarathonTools-API/api/common"
+	"github.com/onestay/MarathonTools-API/api/models"
+	"github.com/onestay/MarathonTools-API/api/storage"
+)
+
+// Controller manages the marathons
+type Controller struct {
+	b *common.Controller
+}
+
+func (c *Controller) registerRoutes(r *httprouter.Router) {
+	r.GET("/marathon", c.GetActive)
+	r.GET("/marathons", c.GetMarathons)
+	r.POST("/marathons", c.AddMarathon)
+	r.GET("/marathons/:id", c.GetMarathon)
+	r.PATCH("/marathons/:id", c.UpdateMarathon)
+	r.POST("/marathons/:id/activate", c.Activate)
+	r.GET("/marathons/:id/runs", c.GetRuns)
+	r.GET("/marathons/:id/results", c.GetResults)
+}
+
+// NewMarathonController returns a new marathon controller
+func NewMarathonController(b *common.Controller, router *httprouter.Router) *Controller {
+	c := &Controller{
+		b: b,
+	}
+
+	c.registerRoutes(router)
+
+	return c
+}
+
+// GetActive returns the active marathon
+func (c *Controller) GetActive(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	m, err := c.b.Marathons.Active(r.Context())
+	if err != nil {
+		c.b.Response("", err.Error(), http.StatusInternalServerError, w)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(m.Public())
+}
+
+// GetMarathons returns all marathons including archived ones
+func (c *Controller) GetMarathons(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	marathons, err := c.b.Storage.Marathons.All(r.Context())
+	if err != nil {
+		c.b.Response("", err.Error(), http.StatusInternalServerError, w)
+		return
+	}
+
+	for i := range marathons {
+		marathons[i] = marathons[i].Public()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(marathons)
+}
+
+// GetMarathon returns a single marathon
+func (c *Controller) GetMarathon(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	m, ok := c.get(w, r, ps)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(m.Public())
+}
+
+// AddMarathon adds a new marathon. It doesn't become active until it's activated
+func (c *Controller) AddMarathon(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	m := models.Marathon{}
+	err := json.NewDecoder(r.Body).Decode(&m)
+	if err != nil {
+		c.b.Response("", "invalid body", http.StatusBadRequest, w)
+		return
+	}
+
+	if !storage.ValidMarathonID(m.ID) {
+		c.b.Response("", "id may only contain lowercase letters, digits and dashes", http.StatusBadRequest, w)
+		return
+	}
+	if len(m.Name) == 0 {
+		c.b.Response("", "name is required", http.StatusBadRequest, w)
+		return
+	}
+
+	if _, err := c.b.Storage.Marathons.Get(r.Context(), m.ID); err == nil {
+		c.b.Response("", "a marathon with that id already exists", http.StatusBadRequest, w)
+		return
+	} else if err != storage.ErrNotFound {
+		c.b.Response("", err.Error(), http.StatusInternalServerError, w)
+		return
+	}
+
+	m.Active = false
+	m.Archived = false
+	m.Created = time.Now()
+
+	err = c.b.Storage.Marathons.Insert(r.Context(), m)
+	if err != nil {
+		c.b.Response("", err.Error(), http.StatusInternalServerError, w)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(m.Public())
+}
+
+// UpdateMarathon updates the name, start, donation config and archived flag of a marathon. The active marathon can't be archived
+func (c *Controller) UpdateMarathon(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	m, ok := c.get(w, r, ps)
+	if !ok {
+		return
+	}
+
+	body := struct {
+		Name      *string                `json:"name"`
+		Start     *time.Time             `json:"start"`
+		Archived  *bool                  `json:"archived"`
+		Donations *models.DonationConfig `json:"donations"`
+	}{}
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		c.b.Response("", "invalid body", http.StatusBadRequest, w)
+		return
+	}
+
+	if body.Name != nil && len(*body.Name) != 0 {
+		m.Name = *body.Name
+	}
+	if body.Start != nil {
+		m.Start = *body.Start
+	}
+	if body.Archived != nil {
+		if *body.Archived && m.Active {
+			c.b.Response("", "can't archive the active marathon", http.StatusBadRequest, w)
+			return
+		}
+		m.Archived = *body.Archived
+	}
+	if body.Donations != nil {
+		// the password is never sent to clients so they send back the placeholder if it wasn't changed
+		if body.Donations.GDQPassword == m.Public().Donations.GDQPassword {
+			body.Donations.GDQPassword = m.Donations.GDQPassword
+		}
+		m.Donations = *body.Donations
+	}
+
+	err = c.b.Storage.Marathons.Update(r.Context(), m)
+	if err != nil {
+		c.b.Response("", err.Error(), http.StatusInternalServerError, w)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(m.Public())
+}
+
+// Activate switches the active marathon. The timer has to be stopped
+func (c *Controller) Activate(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	m, err := c.b.Marathons.Switch(r.Context(), ps.ByName("id"))
+	if err == storage.ErrNotFound {
+		c.b.Response("", "marathon not found", http.StatusNotFound, w)
+		return
+	} else if err != nil {
+		c.b.Response("", err.Error(), http.StatusBadRequest, w)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(m.Public())
+}
+
+// GetRuns returns the runs of any marathon. It's used to browse archived marathons
+func (c *Controller) GetRuns(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	m, ok := c.get(w, r, ps)
+	if !ok {
+		return
+	}
+
+	runs, err := c.b.Storage.Event(m.ID).Runs.All(r.Context())
+	if err != nil {
+		c.b.Response("", err.Error(), http.StatusInternalServerError, w)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(runs)
+}
+
+// GetResults returns the run results of any marathon
+func (c *Controller) GetResults(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	m, ok := c.get(w, r, ps)
+	if !ok {
+		return
+	}
+
+	results, err := c.b.Storage.Event(m.ID).Results.All(r.Context())
+	if err != nil {
+		c.b.Response("", err.Error(), http.StatusInternalServerError, w)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(results)
+}
+
+// get returns the marathon given by the id param and sends an error response if it doesn't exist
+func (c *Controller) get(w http.ResponseWriter, r *http.Request, ps httprouter.Params) (models.Marathon, bool) {
+	m, err := c.b.Storage.Marathons.Get(r.Context(), ps.ByName("id"))
+	if err == storage.ErrNotFound {
+		c.b.Response("", "marathon not found", http.StatusNotFound, w)
+		return m, false
+	} else if err != nil {
+		c.b.Response("", err.Error(), http.StatusInternalServerError, w)
+		return m, false
+	}
+
+	return m, true
+}
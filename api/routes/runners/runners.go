@@ -0,0 +1,204 @@
+package runners
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/onestay/MarathonTools-API/api/common"
+	"github.com/onestay/MarathonTools-API/api/models"
+	"github.com/onestay/MarathonTools-API/api/storage"
+)
+
+// Controller manages the runner directory
+type Controller struct {
+	b *common.Controller
+}
+
+func (c *Controller) registerRoutes(r *httprouter.Router) {
+	r.GET("/runners", c.GetRunners)
+	r.POST("/runners", c.AddRunner)
+	r.GET("/runners/:id", c.GetRunner)
+	r.PUT("/runners/:id", c.UpdateRunner)
+	r.DELETE("/runners/:id", c.DeleteRunner)
+	r.GET("/runners/:id/runs", c.GetRunnerRuns)
+}
+
+// NewRunnerController returns a new runner controller
+func NewRunnerController(b *common.Controller, router *httprouter.Router) *Controller {
+	c := &Controller{
+		b: b,
+	}
+
+	c.registerRoutes(router)
+
+	return c
+}
+
+// GetRunners returns all runners
+func (c *Controller) GetRunners(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	runners, err := c.b.Storage.Runners.All(r.Context())
+	if err != nil {
+		c.b.Response("", err.Error(), http.StatusInternalServerError, w)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(runners)
+}
+
+// GetRunner returns a single runner
+func (c *Controller) GetRunner(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	runner, ok := c.get(w, r, ps)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(runner)
+}
+
+// AddRunner adds a runner to the directory
+func (c *Controller) AddRunner(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	runner := models.Runner{}
+	err := json.NewDecoder(r.Body).Decode(&runner)
+	if err != nil {
+		c.b.Response("", "invalid body", http.StatusBadRequest, w)
+		return
+	}
+	if len(strings.TrimSpace(runner.DisplayName)) == 0 {
+		c.b.Response("", "displayName is required", http.StatusBadRequest, w)
+		return
+	}
+
+	runner.ID = primitive.NewObjectID()
+	err = c.b.Storage.Runners.Insert(r.Context(), runner)
+	if err != nil {
+		c.b.Response("", err.Error(), http.StatusInternalServerError, w)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(runner)
+}
+
+// UpdateRunner replaces the profile of a runner. The new profile is copied into every run of every marathon the runner
+// is part of
+func (c *Controller) UpdateRunner(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	runner, ok := c.get(w, r, ps)
+	if !ok {
+		return
+	}
+
+	updated := models.Runner{}
+	err := json.NewDecoder(r.Body).Decode(&updated)
+	if err != nil {
+		c.b.Response("", "invalid body", http.StatusBadRequest, w)
+		return
+	}
+	if len(strings.TrimSpace(updated.DisplayName)) == 0 {
+		c.b.Response("", "displayName is required", http.StatusBadRequest, w)
+		return
+	}
+	updated.ID = runner.ID
+
+	err = c.b.Storage.Runners.Update(r.Context(), updated)
+	if err != nil {
+		c.b.Response("", err.Error(), http.StatusInternalServerError, w)
+		return
+	}
+
+	err = c.b.PropagateRunner(r.Context(), common.Operator(r), updated)
+	if err != nil {
+		c.b.LogError("while updating the runs of a runner", err, true)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(updated)
+}
+
+// DeleteRunner removes a runner from the directory. Runners which are part of a run of the active marathon can't be deleted
+func (c *Controller) DeleteRunner(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	runner, ok := c.get(w, r, ps)
+	if !ok {
+		return
+	}
+
+	runs, err := c.runsOf(r, runner.ID)
+	if err != nil {
+		c.b.Response("", err.Error(), http.StatusInternalServerError, w)
+		return
+	}
+	if len(runs) != 0 {
+		c.b.Response("", "runner is part of a run", http.StatusBadRequest, w)
+		return
+	}
+
+	err = c.b.Storage.Runners.Delete(r.Context(), runner.ID)
+	if err != nil {
+		c.b.Response("", err.Error(), http.StatusInternalServerError, w)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetRunnerRuns returns all runs of the active marathon the runner is part of
+func (c *Controller) GetRunnerRuns(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	runner, ok := c.get(w, r, ps)
+	if !ok {
+		return
+	}
+
+	runs, err := c.runsOf(r, runner.ID)
+	if err != nil {
+		c.b.Response("", err.Error(), http.StatusInternalServerError, w)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(runs)
+}
+
+func (c *Controller) runsOf(r *http.Request, id primitive.ObjectID) ([]models.Run, error) {
+	all, err := c.b.Storage.Runs.All(r.Context())
+	if err != nil {
+		return nil, err
+	}
+
+	runs := []models.Run{}
+	for _, run := range all {
+		for _, p := range run.Players {
+			if p.RunnerID == id {
+				runs = append(runs, run)
+				break
+			}
+		}
+	}
+
+	return runs, nil
+}
+
+// get returns the runner given by the id param and sends an error response if it doesn't exist
+func (c *Controller) get(w http.ResponseWriter, r *http.Request, ps httprouter.Params) (models.Runner, bool) {
+	id, err := primitive.ObjectIDFromHex(ps.ByName("id"))
+	if err != nil {
+		c.b.Response("", "invalid bson id", http.StatusBadRequest, w)
+		return models.Runner{}, false
+	}
+
+	runner, err := c.b.Storage.Runners.Get(r.Context(), id)
+	if err == storage.ErrNotFound {
+		c.b.Response("", "runner not found", http.StatusNotFound, w)
+		return runner, false
+	} else if err != nil {
+		c.b.Response("", err.Error(), http.StatusInternalServerError, w)
+		return runner, false
+	}
+
+	return runner, true
+}
@@ -0,0 +1,99 @@
+package runs
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/julienschmidt/httprouter"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/onestay/MarathonTools-API/api/common"
+	"github.com/onestay/MarathonTools-API/api/models"
+	"github.com/onestay/MarathonTools-API/api/storage"
+)
+
+// snapshot returns all runs before a change so the change can be recorded afterwards
+func (rc RunController) snapshot(r *http.Request) []models.Run {
+	return rc.base.ScheduleSnapshot(r.Context())
+}
+
+// record stores the schedule after a change as a new version of the operator doing the request
+func (rc RunController) record(r *http.Request, action string, before []models.Run) {
+	rc.base.RecordSchedule(r.Context(), common.Operator(r), action, before)
+}
+
+// GetHistory returns all versions of the schedule without their runs, newest first
+func (rc RunController) GetHistory(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	versions, err := rc.base.Storage.History.List(r.Context())
+	if err != nil {
+		rc.base.Response("", err.Error(), http.StatusInternalServerError, w)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(versions)
+}
+
+// GetVersion returns the schedule as of the given version
+func (rc RunController) GetVersion(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	v, ok := rc.getVersion(w, r, ps)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// RollbackVersion replaces the schedule with the runs of the given version. The rollback itself is recorded as a new version
+func (rc RunController) RollbackVersion(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	v, ok := rc.getVersion(w, r, ps)
+	if !ok {
+		return
+	}
+
+	before := rc.snapshot(r)
+
+	// restored runs get a new version so edits based on the replaced runs are detected as conflicts
+	versions := make(map[primitive.ObjectID]int, len(before))
+	for _, run := range before {
+		versions[run.RunID] = run.Version
+	}
+	for i := range v.Runs {
+		if version, ok := versions[v.Runs[i].RunID]; ok {
+			v.Runs[i].Version = version + 1
+		}
+	}
+
+	err := rc.base.Storage.Runs.ReplaceAll(r.Context(), v.Runs)
+	if err != nil {
+		rc.base.Response("", err.Error(), http.StatusInternalServerError, w)
+		return
+	}
+	rc.record(r, "rollback to "+strconv.Itoa(v.Version), before)
+
+	w.WriteHeader(http.StatusNoContent)
+
+	rc.base.UpdateActiveRuns()
+	rc.base.WSRunUpdate()
+}
+
+func (rc RunController) getVersion(w http.ResponseWriter, r *http.Request, ps httprouter.Params) (models.ScheduleVersion, bool) {
+	version, err := strconv.Atoi(ps.ByName("version"))
+	if err != nil {
+		rc.base.Response("", "version isn't a valid int", http.StatusBadRequest, w)
+		return models.ScheduleVersion{}, false
+	}
+
+	v, err := rc.base.Storage.History.Get(r.Context(), version)
+	if err == storage.ErrNotFound {
+		rc.base.Response("", "version not found", http.StatusNotFound, w)
+		return v, false
+	} else if err != nil {
+		rc.base.Response("", err.Error(), http.StatusInternalServerError, w)
+		return v, false
+	}
+
+	return v, true
+}
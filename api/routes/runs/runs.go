@@ -1,18 +1,22 @@
 package runs
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"strconv"
+	"strings"
 
-	"github.com/go-redis/redis"
 	"github.com/julienschmidt/httprouter"
 	"github.com/onestay/MarathonTools-API/api/common"
+	"github.com/onestay/MarathonTools-API/api/events"
 	"github.com/onestay/MarathonTools-API/api/models"
-	"github.com/onestay/MarathonTools-API/api/routes/social"
-	"gopkg.in/mgo.v2/bson"
+	"github.com/onestay/MarathonTools-API/api/storage"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 // RunController contains all the methods needed to control runs
@@ -24,6 +28,8 @@ func (rc RunController) registerRoutes(r *httprouter.Router) {
 	r.GET("/run/get/all", rc.GetRuns)
 	r.GET("/run/get/single/:id", rc.GetRun)
 	r.GET("/run/get/active", rc.ActiveRuns)
+	r.GET("/run/results", rc.GetResults)
+	r.GET("/run/results/:id", rc.GetResult)
 
 	r.DELETE("/run/delete/:id", rc.DeleteRun)
 
@@ -35,16 +41,23 @@ func (rc RunController) registerRoutes(r *httprouter.Router) {
 
 	r.POST("/run/layout", rc.RefreshLayout)
 	r.POST("/run/upload", rc.UploadRunJSON)
+	r.POST("/run/validate", rc.ValidateRuns)
+
+	r.GET("/run/history", rc.GetHistory)
+	r.GET("/run/history/:version", rc.GetVersion)
+	r.POST("/run/history/:version/rollback", rc.RollbackVersion)
 
 }
 
 // NewRunController returns a new run controller
-func NewRunController(b *common.Controller, router *httprouter.Router) {
-	r := RunController{
+func NewRunController(b *common.Controller, router *httprouter.Router) *RunController {
+	r := &RunController{
 		base: b,
 	}
 
 	r.registerRoutes(router)
+
+	return r
 }
 
 // RefreshLayout will send a WsCurrentUpdate to refresh the layout
@@ -55,27 +68,44 @@ func (rc RunController) RefreshLayout(_ http.ResponseWriter, _ *http.Request, _
 // AddRun will add a run to the database and return the ID of the new run
 func (rc RunController) AddRun(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 	run := models.Run{}
-	json.NewDecoder(r.Body).Decode(&run)
+	err := json.NewDecoder(r.Body).Decode(&run)
+	if err != nil {
+		rc.base.Response("", "invalid body", http.StatusBadRequest, w)
+		return
+	}
+
+	run.RunID = primitive.NewObjectID()
+	if !rc.validate(w, r, run) {
+		return
+	}
+
+	if !rc.checkLinkedPlayers(w, r, run) {
+		return
+	}
 
-	run.RunID = bson.NewObjectId()
+	// the players are resolved in place
+	if _, err := rc.base.ResolvePlayers(r.Context(), []models.Run{run}); err != nil {
+		rc.base.Response("", "err linking players to runners", http.StatusInternalServerError, w)
+		return
+	}
 
-	err := rc.base.MGS.DB("marathon").C("runs").Insert(run)
+	before := rc.snapshot(r)
+	err = rc.base.Storage.Runs.Insert(r.Context(), run)
 	if err != nil {
 		rc.base.Response("", "err adding run", http.StatusInternalServerError, w)
 		return
 	}
+	rc.record(r, "add", before)
 
 	rc.base.Response(run.RunID.Hex(), "", http.StatusOK, w)
 
-	go rc.base.WSRunsOnlyUpdate()
-	go rc.base.UpdateActiveRuns()
+	rc.base.UpdateActiveRuns()
+	go rc.base.WSRunUpdate()
 }
 
-// GetRuns will return all runs from the mgo collection
-func (rc RunController) GetRuns(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
-	var runs []models.Run
-
-	err := rc.base.MGS.DB("marathon").C("runs").Find(nil).All(&runs)
+// GetRuns will return all runs from the run repository
+func (rc RunController) GetRuns(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	runs, err := rc.base.Storage.Runs.All(r.Context())
 	if err != nil {
 		rc.base.Response("", err.Error(), http.StatusInternalServerError, w)
 		fmt.Println(err)
@@ -87,17 +117,15 @@ func (rc RunController) GetRuns(w http.ResponseWriter, _ *http.Request, _ httpro
 }
 
 // GetRun will return a run
-func (rc RunController) GetRun(w http.ResponseWriter, _ *http.Request, ps httprouter.Params) {
-	runID := ps.ByName("id")
-	if !bson.IsObjectIdHex(runID) {
+func (rc RunController) GetRun(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	runID, err := primitive.ObjectIDFromHex(ps.ByName("id"))
+	if err != nil {
 		rc.base.Response("", "invalid bson id", http.StatusBadRequest, w)
 		return
 	}
 
-	run := models.Run{}
-	err := rc.base.MGS.DB("marathon").C("runs").FindId(bson.ObjectIdHex(runID)).One(&run)
-
-	if s := err.Error(); s == "not found" {
+	run, err := rc.base.Storage.Runs.Get(r.Context(), runID)
+	if err == storage.ErrNotFound {
 		rc.base.Response("", err.Error(), http.StatusNotFound, w)
 		return
 	} else if err != nil {
@@ -106,16 +134,14 @@ func (rc RunController) GetRun(w http.ResponseWriter, _ *http.Request, ps httpro
 	}
 
 	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", etag(run))
 	w.WriteHeader(200)
 	json.NewEncoder(w).Encode(run)
 }
 
 func (rc RunController) ActiveRuns(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
-	runs := make([]models.Run, 3)
-
-	runs[0] = *rc.base.PrevRun
-	runs[1] = *rc.base.CurrentRun
-	runs[2] = *rc.base.NextRun
+	st := rc.base.State.Snapshot()
+	runs := []models.Run{st.PrevRun, st.CurrentRun, st.NextRun}
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(200)
@@ -123,204 +149,394 @@ func (rc RunController) ActiveRuns(w http.ResponseWriter, _ *http.Request, _ htt
 }
 
 // DeleteRun will delete a run with the provided id
-func (rc RunController) DeleteRun(w http.ResponseWriter, _ *http.Request, ps httprouter.Params) {
-	runID := ps.ByName("id")
-	if !bson.IsObjectIdHex(runID) {
+func (rc RunController) DeleteRun(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	runID, err := primitive.ObjectIDFromHex(ps.ByName("id"))
+	if err != nil {
 		rc.base.Response("", "invalid bson id", http.StatusBadRequest, w)
 		return
 	}
 
-	err := rc.base.MGS.DB("marathon").C("runs").RemoveId(bson.ObjectIdHex(runID))
+	before := rc.snapshot(r)
+	err = rc.base.Storage.Runs.Delete(r.Context(), runID)
 	if err != nil {
 		fmt.Println(err)
 		rc.base.Response("", err.Error(), http.StatusNotFound, w)
 		return
 	}
+	rc.record(r, "delete", before)
 
 	w.WriteHeader(http.StatusNoContent)
 
+	rc.base.UpdateActiveRuns()
 	rc.base.WSRunUpdate()
 }
 
-// UpdateRun will update the run with the id provided and the request body
+// UpdateRun applies the request body as JSON merge patch (RFC 7396) to the run with the id provided. Fields which aren't
+// in the body are kept. Clients can send the version they edited in the If-Match header or the version field to make
+// sure they don't overwrite changes of someone else
 func (rc RunController) UpdateRun(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
-	runID := ps.ByName("id")
-	if !bson.IsObjectIdHex(runID) {
+	runID, err := primitive.ObjectIDFromHex(ps.ByName("id"))
+	if err != nil {
 		rc.base.Response("", "invalid bson id", http.StatusBadRequest, w)
 		return
 	}
 
-	updatedRun := models.Run{}
+	patch, err := io.ReadAll(r.Body)
+	if err != nil {
+		rc.base.Response("", "couldn't read body", http.StatusBadRequest, w)
+		return
+	}
 
-	err := json.NewDecoder(r.Body).Decode(&updatedRun)
+	stored, err := rc.base.Storage.Runs.Get(r.Context(), runID)
+	if err == storage.ErrNotFound {
+		rc.base.Response("", err.Error(), http.StatusNotFound, w)
+		return
+	} else if err != nil {
+		rc.base.Response("", err.Error(), http.StatusInternalServerError, w)
+		return
+	}
+
+	doc, _ := json.Marshal(stored)
+	doc, err = common.MergePatch(doc, patch)
 	if err != nil {
-		rc.base.Response("", "couldn't unmarshal body", http.StatusInternalServerError, w)
+		rc.base.Response("", "couldn't unmarshal body", http.StatusBadRequest, w)
 		log.Printf("Error in UpdateRun: %v", err)
 		return
 	}
-	updatedRun.RunID = bson.ObjectIdHex(runID)
 
-	err = rc.base.MGS.DB("marathon").C("runs").UpdateId(bson.ObjectIdHex(runID), updatedRun)
+	updatedRun := models.Run{}
+	err = json.Unmarshal(doc, &updatedRun)
 	if err != nil {
+		rc.base.Response("", "invalid run: "+err.Error(), http.StatusBadRequest, w)
+		return
+	}
+	updatedRun.RunID = runID
+
+	// the version of the run is only changed by the patch if the client sent the version it edited
+	conflict := http.StatusConflict
+	if v, ok := ifMatch(r); ok {
+		updatedRun.Version = v
+		conflict = http.StatusPreconditionFailed
+	}
+	if updatedRun.Version != stored.Version {
+		rc.base.Response("", "run was changed by someone else", conflict, w)
+		return
+	}
+
+	if !rc.validate(w, r, updatedRun) {
+		return
+	}
+
+	if !rc.checkLinkedPlayers(w, r, updatedRun) {
+		return
+	}
+
+	// a category resolved from the old game name is resolved again on the next twitch update
+	updatedRun.ClearStaleTwitchCategory()
+
+	// the players are resolved in place
+	if _, err := rc.base.ResolvePlayers(r.Context(), []models.Run{updatedRun}); err != nil {
+		rc.base.Response("", "err linking players to runners", http.StatusInternalServerError, w)
+		return
+	}
+
+	before := rc.snapshot(r)
+	err = rc.base.Storage.Runs.Update(r.Context(), updatedRun)
+	if err == storage.ErrConflict {
+		rc.base.Response("", "run was changed by someone else", conflict, w)
+		return
+	} else if err != nil {
 		rc.base.Response("", err.Error(), http.StatusInternalServerError, w)
 		return
 	}
+	updatedRun.Version++
+	rc.record(r, "update", before)
 
+	w.Header().Set("ETag", etag(updatedRun))
 	w.WriteHeader(http.StatusNoContent)
 
 	rc.base.WSRunsOnlyUpdate()
-	if updatedRun.RunID == rc.base.CurrentRun.RunID {
-		rc.base.CurrentRun = &updatedRun
+	if rc.base.State.RefreshRun(updatedRun) {
+		rc.base.CL.Refresh()
 		rc.base.WSCurrentUpdate()
+		go rc.base.WSHostUpdate()
+	}
+}
+
+// etag returns the entity tag of a run which is its version
+func etag(run models.Run) string {
+	return `"` + strconv.Itoa(run.Version) + `"`
+}
+
+// ifMatch returns the version sent in the If-Match header. ok is false if the header isn't set or isn't a version
+func ifMatch(r *http.Request) (version int, ok bool) {
+	h := strings.TrimPrefix(r.Header.Get("If-Match"), "W/")
+	v, err := strconv.Atoi(strings.Trim(h, `"`))
+	if err != nil {
+		return 0, false
 	}
 
+	return v, true
 }
 
-// MoveRun takes the run by id and moves it after the run provided by after
-// to do this we have to pull every run from the collection, then delete every run in the db
-// do the moving and insert all the records into the db again
-// which is kinda stupid tbh
-func (rc RunController) MoveRun(w http.ResponseWriter, _ *http.Request, ps httprouter.Params) {
-	runID := ps.ByName("id")
-	after := ps.ByName("after")
-	if !bson.IsObjectIdHex(runID) || !bson.IsObjectIdHex(after) {
+// MoveRun takes the run by id and moves it after the run provided by after. The zero id as after moves the run to the top
+// to do this we have to pull every run from the repository, do the moving and replace all runs in the repository
+func (rc RunController) MoveRun(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	runID, err := primitive.ObjectIDFromHex(ps.ByName("id"))
+	after, errAfter := primitive.ObjectIDFromHex(ps.ByName("after"))
+	if err != nil || errAfter != nil {
 		rc.base.Response("", "invalid bson id", http.StatusBadRequest, w)
 		return
 	}
+	if runID == after {
+		rc.base.Response("", "a run can't be moved after itself", http.StatusBadRequest, w)
+		return
+	}
 
-	var runs []models.Run
-
-	err := rc.base.MGS.DB("marathon").C("runs").Find(nil).All(&runs)
+	runs, err := rc.base.Storage.Runs.All(r.Context())
 	if err != nil {
 		rc.base.Response("", err.Error(), http.StatusInternalServerError, w)
 		fmt.Println(err)
 		return
 	}
 
-	var index int
-	var indexToInsert int
-
+	before := append([]models.Run(nil), runs...)
+	index := -1
 	for i := 0; i < len(runs); i++ {
-		if runs[i].RunID == bson.ObjectIdHex(runID) {
+		if runs[i].RunID == runID {
 			index = i
-		} else if runs[i].RunID == bson.ObjectIdHex(after) {
-			indexToInsert = i
 		}
 	}
+	if index == -1 {
+		rc.base.Response("", "run not found", http.StatusNotFound, w)
+		return
+	}
 
 	q := runs[index]
-	b := append(runs[:index], runs[index+1:]...)
-	runs = append(b[:indexToInsert], append([]models.Run{q}, b[indexToInsert:]...)...)
+	rest := append(append([]models.Run(nil), runs[:index]...), runs[index+1:]...)
 
-	rc.base.MGS.DB("marathon").C("runs").RemoveAll(nil)
+	// the position is searched after removing the run so it's the same for moves in both directions
+	indexToInsert := -1
+	if after.IsZero() {
+		indexToInsert = 0
+	}
+	for i := 0; i < len(rest); i++ {
+		if rest[i].RunID == after {
+			indexToInsert = i + 1
+		}
+	}
+	if indexToInsert == -1 {
+		rc.base.Response("", "run to move after not found", http.StatusNotFound, w)
+		return
+	}
+	runs = append(rest[:indexToInsert:indexToInsert], append([]models.Run{q}, rest[indexToInsert:]...)...)
 
-	for i := 0; i < len(runs); i++ {
-		rc.base.MGS.DB("marathon").C("runs").Insert(runs[i])
+	err = rc.base.Storage.Runs.ReplaceAll(r.Context(), runs)
+	if err != nil {
+		rc.base.Response("", err.Error(), http.StatusInternalServerError, w)
+		return
 	}
+	rc.record(r, "move", before)
 
 	w.WriteHeader(http.StatusNoContent)
 
-	rc.base.WSRunsOnlyUpdate()
+	rc.base.UpdateActiveRuns()
+	rc.base.WSRunUpdate()
 }
 
 // SwitchRun will update the currently active, upcoming and previous run based on the current run index
 func (rc *RunController) SwitchRun(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
-	if rc.base.TimerState != common.TimerStopped {
-		rc.base.Response("", "can't switch runs while timer is running", 400, w)
+	runs, err := rc.base.Storage.Runs.All(r.Context())
+	if err != nil {
+		rc.base.Response("", err.Error(), http.StatusInternalServerError, w)
 		return
 	}
 
-	meth := "next"
+	index := rc.base.State.RunIndex()
 	if r.URL.Query().Get("m") == "prev" {
-		meth = "prev"
-	}
-	c, _ := rc.base.Col.Count()
-
-	if meth == "next" {
-		if c <= rc.base.RunIndex+1 {
-			rc.base.Response("", "no next run", 400, w)
+		if index == 0 {
+			rc.base.Response("", "no prev run", 400, w)
 			return
 		}
-		rc.base.RunIndex++
-	} else if meth == "prev" {
-		if rc.base.RunIndex == 0 {
-			rc.base.Response("", "no prev run", 400, w)
+		index--
+	} else {
+		if len(runs) <= index+1 {
+			rc.base.Response("", "no next run", 400, w)
 			return
 		}
-		rc.base.RunIndex--
+		index++
 	}
 
-	rc.base.UpdateActiveRuns()
-	if rc.base.CL.CheckDone() {
-		go rc.checkForUpdate()
+	if err := rc.switchRun(index, runs); err != nil {
+		rc.base.Response("", err.Error(), 400, w)
+		return
 	}
-	go rc.base.CL.ResetChecklist()
 
 	w.WriteHeader(http.StatusNoContent)
 
 	rc.base.WSCurrentUpdate()
 }
 
-// UploadRunJSON will take a json and import the runs
+// SwitchTo will switch to the run with the given id
+func (rc *RunController) SwitchTo(runID primitive.ObjectID) error {
+	runs, err := rc.base.Storage.Runs.All(context.Background())
+	if err != nil {
+		return err
+	}
+
+	for i, run := range runs {
+		if run.RunID == runID {
+			if err := rc.switchRun(i, runs); err != nil {
+				return err
+			}
+			rc.base.WSCurrentUpdate()
+			return nil
+		}
+	}
+
+	return errors.New("run not found")
+}
+
+func (rc *RunController) switchRun(index int, runs []models.Run) error {
+	if err := rc.base.CL.Gate(); err != nil {
+		return err
+	}
+	if err := rc.base.State.SwitchRun(index, runs); err != nil {
+		return err
+	}
+	currentRun := rc.base.State.CurrentRun()
+	rc.base.Setup.Start(&currentRun)
+	rc.base.Events.Publish(events.Event{Type: events.RunSwitched, Run: &currentRun})
+	go rc.base.CL.ResetChecklist()
+
+	return nil
+}
+
+// UploadRunJSON will take a json and import the runs. The previous schedule is kept in the schedule history
 func (rc *RunController) UploadRunJSON(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 	var runs []models.Run
 
 	err := json.NewDecoder(r.Body).Decode(&runs)
 	if err != nil {
-		rc.base.Response("", "couldn't unmarshal body", http.StatusInternalServerError, w)
+		rc.base.Response("", "couldn't unmarshal body", http.StatusBadRequest, w)
 		log.Printf("Error in UploadRunJSON: %v", err)
 		return
 	}
 
-	rc.base.MGS.DB("marathon").C("runs").RemoveAll(nil)
+	if errs := models.ValidateRuns(runs); len(errs) != 0 {
+		rc.base.RunsValidationError(errs, w)
+		return
+	}
+
+	for i := range runs {
+		runs[i].RunID = primitive.NewObjectID()
+	}
 
-	for _, run := range runs {
-		run.RunID = bson.NewObjectId()
-		err := rc.base.MGS.DB("marathon").C("runs").Insert(run)
-		if err != nil {
-			panic("error adding run from UploadRunJSON into db")
-		}
+	if _, err := rc.base.ResolvePlayers(r.Context(), runs); err != nil {
+		rc.base.Response("", "err linking players to runners", http.StatusInternalServerError, w)
+		return
 	}
 
+	before := rc.snapshot(r)
+	err = rc.base.Storage.Runs.ReplaceAll(r.Context(), runs)
+	if err != nil {
+		rc.base.Response("", "error adding runs from UploadRunJSON into db", http.StatusInternalServerError, w)
+		log.Printf("Error in UploadRunJSON: %v", err)
+		return
+	}
+	rc.record(r, "upload", before)
+
 	log.Printf("imported %v runs", len(runs))
 	w.WriteHeader(http.StatusNoContent)
+
+	rc.base.UpdateActiveRuns()
+	go rc.base.WSRunUpdate()
 }
-func (rc *RunController) checkForUpdate() {
-	go func() {
-		var res []byte
-		var ts social.TwitchSettings
-		res, err := rc.base.RedisClient.Get("twitchSettings").Bytes()
-		if err != nil {
-			if err == redis.Nil {
-				return
-			}
-			rc.base.LogError("error while getting twitch settings from redis", err, true)
-			return
-		}
 
-		json.Unmarshal(res, &ts)
+// ValidateRuns validates a schedule in the same format as UploadRunJSON without importing it.
+// It always responds with the list of errors which is empty if the schedule is valid
+func (rc *RunController) ValidateRuns(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	var runs []models.Run
 
-		if ts.Update {
-			rc.base.SocialUpdatesChan <- 1
-		}
+	err := json.NewDecoder(r.Body).Decode(&runs)
+	if err != nil {
+		rc.base.Response("", "couldn't unmarshal body", http.StatusBadRequest, w)
+		return
+	}
 
-	}()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(models.ValidateRuns(runs))
+}
 
-	go func() {
-		res, err := rc.base.RedisClient.Get("twitterSettings").Bytes()
-		if err != nil {
-			if err == redis.Nil {
-				return
-			}
-			rc.base.LogError("error while getting settings from twitter", err, true)
-			return
-		}
-		if b, err := strconv.ParseBool(string(res)); err == nil && b {
-			rc.base.SocialUpdatesChan <- 2
-		}
-	}()
+// checkLinkedPlayers rejects edits of players linked to a runner. It sends the response and returns false if there are any
+func (rc RunController) checkLinkedPlayers(w http.ResponseWriter, r *http.Request, run models.Run) bool {
+	errs, err := rc.base.CheckLinkedPlayers(r.Context(), run)
+	if err != nil {
+		rc.base.Response("", "err linking players to runners", http.StatusInternalServerError, w)
+		return false
+	}
+	if len(errs) != 0 {
+		rc.base.LinkedPlayersError(errs, w)
+		return false
+	}
+
+	return true
+}
+
+// validate validates the run and makes sure it isn't a duplicate of another run. It sends the errors and returns false if
+// the run is invalid
+func (rc RunController) validate(w http.ResponseWriter, r *http.Request, run models.Run) bool {
+	errs := run.Validate()
+
+	runs, err := rc.base.Storage.Runs.All(r.Context())
+	if err != nil {
+		rc.base.Response("", err.Error(), http.StatusInternalServerError, w)
+		return false
+	}
+	if d := models.FindDuplicate(run, runs); d != -1 {
+		errs = append(errs, models.FieldError{
+			Field:   "run",
+			Message: "duplicate of run " + runs[d].RunID.Hex(),
+		})
+	}
+
+	if len(errs) != 0 {
+		rc.base.ValidationError(errs, w)
+		return false
+	}
+
+	return true
+}
 
-	go func() {
-		rc.base.SocialUpdatesChan <- 0x50
-	}()
+// GetResults will return the results of all finished runs
+func (rc RunController) GetResults(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	results, err := rc.base.Storage.Results.All(r.Context())
+	if err != nil {
+		rc.base.Response("", err.Error(), http.StatusInternalServerError, w)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(results)
+}
+
+// GetResult will return the result of a single run
+func (rc RunController) GetResult(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	runID, err := primitive.ObjectIDFromHex(ps.ByName("id"))
+	if err != nil {
+		rc.base.Response("", "invalid bson id", http.StatusBadRequest, w)
+		return
+	}
+
+	res, err := rc.base.Storage.Results.Get(r.Context(), runID)
+	if err == storage.ErrNotFound {
+		rc.base.Response("", err.Error(), http.StatusNotFound, w)
+		return
+	} else if err != nil {
+		rc.base.Response("", err.Error(), http.StatusInternalServerError, w)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
 }
@@ -0,0 +1,113 @@
+package runs
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/onestay/MarathonTools-API/api/common"
+	"github.com/onestay/MarathonTools-API/api/models"
+	"github.com/onestay/MarathonTools-API/api/storage"
+	"github.com/onestay/MarathonTools-API/api/storage/boltstore"
+	"github.com/onestay/MarathonTools-API/ws"
+)
+
+// newTestController returns a run controller on an embedded database with the runs A, B, C and D
+func newTestController(t *testing.T) (*common.Controller, *httprouter.Router, []models.Run) {
+	t.Helper()
+	s, err := boltstore.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	backend := s.Backend(storage.NewActive(storage.DefaultMarathon))
+
+	var runs []models.Run
+	for _, name := range []string{"A", "B", "C", "D"} {
+		runs = append(runs, models.Run{RunID: primitive.NewObjectID(), GameInfo: models.GameInfo{GameName: name}})
+	}
+	if err := backend.Runs.ReplaceAll(context.Background(), runs); err != nil {
+		t.Fatal(err)
+	}
+
+	hub := ws.NewHub()
+	go hub.Run()
+	b := common.NewController(hub, backend, 0)
+	router := httprouter.New()
+	NewRunController(b, router)
+
+	return b, router, runs
+}
+
+// order returns the game names of the stored runs
+func order(t *testing.T, b *common.Controller) string {
+	t.Helper()
+	runs, err := b.Storage.Runs.All(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for _, r := range runs {
+		names = append(names, r.GameInfo.GameName)
+	}
+
+	return strings.Join(names, "")
+}
+
+func TestMoveRun(t *testing.T) {
+	tests := []struct {
+		name      string
+		run       int
+		after     int
+		want      string
+		wantCode  int
+		versioned bool
+	}{
+		{"earlier", 3, 0, "ADBC", http.StatusNoContent, true},
+		{"later", 0, 2, "BCAD", http.StatusNoContent, true},
+		{"to the next position", 1, 2, "ACBD", http.StatusNoContent, true},
+		{"to the top", 2, -1, "CABD", http.StatusNoContent, true},
+		{"after itself", 1, 1, "ABCD", http.StatusBadRequest, false},
+		{"unknown run", -2, 0, "ABCD", http.StatusNotFound, false},
+		{"unknown after", 1, -2, "ABCD", http.StatusNotFound, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, router, runs := newTestController(t)
+			id := func(i int) string {
+				switch i {
+				case -1:
+					return primitive.NilObjectID.Hex()
+				case -2:
+					return primitive.NewObjectID().Hex()
+				}
+				return runs[i].RunID.Hex()
+			}
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest("POST", "/run/move/"+id(tt.run)+"/"+id(tt.after), nil))
+			if w.Code != tt.wantCode {
+				t.Fatalf("got %v, want %v", w.Code, tt.wantCode)
+			}
+			if got := order(t, b); got != tt.want {
+				t.Errorf("order is %v, want %v", got, tt.want)
+			}
+
+			versions, err := b.Storage.History.List(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if versioned := len(versions) != 0; versioned != tt.versioned {
+				t.Errorf("recorded a version: %v, want %v", versioned, tt.versioned)
+			}
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package schedule
+
+import (
+	"strings"
+	"time"
+)
+
+const icsTimeFormat = "20060102T150405Z"
+
+// icsCalendar renders the schedule as iCalendar (RFC 5545). Runs without a projected time are skipped
+func icsCalendar(s Schedule, now time.Time) string {
+	var b strings.Builder
+	line := func(l string) {
+		b.WriteString(icsFold(l))
+		b.WriteString("\r\n")
+	}
+
+	line("BEGIN:VCALENDAR")
+	line("VERSION:2.0")
+	line("PRODID:-//MarathonTools//Schedule//EN")
+	line("CALSCALE:GREGORIAN")
+	line("X-WR-CALNAME:" + icsEscape(s.Marathon))
+
+	for _, run := range s.Runs {
+		if run.Start == nil || run.End == nil {
+			continue
+		}
+
+		summary := run.Game
+		if len(run.Category) != 0 {
+			summary += " - " + run.Category
+		}
+		var desc []string
+		if len(run.Runners) != 0 {
+			desc = append(desc, "Runners: "+strings.Join(run.Runners, ", "))
+		}
+		if len(run.Platform) != 0 {
+			desc = append(desc, "Platform: "+run.Platform)
+		}
+		if len(run.Estimate) != 0 {
+			desc = append(desc, "Estimate: "+run.Estimate)
+		}
+
+		line("BEGIN:VEVENT")
+		line("UID:" + run.RunID.Hex() + "@marathontools")
+		line("DTSTAMP:" + now.UTC().Format(icsTimeFormat))
+		line("DTSTART:" + run.Start.UTC().Format(icsTimeFormat))
+		line("DTEND:" + run.End.UTC().Format(icsTimeFormat))
+		line("SUMMARY:" + icsEscape(summary))
+		if len(desc) != 0 {
+			line("DESCRIPTION:" + icsEscape(strings.Join(desc, "\n")))
+		}
+		line("END:VEVENT")
+	}
+
+	line("END:VCALENDAR")
+
+	return b.String()
+}
+
+var icsEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`)
+
+func icsEscape(s string) string {
+	return icsEscaper.Replace(s)
+}
+
+// icsFold folds lines longer than 75 octets without splitting utf-8 characters
+func icsFold(l string) string {
+	if len(l) <= 75 {
+		return l
+	}
+
+	var b strings.Builder
+	n := 0
+	for _, r := range l {
+		size := len(string(r))
+		if n+size > 75 {
+			b.WriteString("\r\n ")
+			// the leading space counts towards the length of the continuation line
+			n = 1
+		}
+		b.WriteRune(r)
+		n += size
+	}
+
+	return b.String()
+}
@@ -0,0 +1,210 @@
+package schedule
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/onestay/MarathonTools-API/api/common"
+	"github.com/onestay/MarathonTools-API/api/models"
+)
+
+// Controller exports the schedule of the active marathon
+type Controller struct {
+	b *common.Controller
+}
+
+// ScheduledRun is a run with its projected start and end. Start and End are only set if the marathon has a start time
+type ScheduledRun struct {
+	RunID    primitive.ObjectID `json:"runID"`
+	Game     string             `json:"game"`
+	Category string             `json:"category"`
+	Platform string             `json:"platform"`
+	Estimate string             `json:"estimate"`
+	Setup    string             `json:"setup"`
+	Runners  []string           `json:"runners"`
+	Start    *time.Time         `json:"start,omitempty"`
+	End      *time.Time         `json:"end,omitempty"`
+	// Finished is true if the run has a result. Its end is the time it was finished
+	Finished bool `json:"finished"`
+}
+
+// Schedule is the public read only schedule
+type Schedule struct {
+	Marathon string         `json:"marathon"`
+	Start    *time.Time     `json:"start,omitempty"`
+	Runs     []ScheduledRun `json:"runs"`
+}
+
+func (c *Controller) registerRoutes(r *httprouter.Router) {
+	r.GET("/schedule", c.GetSchedule)
+	r.GET("/schedule/export.csv", c.ExportCSV)
+	r.GET("/schedule/export.ics", c.ExportICS)
+}
+
+// NewScheduleController returns a new schedule controller
+func NewScheduleController(b *common.Controller, router *httprouter.Router) *Controller {
+	c := &Controller{
+		b: b,
+	}
+
+	c.registerRoutes(router)
+
+	return c
+}
+
+// GetSchedule returns the schedule with the projected start time of every run
+func (c *Controller) GetSchedule(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	s, err := c.schedule(r.Context())
+	if err != nil {
+		c.b.Response("", err.Error(), http.StatusInternalServerError, w)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s)
+}
+
+// ExportCSV returns the schedule as csv for spreadsheets
+func (c *Controller) ExportCSV(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	s, err := c.schedule(r.Context())
+	if err != nil {
+		c.b.Response("", err.Error(), http.StatusInternalServerError, w)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="schedule.csv"`)
+
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"Start", "End", "Game", "Category", "Platform", "Estimate", "Setup", "Runners"})
+	for _, run := range s.Runs {
+		cw.Write([]string{
+			formatTime(run.Start),
+			formatTime(run.End),
+			run.Game,
+			run.Category,
+			run.Platform,
+			run.Estimate,
+			run.Setup,
+			strings.Join(run.Runners, ", "),
+		})
+	}
+	cw.Flush()
+}
+
+// ExportICS returns the schedule as iCalendar feed with every run as an event at its projected time
+func (c *Controller) ExportICS(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	s, err := c.schedule(r.Context())
+	if err != nil {
+		c.b.Response("", err.Error(), http.StatusInternalServerError, w)
+		return
+	}
+	if s.Start == nil {
+		c.b.Response("", "the marathon has no start time", http.StatusBadRequest, w)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="schedule.ics"`)
+	w.Write([]byte(icsCalendar(s, time.Now())))
+}
+
+// schedule builds the schedule of the active marathon
+func (c *Controller) schedule(ctx context.Context) (Schedule, error) {
+	m, err := c.b.Marathons.Active(ctx)
+	if err != nil {
+		return Schedule{}, err
+	}
+	runs, err := c.b.Storage.Runs.All(ctx)
+	if err != nil {
+		return Schedule{}, err
+	}
+	results, err := c.b.Storage.Results.All(ctx)
+	if err != nil {
+		return Schedule{}, err
+	}
+
+	s := Schedule{
+		Marathon: m.Name,
+		Runs:     project(m.Start, runs, results),
+	}
+	if !m.Start.IsZero() {
+		s.Start = &m.Start
+	}
+
+	return s, nil
+}
+
+// project calculates the start and end of every run. Every run starts after the setup following the end of the
+// previous run. Finished runs use the times they were actually run at, all others end after their estimate
+func project(start time.Time, runs []models.Run, results []models.RunResult) []ScheduledRun {
+	finished := make(map[primitive.ObjectID]models.RunResult, len(results))
+	for _, res := range results {
+		finished[res.RunID] = res
+	}
+
+	scheduled := make([]ScheduledRun, len(runs))
+	t := start
+	for i, run := range runs {
+		s := ScheduledRun{
+			RunID:    run.RunID,
+			Game:     run.GameInfo.GameName,
+			Category: run.RunInfo.Category,
+			Platform: run.RunInfo.Platform,
+			Estimate: run.RunInfo.Estimate,
+			Setup:    run.RunInfo.Setup,
+			Runners:  make([]string, len(run.Players)),
+		}
+		for j, p := range run.Players {
+			s.Runners[j] = p.DisplayName
+		}
+
+		res, ok := finished[run.RunID]
+		s.Finished = ok
+		end := res.Finished
+
+		if !start.IsZero() {
+			if run.SetupResult != nil {
+				t = t.Add(time.Duration(run.SetupResult.Actual * float64(time.Second)))
+			} else {
+				setup, _ := models.ParseEstimate(run.RunInfo.Setup)
+				t = t.Add(setup)
+			}
+			runStart := t
+
+			if ok {
+				// a run can be finished earlier than projected, it mustn't end before it starts
+				if res.Time > 0 {
+					runStart = end.Add(-time.Duration(res.Time * float64(time.Second)))
+				} else if runStart.After(end) {
+					runStart = end
+				}
+			} else {
+				estimate, _ := models.ParseEstimate(run.RunInfo.Estimate)
+				end = runStart.Add(estimate)
+			}
+			s.Start = &runStart
+			s.End = &end
+			t = end
+		}
+
+		scheduled[i] = s
+	}
+
+	return scheduled
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+
+	return t.Format(time.RFC3339)
+}
@@ -0,0 +1,64 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/onestay/MarathonTools-API/api/models"
+)
+
+func TestProject(t *testing.T) {
+	start := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	run := func(estimate, setup string) models.Run {
+		r := models.Run{RunID: primitive.NewObjectID()}
+		r.RunInfo.Estimate = estimate
+		r.RunInfo.Setup = setup
+		return r
+	}
+	runs := []models.Run{run("01:00:00", "00:10:00"), run("00:30:00", "00:05:00"), run("00:20:00", "00:05:00")}
+
+	tests := []struct {
+		name    string
+		results []models.RunResult
+		// starts and ends of the runs in minutes after start
+		starts, ends []float64
+	}{
+		{"estimates", nil, []float64{10, 75, 110}, []float64{70, 105, 130}},
+		{"finished late", []models.RunResult{
+			{RunID: runs[0].RunID, Time: 90 * 60, Finished: start.Add(100 * time.Minute)},
+		}, []float64{10, 105, 140}, []float64{100, 135, 160}},
+		{"finished before the projected start", []models.RunResult{
+			{RunID: runs[0].RunID, Time: 20 * 60, Finished: start.Add(30 * time.Minute)},
+			{RunID: runs[1].RunID, Time: 10 * 60, Finished: start.Add(32 * time.Minute)},
+		}, []float64{10, 22, 37}, []float64{30, 32, 57}},
+		{"finished without a time", []models.RunResult{
+			{RunID: runs[0].RunID, Finished: start.Add(5 * time.Minute)},
+		}, []float64{5, 10, 45}, []float64{5, 40, 65}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scheduled := project(start, runs, tt.results)
+			for i, s := range scheduled {
+				if s.End.Before(*s.Start) {
+					t.Errorf("run %v ends at %v before it starts at %v", i, s.End, s.Start)
+				}
+				if want := start.Add(time.Duration(tt.starts[i] * float64(time.Minute))); !s.Start.Equal(want) {
+					t.Errorf("run %v starts at %v, want %v", i, s.Start, want)
+				}
+				if want := start.Add(time.Duration(tt.ends[i] * float64(time.Minute))); !s.End.Equal(want) {
+					t.Errorf("run %v ends at %v, want %v", i, s.End, want)
+				}
+			}
+		})
+	}
+}
+
+func TestProjectWithoutStart(t *testing.T) {
+	scheduled := project(time.Time{}, []models.Run{{RunID: primitive.NewObjectID()}}, nil)
+	if scheduled[0].Start != nil || scheduled[0].End != nil {
+		t.Error("runs of a schedule without start have times")
+	}
+}
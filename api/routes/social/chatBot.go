@@ -0,0 +1,488 @@
+package social
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/onestay/MarathonTools-API/api/common"
+	"github.com/onestay/MarathonTools-API/api/events"
+	"github.com/onestay/MarathonTools-API/api/models"
+)
+
+// chatServer is the twitch chat server. A tcp:// address is dialed without tls
+var chatServer = "tls://irc.chat.twitch.tv:6697"
+
+const (
+	// chatMessageInterval is the minimum time between two messages of the bot. Twitch drops messages of users which
+	// send more than 20 in 30 seconds
+	chatMessageInterval = 1500 * time.Millisecond
+	// chatCommandCooldown is how long a command isn't answered again after it was answered
+	chatCommandCooldown = 10 * time.Second
+	// chatReconnectDelay is the wait before connecting again after the connection was lost
+	chatReconnectDelay = 10 * time.Second
+	// chatScheduleRuns is how many upcoming runs !schedule lists
+	chatScheduleRuns = 3
+	// chatReadTimeout is how long the connection can be silent before it's considered dead. Twitch sends a PING about
+	// every 5 minutes
+	chatReadTimeout = 6 * time.Minute
+)
+
+// chatScopes are the scopes the token needs for the chat bot
+var chatScopes = []string{"chat:read", "chat:edit"}
+
+// ChatBot posts a message on every run switch and answers commands in the chat of the twitch chat channel. It uses the
+// token of the helix twitch backend and is started and stopped with the chat bot settings
+type ChatBot struct {
+	sc    Controller
+	total func() (float64, bool)
+
+	// sendMu serializes messages so they can be spaced out. It's held while waiting so it's separate from mu
+	sendMu   sync.Mutex
+	lastSent time.Time
+
+	// mu guards all fields below
+	mu sync.Mutex
+	// stop is closed to stop the running bot. It's nil while the bot isn't running
+	stop      chan struct{}
+	conn      net.Conn
+	channel   string
+	login     string
+	connected bool
+	lastErr   string
+	cooldowns map[string]time.Time
+}
+
+// chatStatus is the state of the chat bot
+type chatStatus struct {
+	Enabled   bool   `json:"enabled"`
+	Connected bool   `json:"connected"`
+	Channel   string `json:"channel"`
+	Login     string `json:"login"`
+	Error     string `json:"error,omitempty"`
+}
+
+// NewChatBot creates the chat bot and starts it if it's enabled. total returns the donation total and whether
+// donations are enabled
+func NewChatBot(sc Controller, total func() (float64, bool), router *httprouter.Router) *ChatBot {
+	bot := &ChatBot{
+		sc:        sc,
+		total:     total,
+		cooldowns: make(map[string]time.Time),
+	}
+
+	b := sc.base
+	b.Events.Subscribe(events.SettingsChanged, func(events.Event) {
+		bot.reconcile(false)
+	})
+	b.Events.Subscribe(events.RunSwitched, bot.announceRun)
+	// the token belongs to the marathon so the bot has to log in again
+	b.Marathons.OnSwitch(func(models.Marathon) {
+		go bot.reconcile(true)
+	})
+
+	router.GET("/social/chat/status", bot.GetStatus)
+	router.POST("/social/chat/say", bot.Say)
+
+	bot.reconcile(false)
+
+	return bot
+}
+
+// reconcile starts or stops the bot to match the settings. A running bot is restarted if the channel changed or
+// restart is set
+func (bot *ChatBot) reconcile(restart bool) {
+	s := bot.sc.base.Settings.Get()
+	want := s.ChatBot.Enabled && len(s.Twitch.Chat) != 0
+	// irc channels are lowercase logins, twitch ignores a join with upper case letters
+	channel := strings.ToLower(s.Twitch.Chat)
+
+	bot.mu.Lock()
+	defer bot.mu.Unlock()
+
+	running := bot.stop != nil
+	if running && (!want || restart || bot.channel != channel) {
+		bot.stopLocked()
+		running = false
+	}
+	if want && !running {
+		bot.stop = make(chan struct{})
+		bot.channel = channel
+		bot.lastErr = ""
+		go bot.run(bot.stop, bot.channel)
+	}
+}
+
+// stopLocked stops the running bot. bot.mu has to be held
+func (bot *ChatBot) stopLocked() {
+	close(bot.stop)
+	bot.stop = nil
+	if bot.conn != nil {
+		bot.conn.Close()
+		bot.conn = nil
+	}
+	bot.connected = false
+}
+
+// run keeps the bot connected to channel until stop is closed
+func (bot *ChatBot) run(stop chan struct{}, channel string) {
+	for {
+		err := bot.serve(stop, channel)
+
+		select {
+		case <-stop:
+			return
+		default:
+		}
+
+		bot.mu.Lock()
+		if bot.stop != stop {
+			// stopped in the meantime, the fields belong to the next run already
+			bot.mu.Unlock()
+			return
+		}
+		changed := bot.lastErr != err.Error()
+		bot.lastErr = err.Error()
+		bot.connected = false
+		bot.conn = nil
+		bot.mu.Unlock()
+		// the same error on every reconnect would only spam the clients
+		bot.sc.base.LogError("in the twitch chat bot", err, changed)
+
+		select {
+		case <-stop:
+			return
+		case <-time.After(chatReconnectDelay):
+		}
+	}
+}
+
+// serve connects to the chat of channel and handles messages until the connection is closed
+func (bot *ChatBot) serve(stop chan struct{}, channel string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	login, token, err := bot.sc.twitch().chatToken(ctx)
+	cancel()
+	if err == errNotSupported {
+		return errors.New("the chat bot needs the helix twitch backend")
+	} else if err != nil {
+		return err
+	}
+
+	conn, err := dialChat()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	bot.mu.Lock()
+	select {
+	case <-stop:
+		bot.mu.Unlock()
+		return nil
+	default:
+	}
+	bot.conn = conn
+	bot.login = login
+	bot.mu.Unlock()
+
+	_, err = fmt.Fprintf(conn, "PASS oauth:%v\r\nNICK %v\r\nJOIN %v\r\n", token, login, "#"+strings.ToLower(channel))
+	if err != nil {
+		return err
+	}
+
+	scanner := bufio.NewScanner(conn)
+	for {
+		// a connection which died without being closed is only noticed by the missing PINGs
+		conn.SetReadDeadline(time.Now().Add(chatReadTimeout))
+		if !scanner.Scan() {
+			break
+		}
+		prefix, command, params := parseIRC(scanner.Text())
+		switch command {
+		case "PING":
+			fmt.Fprintf(conn, "PONG :%v\r\n", strings.Join(params, " "))
+		case "NOTICE":
+			// twitch only sends a notice before the join if the login failed
+			bot.mu.Lock()
+			connected := bot.connected
+			bot.mu.Unlock()
+			if !connected && len(params) > 1 {
+				return fmt.Errorf("twitch chat: %v", params[1])
+			}
+		case "JOIN":
+			if strings.EqualFold(ircNick(prefix), login) {
+				bot.mu.Lock()
+				bot.connected = true
+				bot.lastErr = ""
+				bot.mu.Unlock()
+			}
+		case "PRIVMSG":
+			if len(params) > 1 && !strings.EqualFold(ircNick(prefix), login) {
+				bot.command(params[1])
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		if ne, ok := err.(net.Error); ok && ne.Timeout() {
+			return errors.New("twitch chat didn't send anything for " + chatReadTimeout.String())
+		}
+		return err
+	}
+
+	return errors.New("twitch chat closed the connection")
+}
+
+func dialChat() (net.Conn, error) {
+	d := &net.Dialer{Timeout: 10 * time.Second}
+	if addr := strings.TrimPrefix(chatServer, "tcp://"); addr != chatServer {
+		return d.Dial("tcp", addr)
+	}
+
+	return tls.DialWithDialer(d, "tcp", strings.TrimPrefix(chatServer, "tls://"), nil)
+}
+
+// parseIRC splits an irc line into its prefix, command and params. The trailing param is the last one
+func parseIRC(line string) (prefix, command string, params []string) {
+	if strings.HasPrefix(line, "@") {
+		// tags aren't requested but skip them anyway
+		if i := strings.IndexByte(line, ' '); i != -1 {
+			line = line[i+1:]
+		}
+	}
+	if strings.HasPrefix(line, ":") {
+		i := strings.IndexByte(line, ' ')
+		if i == -1 {
+			return line[1:], "", nil
+		}
+		prefix, line = line[1:i], line[i+1:]
+	}
+
+	trailing := ""
+	hasTrailing := false
+	if i := strings.Index(line, " :"); i != -1 {
+		line, trailing, hasTrailing = line[:i], line[i+2:], true
+	} else if strings.HasPrefix(line, ":") {
+		line, trailing, hasTrailing = "", line[1:], true
+	}
+
+	fields := strings.Fields(line)
+	if len(fields) != 0 {
+		command, params = fields[0], fields[1:]
+	}
+	if hasTrailing {
+		params = append(params, trailing)
+	}
+
+	return prefix, command, params
+}
+
+// ircNick returns the nick of a prefix like nick!user@host
+func ircNick(prefix string) string {
+	if i := strings.IndexByte(prefix, '!'); i != -1 {
+		return prefix[:i]
+	}
+
+	return prefix
+}
+
+// command answers a chat message if it's a command and the command isn't on cooldown
+func (bot *ChatBot) command(message string) {
+	if !bot.sc.base.Settings.Get().ChatBot.Commands {
+		return
+	}
+	fields := strings.Fields(message)
+	if len(fields) == 0 || !strings.HasPrefix(fields[0], "!") {
+		return
+	}
+	name := strings.ToLower(fields[0])
+
+	var answer func() string
+	switch name {
+	case "!runner", "!runners":
+		answer = bot.runnerAnswer
+	case "!schedule":
+		answer = bot.scheduleAnswer
+	case "!total":
+		answer = bot.totalAnswer
+	case "!incentive", "!incentives":
+		answer = bot.incentiveAnswer
+	default:
+		return
+	}
+
+	bot.mu.Lock()
+	if time.Now().Before(bot.cooldowns[name]) {
+		bot.mu.Unlock()
+		return
+	}
+	bot.cooldowns[name] = time.Now().Add(chatCommandCooldown)
+	bot.mu.Unlock()
+
+	common.Debugf("Answering chat command %v", name)
+	if err := bot.say(answer()); err != nil {
+		bot.sc.base.LogError("while answering a chat command", err, false)
+	}
+}
+
+func (bot *ChatBot) runnerAnswer() string {
+	run := bot.sc.base.State.CurrentRun()
+	if len(run.Players) == 0 {
+		return "There is no run right now"
+	}
+
+	players := make([]string, len(run.Players))
+	for i, p := range run.Players {
+		players[i] = p.DisplayName
+		if len(p.TwitchName) != 0 {
+			players[i] += " (twitch.tv/" + p.TwitchName + ")"
+		}
+	}
+
+	return fmt.Sprintf("%v is run by %v", run.GameInfo.GameName, strings.Join(players, ", "))
+}
+
+func (bot *ChatBot) scheduleAnswer() string {
+	runs, err := bot.sc.base.Storage.Runs.All(context.Background())
+	if err != nil {
+		bot.sc.base.LogError("while getting runs for the chat", err, false)
+		return "Couldn't get the schedule"
+	}
+	i := bot.sc.base.State.RunIndex()
+	if i < 0 || i >= len(runs) {
+		return "The schedule is over"
+	}
+
+	answer := "Now: " + runs[i].GameInfo.GameName + " (" + runs[i].RunInfo.Category + ")"
+	var next []string
+	for _, r := range runs[i+1:] {
+		if len(next) == chatScheduleRuns {
+			break
+		}
+		next = append(next, fmt.Sprintf("%v (%v, est. %v)", r.GameInfo.GameName, r.RunInfo.Category, r.RunInfo.Estimate))
+	}
+	if len(next) == 0 {
+		return answer + ". This is the last run!"
+	}
+
+	return answer + ". Next: " + strings.Join(next, ", ")
+}
+
+func (bot *ChatBot) totalAnswer() string {
+	total, enabled := bot.total()
+	if !enabled {
+		return "Donations aren't tracked for this marathon"
+	}
+
+	return fmt.Sprintf("%v%.2f raised so far", bot.sc.base.Settings.Get().General.Currency, total)
+}
+
+func (bot *ChatBot) incentiveAnswer() string {
+	incentive := bot.sc.base.Settings.Get().ChatBot.Incentive
+	if len(incentive) == 0 {
+		return "There are no incentives right now"
+	}
+
+	return incentive
+}
+
+// announceRun posts the run message for the new run
+func (bot *ChatBot) announceRun(e events.Event) {
+	s := bot.sc.base.Settings.Get().ChatBot
+	if !s.Enabled || len(s.RunMessage) == 0 || e.Run == nil {
+		return
+	}
+
+	message, err := bot.sc.executeRunTemplate(s.RunMessage, e.Run)
+	if err != nil {
+		bot.sc.base.LogError("while executing the chat run message", err, true)
+		return
+	}
+	if err := bot.say(message); err != nil {
+		bot.sc.base.LogError("while announcing the run in chat", err, false)
+	}
+}
+
+// say sends message to the chat. Messages are spaced by chatMessageInterval
+func (bot *ChatBot) say(message string) error {
+	message = strings.Join(strings.Fields(message), " ")
+	if r := []rune(message); len(r) > models.MaxChatMessageLength {
+		message = string(r[:models.MaxChatMessageLength])
+	}
+	if len(message) == 0 {
+		return nil
+	}
+
+	bot.sendMu.Lock()
+	defer bot.sendMu.Unlock()
+	if wait := time.Until(bot.lastSent.Add(chatMessageInterval)); wait > 0 {
+		time.Sleep(wait)
+	}
+
+	bot.mu.Lock()
+	conn, channel, connected := bot.conn, bot.channel, bot.connected
+	bot.mu.Unlock()
+	if !connected {
+		return errors.New("chat bot isn't connected")
+	}
+	bot.lastSent = time.Now()
+
+	conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	_, err := fmt.Fprintf(conn, "PRIVMSG #%v :%v\r\n", channel, message)
+	return err
+}
+
+// GetStatus returns whether the bot is connected and the last error
+func (bot *ChatBot) GetStatus(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	bot.mu.Lock()
+	status := chatStatus{
+		Enabled:   bot.stop != nil,
+		Connected: bot.connected,
+		Channel:   bot.channel,
+		Login:     bot.login,
+		Error:     bot.lastErr,
+	}
+	bot.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
+
+// Say posts the message in the body to the chat
+func (bot *ChatBot) Say(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	body := struct {
+		Message string `json:"message"`
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		bot.sc.base.Response("", "invalid body", http.StatusBadRequest, w)
+		return
+	}
+	if len(strings.TrimSpace(body.Message)) == 0 {
+		bot.sc.base.Response("", "message is required", http.StatusBadRequest, w)
+		return
+	}
+
+	bot.mu.Lock()
+	connected := bot.connected
+	bot.mu.Unlock()
+	if !connected {
+		bot.sc.base.Response("", "chat bot isn't connected", http.StatusConflict, w)
+		return
+	}
+
+	if err := bot.say(body.Message); err != nil {
+		bot.sc.base.Response("", err.Error(), http.StatusInternalServerError, w)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
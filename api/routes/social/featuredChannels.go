@@ -11,13 +11,14 @@ const FeaturedChannelsUrl = "https://api.furious.pro/featuredchannels/bot"
 
 func (sc Controller) UpdateFeaturedChannels() error {
 	// TODO: Add a setting for this key
-	if sc.featuredChannelsKey == "" {
+	if sc.featuredChannelsKey() == "" {
 		return nil
 	}
 
-	players := make([]string, len(sc.base.CurrentRun.Players))
+	currentRun := sc.base.State.CurrentRun()
+	players := make([]string, len(currentRun.Players))
 
-	for i, player := range sc.base.CurrentRun.Players {
+	for i, player := range currentRun.Players {
 		if len(player.TwitchName) != 0 {
 			players[i] = player.TwitchName
 		} else {
@@ -27,7 +28,7 @@ func (sc Controller) UpdateFeaturedChannels() error {
 
 	playersString := strings.Join(players, ",")
 
-	reqUrl, err := url.Parse(FeaturedChannelsUrl + "/" + sc.featuredChannelsKey + "/" + playersString)
+	reqUrl, err := url.Parse(FeaturedChannelsUrl + "/" + sc.featuredChannelsKey() + "/" + playersString)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,481 @@
+package social
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/onestay/MarathonTools-API/api/models"
+	"github.com/onestay/MarathonTools-API/api/storage"
+)
+
+var (
+	// twitchOAuthURL and helixURL are the base urls of the twitch apis
+	twitchOAuthURL = "https://id.twitch.tv/oauth2"
+	helixURL       = "https://api.twitch.tv/helix"
+)
+
+// stateTTL is how long a user has to authorize the API after requesting the authorization url
+const stateTTL = 10 * time.Minute
+
+// helixTwitch does the oauth flow itself and calls helix directly. Tokens are stored per marathon
+type helixTwitch struct {
+	// info returns the current client credentials since they can be reloaded
+	info    func() *twitchInfo
+	client  *http.Client
+	storage storage.Backend
+	// mu serializes token refreshes and guards states
+	mu sync.Mutex
+	// states maps the state of a pending authorization to the marathon it was started for
+	states map[string]oauthState
+}
+
+type oauthState struct {
+	marathon string
+	expires  time.Time
+}
+
+func newHelixTwitch(info func() *twitchInfo, client *http.Client, b storage.Backend) *helixTwitch {
+	return &helixTwitch{
+		info:    info,
+		client:  client,
+		storage: b,
+		states:  make(map[string]oauthState),
+	}
+}
+
+func (h *helixTwitch) authorized(ctx context.Context) (bool, error) {
+	_, err := h.storage.Social.TwitchToken(ctx)
+	if err == storage.ErrNotFound {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+func (h *helixTwitch) authURL() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	state := hex.EncodeToString(b)
+
+	h.mu.Lock()
+	now := time.Now()
+	for s, o := range h.states {
+		if now.After(o.expires) {
+			delete(h.states, s)
+		}
+	}
+	h.states[state] = oauthState{marathon: h.storage.Active.ID(), expires: now.Add(stateTTL)}
+	h.mu.Unlock()
+
+	q := url.Values{
+		"response_type": {"code"},
+		"client_id":     {h.info().ClientID},
+		"redirect_uri":  {h.info().RedirectURI},
+		"scope":         {h.info().Scope},
+		"state":         {state},
+	}
+
+	return twitchOAuthURL + "/authorize?" + q.Encode(), nil
+}
+
+func (h *helixTwitch) authorize(ctx context.Context, code, state string) error {
+	h.mu.Lock()
+	o, ok := h.states[state]
+	delete(h.states, state)
+	h.mu.Unlock()
+	if !ok || time.Now().After(o.expires) {
+		return errors.New("unknown or expired state")
+	}
+
+	t, err := h.requestToken(ctx, url.Values{
+		"grant_type":   {"authorization_code"},
+		"code":         {code},
+		"redirect_uri": {h.info().RedirectURI},
+	})
+	if err != nil {
+		return err
+	}
+
+	var user struct {
+		Login  string `json:"login"`
+		UserID string `json:"user_id"`
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", twitchOAuthURL+"/validate", nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "OAuth "+t.AccessToken)
+	if err := h.send(req, &user); err != nil {
+		return err
+	}
+	t.Login = user.Login
+	t.UserID = user.UserID
+
+	// twitch only lets the broadcaster update the channel and play commercials
+	b := h.storage.Event(o.marathon)
+	settings, err := b.Settings.Get(ctx)
+	if err != nil && err != storage.ErrNotFound {
+		return err
+	}
+	if channel := settings.Twitch.UpdateChannel; len(channel) != 0 && !strings.EqualFold(channel, t.Login) {
+		return fmt.Errorf("the update channel is %v but %v authorized the API. Authorize with the account of %v", channel, t.Login, channel)
+	}
+
+	return b.Social.SaveTwitchToken(ctx, t)
+}
+
+// requestToken gets a token from the token endpoint with the grant in params
+func (h *helixTwitch) requestToken(ctx context.Context, params url.Values) (models.TwitchToken, error) {
+	params.Set("client_id", h.info().ClientID)
+	params.Set("client_secret", h.info().ClientSecret)
+
+	req, err := http.NewRequestWithContext(ctx, "POST", twitchOAuthURL+"/token", strings.NewReader(params.Encode()))
+	if err != nil {
+		return models.TwitchToken{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	var res TwitchResponse
+	if err := h.send(req, &res); err != nil {
+		return models.TwitchToken{}, err
+	}
+
+	return models.TwitchToken{
+		AccessToken:  res.AccessToken,
+		RefreshToken: res.RefreshToken,
+		Expires:      time.Now().Add(time.Duration(res.ExpiresIn) * time.Second),
+		Scope:        res.Scope,
+	}, nil
+}
+
+// token returns the token of the active marathon. It's refreshed if it expires soon or force is set
+func (h *helixTwitch) token(ctx context.Context, force bool) (models.TwitchToken, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	t, err := h.storage.Social.TwitchToken(ctx)
+	if err == storage.ErrNotFound {
+		return t, errNotAuthorized
+	} else if err != nil {
+		return t, err
+	}
+	if !force && time.Until(t.Expires) > time.Minute {
+		return t, nil
+	}
+
+	refreshed, err := h.requestToken(ctx, url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {t.RefreshToken},
+	})
+	if err != nil {
+		return t, fmt.Errorf("couldn't refresh twitch token: %v", err)
+	}
+	refreshed.Login = t.Login
+	refreshed.UserID = t.UserID
+
+	return refreshed, h.storage.Social.SaveTwitchToken(ctx, refreshed)
+}
+
+// helix does a request to the helix api. body is sent as json and the response is decoded into res if they aren't nil.
+// A rejected token is refreshed once
+func (h *helixTwitch) helix(ctx context.Context, method, path string, query url.Values, body, res interface{}) error {
+	var data []byte
+	if body != nil {
+		var err error
+		data, err = json.Marshal(body)
+		if err != nil {
+			return err
+		}
+	}
+
+	for retry := false; ; retry = true {
+		t, err := h.token(ctx, retry)
+		if err != nil {
+			return err
+		}
+
+		req, err := http.NewRequestWithContext(ctx, method, helixURL+path+"?"+query.Encode(), bytes.NewReader(data))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Bearer "+t.AccessToken)
+		req.Header.Set("Client-Id", h.info().ClientID)
+		if body != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+
+		err = h.send(req, res)
+		if e, ok := err.(twitchError); ok && e.Status == http.StatusUnauthorized && !retry {
+			continue
+		}
+		return err
+	}
+}
+
+// twitchError is the error body of the twitch apis
+type twitchError struct {
+	Status  int    `json:"status"`
+	Message string `json:"message"`
+}
+
+func (e twitchError) Error() string {
+	return fmt.Sprintf("twitch returned %v: %v", e.Status, e.Message)
+}
+
+// send does the request and decodes the response into res if it isn't nil
+func (h *helixTwitch) send(req *http.Request, res interface{}) error {
+	r, err := h.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer r.Body.Close()
+
+	if r.StatusCode < 200 || r.StatusCode > 299 {
+		e := twitchError{}
+		json.NewDecoder(r.Body).Decode(&e)
+		e.Status = r.StatusCode
+		return e
+	}
+	if res == nil || r.StatusCode == http.StatusNoContent {
+		return nil
+	}
+
+	return json.NewDecoder(r.Body).Decode(res)
+}
+
+// broadcasterID returns the user id of login. An empty login is the account which authorized the API
+func (h *helixTwitch) broadcasterID(ctx context.Context, login string) (string, error) {
+	if len(login) == 0 {
+		t, err := h.token(ctx, false)
+		return t.UserID, err
+	}
+
+	var res struct {
+		Data []struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	err := h.helix(ctx, "GET", "/users", url.Values{"login": {login}}, nil, &res)
+	if err != nil {
+		return "", err
+	}
+	if len(res.Data) == 0 {
+		return "", fmt.Errorf("twitch channel %v doesn't exist", login)
+	}
+
+	return res.Data[0].ID, nil
+}
+
+// helixCategory is a category in the responses of the games and search endpoints
+type helixCategory struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	BoxArtURL string `json:"box_art_url"`
+}
+
+func (c helixCategory) model() models.TwitchCategory {
+	return models.TwitchCategory{ID: c.ID, Name: c.Name, BoxArtURL: c.BoxArtURL}
+}
+
+func (h *helixTwitch) resolveCategory(ctx context.Context, name string) (models.TwitchCategory, error) {
+	var res struct {
+		Data []helixCategory `json:"data"`
+	}
+	err := h.helix(ctx, "GET", "/games", url.Values{"name": {name}}, nil, &res)
+	if err != nil {
+		return models.TwitchCategory{}, err
+	}
+	if len(res.Data) == 0 {
+		return models.TwitchCategory{}, errNoCategory
+	}
+	c := res.Data[0].model()
+	if len(c.Name) == 0 {
+		c.Name = name
+	}
+
+	return c, nil
+}
+
+func (h *helixTwitch) searchCategories(ctx context.Context, query string) ([]models.TwitchCategory, error) {
+	var res struct {
+		Data []helixCategory `json:"data"`
+	}
+	err := h.helix(ctx, "GET", "/search/categories", url.Values{"query": {query}, "first": {"20"}}, nil, &res)
+	if err != nil {
+		return nil, err
+	}
+
+	categories := make([]models.TwitchCategory, len(res.Data))
+	for i, c := range res.Data {
+		categories[i] = c.model()
+	}
+
+	return categories, nil
+}
+
+// ownChannelID returns the user id of login if it's the account which authorized the API. An empty login is that account.
+// It's used for the calls only the broadcaster can do
+func (h *helixTwitch) ownChannelID(ctx context.Context, login string) (string, error) {
+	t, err := h.token(ctx, false)
+	if err != nil {
+		return "", err
+	}
+	if len(login) != 0 && !strings.EqualFold(login, t.Login) {
+		return "", fmt.Errorf("only %v can update the channel, but %v authorized the API. Authorize twitch again with the account of %v", login, t.Login, login)
+	}
+
+	return t.UserID, nil
+}
+
+// updateInfo only updates the title if the category hasn't been resolved
+func (h *helixTwitch) updateInfo(ctx context.Context, login, title string, category models.TwitchCategory) error {
+	id, err := h.ownChannelID(ctx, login)
+	if err != nil {
+		return err
+	}
+
+	body := map[string]string{"title": title}
+	if len(category.ID) != 0 {
+		body["game_id"] = category.ID
+	}
+
+	return h.helix(ctx, "PATCH", "/channels", url.Values{"broadcaster_id": {id}}, body, nil)
+}
+
+func (h *helixTwitch) commercial(ctx context.Context, login string, length int) error {
+	id, err := h.ownChannelID(ctx, login)
+	if err != nil {
+		return err
+	}
+
+	body := struct {
+		BroadcasterID string `json:"broadcaster_id"`
+		Length        int    `json:"length"`
+	}{id, length}
+
+	return h.helix(ctx, "POST", "/channels/commercial", nil, body, nil)
+}
+
+func (h *helixTwitch) revoke(ctx context.Context) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	t, err := h.storage.Social.TwitchToken(ctx)
+	if err == storage.ErrNotFound {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	params := url.Values{"client_id": {h.info().ClientID}, "token": {t.AccessToken}}
+	req, err := http.NewRequestWithContext(ctx, "POST", twitchOAuthURL+"/revoke", strings.NewReader(params.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	// an invalid token doesn't have to be revoked anymore
+	err = h.send(req, nil)
+	if e, ok := err.(twitchError); err != nil && !(ok && e.Status == http.StatusBadRequest) {
+		return err
+	}
+
+	return h.storage.Social.DeleteTwitchToken(ctx)
+}
+
+// chatToken fails if the token is missing a chat scope since twitch only tells by dropping the connection
+func (h *helixTwitch) chatToken(ctx context.Context) (string, string, error) {
+	t, err := h.token(ctx, false)
+	if err != nil {
+		return "", "", err
+	}
+
+	var missing []string
+	for _, scope := range chatScopes {
+		if !hasScope(t.Scope, scope) {
+			missing = append(missing, scope)
+		}
+	}
+	if len(missing) != 0 {
+		return "", "", fmt.Errorf("the twitch token of %v is missing the scopes %v. Authorize twitch again to grant them", t.Login, strings.Join(missing, ", "))
+	}
+
+	return t.Login, t.AccessToken, nil
+}
+
+func hasScope(scopes []string, scope string) bool {
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (h *helixTwitch) streamStart(ctx context.Context, login string) (time.Time, error) {
+	if len(login) == 0 {
+		t, err := h.token(ctx, false)
+		if err != nil {
+			return time.Time{}, err
+		}
+		login = t.Login
+	}
+
+	var res struct {
+		Data []struct {
+			StartedAt time.Time `json:"started_at"`
+		} `json:"data"`
+	}
+	err := h.helix(ctx, "GET", "/streams", url.Values{"user_login": {login}}, nil, &res)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if len(res.Data) == 0 {
+		return time.Time{}, errOffline
+	}
+
+	return res.Data[0].StartedAt, nil
+}
+
+// createMarker fails if the channel isn't live or the account which authorized the API isn't an editor of it
+func (h *helixTwitch) createMarker(ctx context.Context, login, description string) (string, int, error) {
+	id, err := h.broadcasterID(ctx, login)
+	if err != nil {
+		return "", 0, err
+	}
+
+	body := struct {
+		UserID      string `json:"user_id"`
+		Description string `json:"description"`
+	}{id, description}
+	var res struct {
+		Data []struct {
+			ID              string `json:"id"`
+			PositionSeconds int    `json:"position_seconds"`
+		} `json:"data"`
+	}
+	err = h.helix(ctx, "POST", "/streams/markers", nil, body, &res)
+	if e, ok := err.(twitchError); ok && e.Status == http.StatusNotFound {
+		return "", 0, errOffline
+	} else if err != nil {
+		return "", 0, err
+	}
+	if len(res.Data) == 0 {
+		return "", 0, errors.New("twitch didn't return the created marker")
+	}
+
+	return res.Data[0].ID, res.Data[0].PositionSeconds, nil
+}
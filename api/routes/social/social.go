@@ -1,12 +1,15 @@
 package social
 
 import (
+	"context"
 	"encoding/json"
-	"fmt"
 	"net/http"
+	"sync"
 
 	"github.com/julienschmidt/httprouter"
 	"github.com/onestay/MarathonTools-API/api/common"
+	"github.com/onestay/MarathonTools-API/api/events"
+	"github.com/onestay/MarathonTools-API/api/storage"
 
 	"github.com/dghubble/oauth1"
 	"github.com/dghubble/oauth1/twitter"
@@ -14,13 +17,78 @@ import (
 
 // Controller holds all the info and methods
 type Controller struct {
+	base *common.Controller
+	// conf is shared by all copies of the controller so a reload reaches every one of them
+	conf *socialConf
+	// markerMu serializes recording vod markers
+	markerMu *sync.Mutex
+}
+
+// socialConf holds the credentials from the config file. They're replaced as a whole on reload and never modified
+type socialConf struct {
+	mu                  sync.RWMutex
 	twitchInfo          *twitchInfo
+	twitchBackend       string
+	twitch              twitchBackend
 	twitterInfo         *oauth1.Config
-	base                *common.Controller
 	socialAuth          *socialAuthInfo
 	featuredChannelsKey string
 }
 
+// set replaces the credentials. The helix backend is kept if it stays selected so pending authorizations aren't lost.
+// c.mu has to be held
+func (c *socialConf) set(twitchClientID, twitchClientSecret, twitchCallback, twitterKey, twitterSecret, twitterCallback, socialAuthURL, socialAuthKey, featuredChannelsKey, twitchBackend string, b *common.Controller) {
+	c.twitchInfo = &twitchInfo{
+		ClientID:     twitchClientID,
+		ClientSecret: twitchClientSecret,
+		Scope:        "channel:edit:commercial channel:manage:broadcast chat:read chat:edit",
+		RedirectURI:  twitchCallback,
+	}
+	c.twitterInfo = &oauth1.Config{
+		ConsumerKey:    twitterKey,
+		ConsumerSecret: twitterSecret,
+		CallbackURL:    twitterCallback,
+		Endpoint:       twitter.AuthorizeEndpoint,
+	}
+	c.socialAuth = &socialAuthInfo{
+		url: socialAuthURL,
+		key: socialAuthKey,
+	}
+	c.featuredChannelsKey = featuredChannelsKey
+
+	if twitchBackend == "socialAuth" {
+		c.twitch = socialAuthTwitch{c.socialAuth, &b.HTTPClient}
+	} else if c.twitch == nil || c.twitchBackend == "socialAuth" {
+		c.twitch = newHelixTwitch(c.info, &b.HTTPClient, b.Storage)
+	}
+	c.twitchBackend = twitchBackend
+}
+
+func (c *socialConf) info() *twitchInfo {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.twitchInfo
+}
+
+// twitch returns the configured twitch backend
+func (sc Controller) twitch() twitchBackend {
+	sc.conf.mu.RLock()
+	defer sc.conf.mu.RUnlock()
+	return sc.conf.twitch
+}
+
+func (sc Controller) socialAuth() *socialAuthInfo {
+	sc.conf.mu.RLock()
+	defer sc.conf.mu.RUnlock()
+	return sc.conf.socialAuth
+}
+
+func (sc Controller) featuredChannelsKey() string {
+	sc.conf.mu.RLock()
+	defer sc.conf.mu.RUnlock()
+	return sc.conf.featuredChannelsKey
+}
+
 type twitchInfo struct {
 	ClientID     string
 	ClientSecret string
@@ -34,16 +102,21 @@ type socialAuthAvailResponse struct {
 }
 
 func (sc Controller) checkSocialAuth() (*socialAuthAvailResponse, error) {
+	return sc.socialAuth().avail(&sc.base.HTTPClient)
+}
+
+// avail asks the social auth service for which services it has authentication data
+func (s *socialAuthInfo) avail(client *http.Client) (*socialAuthAvailResponse, error) {
 	// TODO: make this into a setting
-	url := sc.socialAuth.url + "/api/v1/avail"
+	url := s.url + "/api/v1/avail"
 	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
 		return nil, err
 	}
 
-	req.Header.Add("Authorization", sc.socialAuth.key)
+	req.Header.Add("Authorization", s.key)
 
-	res, err := sc.base.HTTPClient.Do(req)
+	res, err := client.Do(req)
 	if err != nil {
 		return nil, err
 	}
@@ -73,12 +146,21 @@ type AuthErrorResponse struct {
 
 func (sc Controller) registerRoutes(r *httprouter.Router) {
 	r.GET("/social/twitch/verify", sc.TwitchCheckForAuth)
+	r.GET("/social/twitch/auth", sc.TwitchAuth)
+	r.GET("/social/twitch/callback", sc.TwitchCallback)
 	r.DELETE("/social/twitch/token", sc.TwitchDeleteToken)
 	r.GET("/social/twitch/executetemplate", sc.TwitchExecuteTemplate)
 	r.PUT("/social/twitch/update", sc.TwitchUpdateInfo)
 	r.PUT("/social/twitch/settings", sc.TwitchSetSettings)
 	r.GET("/social/twitch/settings", sc.TwitchGetSettings)
 	r.POST("/social/twitch/commercial", sc.TwitchPlayCommercial)
+	r.GET("/social/twitch/categories", sc.TwitchSearchCategories)
+	r.POST("/social/twitch/category/:id", sc.TwitchResolveCategory)
+	r.DELETE("/social/twitch/category/:id", sc.TwitchClearCategory)
+	r.GET("/social/twitch/preview/:id", sc.TwitchPreview)
+	r.GET("/social/twitch/markers", sc.TwitchGetMarkers)
+	r.DELETE("/social/twitch/markers", sc.TwitchDeleteMarkers)
+	r.GET("/social/twitch/chapters", sc.TwitchChapters)
 
 	r.GET("/social/twitter/verify", sc.TwitterCheckForAuth)
 	r.DELETE("/social/twitter/token", sc.TwitterDeleteToken)
@@ -91,58 +173,49 @@ func (sc Controller) registerRoutes(r *httprouter.Router) {
 
 }
 
-// NewSocialController will return a new social controller
-func NewSocialController(twitchClientID, twitchClientSecret, twitchCallback, twitterKey, twitterSecret, twitterCallback, socialAuthURL, socialAuthKey, featuredChannelsKey string, b *common.Controller, router *httprouter.Router) {
-	t := &twitchInfo{
-		ClientID:     twitchClientID,
-		ClientSecret: twitchClientSecret,
-		Scope:        "channel:edit:commercial channel:manage:broadcast",
-		RedirectURI:  twitchCallback,
-	}
-
-	tw := &oauth1.Config{
-		ConsumerKey:    twitterKey,
-		ConsumerSecret: twitterSecret,
-		CallbackURL:    twitterCallback,
-		Endpoint:       twitter.AuthorizeEndpoint,
-	}
-
+// NewSocialController will return a new social controller. twitchBackend is either helix to call twitch directly or
+// socialAuth to go through the social auth service
+func NewSocialController(twitchClientID, twitchClientSecret, twitchCallback, twitterKey, twitterSecret, twitterCallback, socialAuthURL, socialAuthKey, featuredChannelsKey, twitchBackend string, b *common.Controller, router *httprouter.Router) Controller {
 	c := Controller{
-		twitchInfo:  t,
-		base:        b,
-		twitterInfo: tw,
-		socialAuth: &socialAuthInfo{
-			url: socialAuthURL,
-			key: socialAuthKey,
-		},
-		featuredChannelsKey: featuredChannelsKey,
+		base:     b,
+		conf:     &socialConf{},
+		markerMu: &sync.Mutex{},
 	}
+	c.conf.set(twitchClientID, twitchClientSecret, twitchCallback, twitterKey, twitterSecret, twitterCallback, socialAuthURL, socialAuthKey, featuredChannelsKey, twitchBackend, b)
 
-	go c.comReceiver()
+	c.registerActions()
 
 	c.registerRoutes(router)
+
+	return c
+}
+
+// Reload replaces the credentials and the twitch backend with the ones of a reloaded config file. The arguments are
+// the ones of NewSocialController
+func (sc Controller) Reload(twitchClientID, twitchClientSecret, twitchCallback, twitterKey, twitterSecret, twitterCallback, socialAuthURL, socialAuthKey, featuredChannelsKey, twitchBackend string) {
+	sc.conf.mu.Lock()
+	defer sc.conf.mu.Unlock()
+	sc.conf.set(twitchClientID, twitchClientSecret, twitchCallback, twitterKey, twitterSecret, twitterCallback, socialAuthURL, socialAuthKey, featuredChannelsKey, twitchBackend, sc.base)
 }
 
-func (sc Controller) comReceiver() {
-	for {
-		i := <-sc.base.SocialUpdatesChan
-		if i == 1 {
-			err := sc.twitchUpdateInfo()
-			if err != nil {
-				sc.base.LogError("while updating twitch info", err, true)
-			}
-		} else if i == 2 {
-			err := sc.twitterSendUpdate()
-			if err != nil {
-				sc.base.LogError("while sending tweet update", err, true)
-			}
-		} else if i == 0 {
-			fmt.Println(i)
-		} else if i == 0x50 {
-			err := sc.UpdateFeaturedChannels()
-			if err != nil {
-				sc.base.LogError("while updating featured channels", err, true)
-			}
+// registerActions makes the social updates available to automation rules
+func (sc Controller) registerActions() {
+	a := sc.base.Automation
+	a.RegisterAction("twitch.updateInfo", "Update title and game of the twitch update channel if twitch updates are enabled", func(events.Event) error {
+		return sc.twitchUpdateInfo()
+	})
+	a.RegisterAction("twitter.sendUpdate", "Tweet the template for the current run if tweets are enabled", func(events.Event) error {
+		ts, err := sc.base.Storage.Social.TwitterSettings(context.Background())
+		if err == storage.ErrNotFound || (err == nil && !ts.SendTweets) {
+			return nil
+		} else if err != nil {
+			return err
 		}
-	}
+
+		return sc.twitterSendUpdate()
+	})
+	a.RegisterAction("twitch.featuredChannels", "Feature the channels of the runners of the current run", func(events.Event) error {
+		return sc.UpdateFeaturedChannels()
+	})
+	a.RegisterAction("twitch.marker", "Create a twitch stream marker for the run and record its position in the vod", sc.recordMarker)
 }
@@ -0,0 +1,26 @@
+package social
+
+import (
+	"strings"
+
+	"github.com/onestay/MarathonTools-API/api/models"
+)
+
+// templateTeam is the team info made available to the twitch and twitter templates
+type templateTeam struct {
+	Name   string
+	Color  string
+	Runner []models.PlayerInfo
+}
+
+// templateTeams returns the teams of a run and a string like "Team A vs Team B" for use in templates
+func templateTeams(r *models.Run) ([]templateTeam, string) {
+	teams := make([]templateTeam, len(r.Teams))
+	names := make([]string, len(r.Teams))
+	for i, t := range r.Teams {
+		teams[i] = templateTeam{t.Name, t.Color, r.TeamPlayers(i)}
+		names[i] = t.Name
+	}
+
+	return teams, strings.Join(names, " vs ")
+}
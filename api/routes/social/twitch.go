@@ -2,26 +2,24 @@ package social
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
 	"net/http"
-	"net/url"
-	"strconv"
 	"text/template"
 	"time"
 
-	"github.com/go-redis/redis"
-
 	"github.com/onestay/MarathonTools-API/api/models"
+	"github.com/onestay/MarathonTools-API/api/storage"
 
 	"github.com/julienschmidt/httprouter"
 )
 
 // TODO: add the channel id to the twitch settings so user can specify channel id. Defaults to authenticated user channel id
 
-// TwitchResponse is the response returned from the twitch servers for a access token
+// TwitchResponse is the response returned from the twitch token endpoint
 type TwitchResponse struct {
 	AccessToken  string   `json:"access_token" bson:"accessToken"`
 	RefreshToken string   `json:"refresh_token" bson:"refreshToken"`
@@ -37,25 +35,14 @@ type twitchTitleOptions struct {
 	Platform string
 	Estimate string
 	Category string
+	Teams    []templateTeam
+	Versus   string
+	// Commentators are the commentators of the run and Host is the current host. Host is empty if nobody is hosting
+	Commentators []models.Person
+	Host         models.Person
 }
 
 func (sc Controller) twitchUpdateInfo() error {
-	client := http.Client{}
-
-	title := sc.twitchExecuteTemplate()
-	game := sc.base.CurrentRun.GameInfo.GameName
-
-	uri, err := url.Parse(sc.socialAuth.url + "/api/v1/twitch/update")
-	if err != nil {
-		return err
-	}
-
-	type Body struct {
-		Game  string `json:"game"`
-		Title string `json:"title"`
-		Login string `json:"login"`
-	}
-
 	ts, err := sc.twitchGetSettings()
 	if err != nil {
 		return err
@@ -65,36 +52,21 @@ func (sc Controller) twitchUpdateInfo() error {
 		log.Println("twitchUpdateInfo called but twitch updates disabled in settings")
 		return nil
 	}
-	body := Body{
-		Game:  game,
-		Title: title,
-		Login: sc.base.Settings.S.TwitchUpdateChannel,
-	}
-
-	result, err := json.Marshal(body)
-	if err != nil {
-		return err
-	}
 
-	req, err := http.NewRequest("POST", uri.String(), bytes.NewReader(result))
-	if err != nil {
-		return err
+	ctx := context.Background()
+	run := sc.base.State.CurrentRun()
+	title := sc.twitchTemplate(&run)
+	category, catErr := sc.twitchCategory(ctx, run)
+	if catErr != nil && catErr != errNoCategory {
+		return catErr
 	}
 
-	req.Header.Add("Authorization", sc.socialAuth.key)
-
-	res, err := client.Do(req)
+	err = sc.twitch().updateInfo(ctx, sc.base.Settings.Get().Twitch.UpdateChannel, title, category)
 	if err != nil {
 		return err
 	}
-
-	if res.StatusCode != 204 {
-		errRes := AuthErrorResponse{}
-		err = json.NewDecoder(res.Body).Decode(&errRes)
-		if err != nil {
-			return fmt.Errorf("error decoding error body into SocialAuthErrorResponse")
-		}
-		return fmt.Errorf("non 204 status code returned from social auth. got: %v (%v) message: %v", errRes.Status, errRes.Error, errRes.Message)
+	if catErr == errNoCategory {
+		return fmt.Errorf("title updated but there is no twitch category named %v", category.Name)
 	}
 
 	return nil
@@ -127,44 +99,52 @@ func (sc Controller) TwitchExecuteTemplate(w http.ResponseWriter, _ *http.Reques
 }
 
 func (sc Controller) twitchExecuteTemplate() string {
-	currentRun := sc.base.CurrentRun
-	c := twitchTitleOptions{currentRun.GameInfo.GameName, currentRun.Players, currentRun.RunInfo.Platform, currentRun.RunInfo.Estimate, currentRun.RunInfo.Category}
+	currentRun := sc.base.State.CurrentRun()
+	return sc.twitchTemplate(&currentRun)
+}
 
-	res, err := sc.base.RedisClient.Get("twitchSettings").Bytes()
+// twitchTemplate executes the title template for run
+func (sc Controller) twitchTemplate(run *models.Run) string {
+	ts, err := sc.base.Storage.Social.TwitchSettings(context.Background())
 	if err != nil {
-		if err == redis.Nil {
+		if err == storage.ErrNotFound {
 			return "NOTEMPLATE"
 		}
-		sc.base.LogError("error while getting twitch settings from redis", err, true)
+		sc.base.LogError("error while getting twitch settings", err, true)
 		return "ERROR"
 	}
 
-	ts := TwitchSettings{}
+	res, err := sc.executeRunTemplate(ts.TemplateString, run)
+	if err != nil {
+		sc.base.LogError("while executing template", err, true)
+		return "ERROR"
+	}
+
+	return res
+}
 
-	json.Unmarshal(res, &ts)
+// executeRunTemplate executes text with the fields of the twitch title for run
+func (sc Controller) executeRunTemplate(text string, run *models.Run) (string, error) {
+	teams, versus := templateTeams(run)
+	host, _ := sc.base.Hosts.Current()
+	c := twitchTitleOptions{run.GameInfo.GameName, run.Players, run.RunInfo.Platform, run.RunInfo.Estimate, run.RunInfo.Category, teams, versus, run.Commentators, host}
 
-	// TODO: handle error
-	tmpl, err := template.New("run").Parse(ts.TemplateString)
+	tmpl, err := template.New("run").Parse(text)
 	if err != nil {
-		return err.Error()
+		return "", err
 	}
 
 	var execTemplate bytes.Buffer
 	err = tmpl.Execute(&execTemplate, c)
 	if err != nil {
-		sc.base.LogError("while executing template", err, true)
-		return "ERROR"
+		return "", err
 	}
 
-	return execTemplate.String()
+	return execTemplate.String(), nil
 }
 
 // TwitchSettings defines the settings for twitch integration
-type TwitchSettings struct {
-	Update         bool   `json:"update"`
-	Viewers        bool   `json:"viewers"`
-	TemplateString string `json:"templateString"`
-}
+type TwitchSettings = models.TwitchSettings
 
 // TwitchSetSettings sets the settings
 func (sc Controller) TwitchSetSettings(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
@@ -175,53 +155,46 @@ func (sc Controller) TwitchSetSettings(w http.ResponseWriter, r *http.Request, _
 		return
 	}
 
-	ser, err := json.Marshal(ts)
+	err = sc.base.Storage.Social.SaveTwitchSettings(context.Background(), ts)
 	if err != nil {
-		sc.base.LogError("while marshal the body for setting save", err, true)
+		sc.base.LogError("while saving twitch settings", err, true)
 		return
 	}
 
-	sc.base.RedisClient.Set("twitchSettings", ser, 0)
-
 	w.Header().Add("Content-Type", "application/json")
 
-	w.Write(ser)
+	json.NewEncoder(w).Encode(ts)
 }
 
 // TwitchGetSettings returns settings
 func (sc Controller) TwitchGetSettings(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
-	var res []byte
-
-	res, err := sc.base.RedisClient.Get("twitchSettings").Bytes()
+	ts, err := sc.base.Storage.Social.TwitchSettings(context.Background())
 	if err != nil {
-		if err == redis.Nil {
+		if err == storage.ErrNotFound {
 			sc.base.Response("", "no settings have been saved", 200, w)
 			return
 		}
-		sc.base.LogError("error while getting twitch settings from redis", err, true)
+		sc.base.LogError("error while getting twitch settings", err, true)
 		return
 	}
 	w.Header().Add("Content-Type", "application/json")
 
-	w.Write(res)
+	json.NewEncoder(w).Encode(ts)
 }
 
 func (sc Controller) twitchGetSettings() (*TwitchSettings, error) {
-	var res []byte
-	var ts TwitchSettings
-	res, err := sc.base.RedisClient.Get("twitchSettings").Bytes()
+	ts, err := sc.base.Storage.Social.TwitchSettings(context.Background())
 	if err != nil {
-		if err == redis.Nil {
+		if err == storage.ErrNotFound {
 			return nil, errors.New("no Twitch settings saved")
 		}
 		return nil, err
 	}
 
-	json.Unmarshal(res, &ts)
-
 	return &ts, nil
 }
 
+// TwitchPlayCommercial starts a commercial on the update channel
 func (sc Controller) TwitchPlayCommercial(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 	commercialTimes := map[int]bool{30: true, 60: true, 90: true, 120: true, 150: true, 180: true}
 
@@ -233,50 +206,90 @@ func (sc Controller) TwitchPlayCommercial(w http.ResponseWriter, r *http.Request
 
 	defer r.Body.Close()
 
-	if commercialTimes[body.Length] {
+	if !commercialTimes[body.Length] {
+		sc.base.Response("", "invalid commerical time", http.StatusBadRequest, w)
+		return
+	}
 
-		req, err := http.NewRequest("POST", sc.socialAuth.url+"/twitch/commercial?login="+sc.base.Settings.S.TwitchUpdateChannel+"&length="+strconv.Itoa(body.Length), nil)
-		if err != nil {
-			sc.base.Response("", "error creating run commercial request", 500, w)
-			return
-		}
-		req.Header.Add("Authorization", sc.socialAuth.key)
-		res, err := sc.base.HTTPClient.Do(req)
-		if err != nil {
-			sc.base.Response("", "can't send run commercial request", 500, w)
-			return
+	err := sc.twitch().commercial(r.Context(), sc.base.Settings.Get().Twitch.UpdateChannel, body.Length)
+	if err == errNotAuthorized {
+		sc.base.Response("", err.Error(), http.StatusUnauthorized, w)
+		return
+	} else if err != nil {
+		sc.base.LogError("while starting commercial", err, false)
+		sc.base.Response("", "couldn't start commercial", http.StatusInternalServerError, w)
+		return
+	}
 
-		}
+	sc.base.Response("ok", "", http.StatusOK, w)
+}
 
-		if res.StatusCode != 200 {
-			sc.base.Response("", "non 200 status code returned while trying to start commercial", 500, w)
-			return
-		}
+// TwitchCheckForAuth will check if there is an access token available. It doesn't necessairly say if it's expired or
+// invalid. If there is none the url to authorize the API is returned
+func (sc Controller) TwitchCheckForAuth(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	ok, err := sc.twitch().authorized(r.Context())
+	if err != nil {
+		sc.base.LogError("while checking for twitch auth", err, true)
+		sc.base.Response("", "couldn't check for twitch auth", http.StatusInternalServerError, w)
+		return
+	}
 
-		sc.base.Response("ok", "", http.StatusOK, w)
-	} else {
-		sc.base.Response("", "invalid commerical time", http.StatusBadRequest, w)
+	if ok {
+		sc.base.Response("true", "", 200, w)
+		return
 	}
 
+	u, err := sc.twitch().authURL()
+	if err != nil {
+		sc.base.Response("", err.Error(), http.StatusInternalServerError, w)
+		return
+	}
+	sc.base.Response(u, "", 200, w)
 }
 
-// TwitchCheckForAuth will check if there is an access token available. It doesn't necessairly say if it's expired or invalid
-func (sc Controller) TwitchCheckForAuth(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
-	avail, err := sc.checkSocialAuth()
+// TwitchAuth redirects to twitch to authorize the API for the active marathon
+func (sc Controller) TwitchAuth(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	u, err := sc.twitch().authURL()
 	if err != nil {
-		sc.base.LogError("while checking for social auth avail", err, true)
+		sc.base.Response("", err.Error(), http.StatusInternalServerError, w)
 		return
 	}
 
-	if avail.Twitch {
-		sc.base.Response("true", "", 200, w)
-	} else {
-		sc.base.Response(sc.socialAuth.url, "", 200, w)
+	http.Redirect(w, r, u, http.StatusFound)
+}
+
+// TwitchCallback finishes the authorization. Twitch redirects here, or to a client which forwards code and state
+func (sc Controller) TwitchCallback(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	q := r.URL.Query()
+	if e := q.Get("error"); len(e) != 0 {
+		sc.base.Response("", "twitch authorization failed: "+q.Get("error_description"), http.StatusBadRequest, w)
+		return
 	}
+
+	err := sc.twitch().authorize(r.Context(), q.Get("code"), q.Get("state"))
+	if err == errNotSupported {
+		sc.base.Response("", "twitch is authorized through the social auth service", http.StatusBadRequest, w)
+		return
+	} else if err != nil {
+		sc.base.LogError("while authorizing twitch", err, false)
+		sc.base.Response("", "couldn't authorize twitch: "+err.Error(), http.StatusBadRequest, w)
+		return
+	}
+
+	sc.base.Response("true", "", http.StatusOK, w)
 }
 
 // TwitchDeleteToken will delete and revoke the twitch token
-func (sc Controller) TwitchDeleteToken(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
-	// TODO: implement this once functionality available in social_auth
+func (sc Controller) TwitchDeleteToken(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	err := sc.twitch().revoke(r.Context())
+	if err == errNotSupported {
+		sc.base.Response("", "revoking the token isn't supported by the social auth service", http.StatusNotImplemented, w)
+		return
+	} else if err != nil {
+		sc.base.LogError("while revoking twitch token", err, false)
+		sc.base.Response("", "couldn't revoke twitch token", http.StatusInternalServerError, w)
+		return
+	}
+
 	w.WriteHeader(http.StatusNoContent)
 }
@@ -0,0 +1,159 @@
+package social
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/onestay/MarathonTools-API/api/models"
+)
+
+// errNotSupported is returned by a twitch backend for calls it can't do
+var errNotSupported = errors.New("not supported by the twitch backend")
+
+// errNotAuthorized is returned if no twitch account has authorized the API yet
+var errNotAuthorized = errors.New("twitch isn't authorized")
+
+// errNoCategory is returned if there is no twitch category with the requested name
+var errNoCategory = errors.New("no twitch category with that name")
+
+// errOffline is returned for calls which need the channel to be live
+var errOffline = errors.New("twitch channel isn't live")
+
+// twitchBackend does the calls to twitch. It's either helix directly or the social auth service
+type twitchBackend interface {
+	// authorized reports whether a token is available. It doesn't mean that the token is still valid
+	authorized(ctx context.Context) (bool, error)
+	// authURL returns where the user has to go to authorize the API
+	authURL() (string, error)
+	// authorize finishes the authorization with the code and state twitch redirected to the callback with
+	authorize(ctx context.Context, code, state string) error
+	// updateInfo sets title and category of the channel of login
+	updateInfo(ctx context.Context, login, title string, category models.TwitchCategory) error
+	// resolveCategory returns the category with exactly the given name or errNoCategory
+	resolveCategory(ctx context.Context, name string) (models.TwitchCategory, error)
+	// searchCategories returns the categories matching query
+	searchCategories(ctx context.Context, query string) ([]models.TwitchCategory, error)
+	// commercial starts a commercial of length seconds on the channel of login
+	commercial(ctx context.Context, login string, length int) error
+	// revoke revokes and deletes the token
+	revoke(ctx context.Context) error
+	// chatToken returns the login and a valid access token for the chat
+	chatToken(ctx context.Context) (login, token string, err error)
+	// streamStart returns when the current stream of the channel of login started or errOffline
+	streamStart(ctx context.Context, login string) (time.Time, error)
+	// createMarker creates a stream marker on the channel of login. It returns the id of the marker and its position
+	// in the vod in seconds
+	createMarker(ctx context.Context, login, description string) (id string, position int, err error)
+}
+
+// socialAuthTwitch does the twitch calls through the social auth service which holds the tokens
+type socialAuthTwitch struct {
+	auth   *socialAuthInfo
+	client *http.Client
+}
+
+func (s socialAuthTwitch) authorized(_ context.Context) (bool, error) {
+	avail, err := s.auth.avail(s.client)
+	if err != nil {
+		return false, err
+	}
+
+	return avail.Twitch, nil
+}
+
+func (s socialAuthTwitch) authURL() (string, error) {
+	return s.auth.url, nil
+}
+
+func (s socialAuthTwitch) authorize(_ context.Context, _, _ string) error {
+	return errNotSupported
+}
+
+// updateInfo sends the name of the category since the social auth service looks up the category itself
+func (s socialAuthTwitch) updateInfo(_ context.Context, login, title string, category models.TwitchCategory) error {
+	body := struct {
+		Game  string `json:"game"`
+		Title string `json:"title"`
+		Login string `json:"login"`
+	}{category.Name, title, login}
+
+	result, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", s.auth.url+"/api/v1/twitch/update", bytes.NewReader(result))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Add("Authorization", s.auth.key)
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != 204 {
+		errRes := AuthErrorResponse{}
+		err = json.NewDecoder(res.Body).Decode(&errRes)
+		if err != nil {
+			return fmt.Errorf("error decoding error body into SocialAuthErrorResponse")
+		}
+		return fmt.Errorf("non 204 status code returned from social auth. got: %v (%v) message: %v", errRes.Status, errRes.Error, errRes.Message)
+	}
+
+	return nil
+}
+
+func (s socialAuthTwitch) resolveCategory(_ context.Context, _ string) (models.TwitchCategory, error) {
+	return models.TwitchCategory{}, errNotSupported
+}
+
+func (s socialAuthTwitch) searchCategories(_ context.Context, _ string) ([]models.TwitchCategory, error) {
+	return nil, errNotSupported
+}
+
+func (s socialAuthTwitch) commercial(_ context.Context, login string, length int) error {
+	req, err := http.NewRequest("POST", s.auth.url+"/twitch/commercial?login="+login+"&length="+strconv.Itoa(length), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Add("Authorization", s.auth.key)
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != 200 {
+		return fmt.Errorf("non 200 status code returned while trying to start commercial: %v", res.StatusCode)
+	}
+
+	return nil
+}
+
+func (s socialAuthTwitch) revoke(_ context.Context) error {
+	// TODO: implement this once functionality available in social_auth
+	return errNotSupported
+}
+
+func (s socialAuthTwitch) chatToken(_ context.Context) (string, string, error) {
+	return "", "", errNotSupported
+}
+
+func (s socialAuthTwitch) streamStart(_ context.Context, _ string) (time.Time, error) {
+	return time.Time{}, errNotSupported
+}
+
+func (s socialAuthTwitch) createMarker(_ context.Context, _, _ string) (string, int, error) {
+	return "", 0, errNotSupported
+}
@@ -0,0 +1,247 @@
+package social
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/onestay/MarathonTools-API/api/common"
+	"github.com/onestay/MarathonTools-API/api/models"
+	"github.com/onestay/MarathonTools-API/api/storage"
+)
+
+// twitchCategory returns the twitch category of run. A category which hasn't been resolved yet is resolved and cached
+// on the run. A category resolved from the game name is resolved again once the game name changes. If there is no category with the name errNoCategory is returned together with the unresolved category
+func (sc Controller) twitchCategory(ctx context.Context, run models.Run) (models.TwitchCategory, error) {
+	category := run.TwitchCategory()
+	if len(category.ID) != 0 || len(category.Name) == 0 {
+		return category, nil
+	}
+
+	resolved, err := sc.twitch().resolveCategory(ctx, category.Name)
+	if err == errNotSupported {
+		// the social auth service resolves the name itself
+		return category, nil
+	} else if err != nil {
+		return category, err
+	}
+	if !run.TwitchOverride() {
+		// marked so the cached category isn't used anymore once the game name changes
+		resolved.ResolvedFrom = run.GameInfo.GameName
+	}
+
+	if !run.RunID.IsZero() {
+		if _, err := sc.setRunCategory(ctx, common.SystemAuthor, run.RunID, &resolved); err != nil {
+			sc.base.LogError("while caching the twitch category", err, false)
+		}
+	}
+
+	return resolved, nil
+}
+
+// setRunCategory sets the twitch category of the run with the given id and records the change in the schedule history.
+// A nil category removes the override
+func (sc Controller) setRunCategory(ctx context.Context, author string, id primitive.ObjectID, category *models.TwitchCategory) (models.Run, error) {
+	before := sc.base.ScheduleSnapshot(ctx)
+	run, err := sc.base.Storage.Runs.Get(ctx, id)
+	if err != nil {
+		return run, err
+	}
+	if category != nil {
+		c := *category
+		c.BoxArtURL = ""
+		category = &c
+	}
+	run.GameInfo.Twitch = category
+
+	err = sc.base.Storage.Runs.Update(ctx, run)
+	if err != nil {
+		return run, err
+	}
+	run.Version++
+	sc.base.RecordSchedule(ctx, author, "twitchCategory", before)
+
+	if sc.base.State.RefreshRun(run) {
+		go sc.base.WSCurrentUpdate()
+	}
+	go sc.base.WSRunsOnlyUpdate()
+
+	return run, nil
+}
+
+// TwitchSearchCategories searches twitch categories by name
+func (sc Controller) TwitchSearchCategories(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	query := strings.TrimSpace(r.URL.Query().Get("query"))
+	if len(query) == 0 {
+		sc.base.Response("", "query is required", http.StatusBadRequest, w)
+		return
+	}
+
+	categories, err := sc.twitch().searchCategories(r.Context(), query)
+	if !sc.twitchError(err, w) {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(categories)
+}
+
+// TwitchResolveCategory resolves the twitch category of a run and caches it on the run. A name in the body overrides
+// the game name, otherwise the current override or the game name is resolved again. Only a name in the body or an
+// existing override is kept when the game name changes
+func (sc Controller) TwitchResolveCategory(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	id, err := primitive.ObjectIDFromHex(ps.ByName("id"))
+	if err != nil {
+		sc.base.Response("", "invalid bson id", http.StatusBadRequest, w)
+		return
+	}
+
+	body := struct {
+		Name string `json:"name"`
+	}{}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			sc.base.Response("", "invalid body", http.StatusBadRequest, w)
+			return
+		}
+	}
+
+	run, err := sc.base.Storage.Runs.Get(r.Context(), id)
+	if err == storage.ErrNotFound {
+		sc.base.Response("", "run not found", http.StatusNotFound, w)
+		return
+	} else if err != nil {
+		sc.base.Response("", err.Error(), http.StatusInternalServerError, w)
+		return
+	}
+
+	name := strings.TrimSpace(body.Name)
+	// without a name the category stays bound to the game name unless there is an override
+	auto := len(name) == 0 && !run.TwitchOverride()
+	if len(name) == 0 {
+		name = run.TwitchCategory().Name
+	}
+
+	category, err := sc.twitch().resolveCategory(r.Context(), name)
+	if err == errNotSupported {
+		// the social auth service resolves the name itself so only the override is saved
+		category, err = models.TwitchCategory{Name: name}, nil
+	} else if err == errNoCategory {
+		sc.base.Response("", fmt.Sprintf("there is no twitch category named %v", name), http.StatusNotFound, w)
+		return
+	}
+	if !sc.twitchError(err, w) {
+		return
+	}
+	if auto {
+		category.ResolvedFrom = run.GameInfo.GameName
+	}
+
+	if _, err := sc.setRunCategory(r.Context(), common.Operator(r), id, &category); err == storage.ErrConflict {
+		sc.base.Response("", "run was changed in the meantime", http.StatusConflict, w)
+		return
+	} else if err != nil {
+		sc.base.Response("", err.Error(), http.StatusInternalServerError, w)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(category)
+}
+
+// TwitchClearCategory removes the twitch category override of a run so the game name is used again
+func (sc Controller) TwitchClearCategory(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	id, err := primitive.ObjectIDFromHex(ps.ByName("id"))
+	if err != nil {
+		sc.base.Response("", "invalid bson id", http.StatusBadRequest, w)
+		return
+	}
+
+	_, err = sc.setRunCategory(r.Context(), common.Operator(r), id, nil)
+	if err == storage.ErrNotFound {
+		sc.base.Response("", "run not found", http.StatusNotFound, w)
+		return
+	} else if err == storage.ErrConflict {
+		sc.base.Response("", "run was changed in the meantime", http.StatusConflict, w)
+		return
+	} else if err != nil {
+		sc.base.Response("", err.Error(), http.StatusInternalServerError, w)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// twitchPreview is what would be sent to twitch for a run
+type twitchPreview struct {
+	Channel  string                `json:"channel"`
+	Title    string                `json:"title"`
+	Category models.TwitchCategory `json:"category"`
+	// Resolved is false if the category couldn't be resolved. Only the title would be updated then
+	Resolved bool   `json:"resolved"`
+	Error    string `json:"error,omitempty"`
+}
+
+// TwitchPreview shows the title and category which would be sent to twitch for any run. Nothing is cached
+func (sc Controller) TwitchPreview(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	id, err := primitive.ObjectIDFromHex(ps.ByName("id"))
+	if err != nil {
+		sc.base.Response("", "invalid bson id", http.StatusBadRequest, w)
+		return
+	}
+
+	run, err := sc.base.Storage.Runs.Get(r.Context(), id)
+	if err == storage.ErrNotFound {
+		sc.base.Response("", "run not found", http.StatusNotFound, w)
+		return
+	} else if err != nil {
+		sc.base.Response("", err.Error(), http.StatusInternalServerError, w)
+		return
+	}
+
+	p := twitchPreview{
+		Channel:  sc.base.Settings.Get().Twitch.UpdateChannel,
+		Title:    sc.twitchTemplate(&run),
+		Category: run.TwitchCategory(),
+		Resolved: true,
+	}
+	if len(p.Category.ID) == 0 && len(p.Category.Name) != 0 {
+		resolved, err := sc.twitch().resolveCategory(r.Context(), p.Category.Name)
+		switch err {
+		case nil:
+			p.Category = resolved
+		case errNotSupported:
+		case errNoCategory:
+			p.Resolved = false
+			p.Error = fmt.Sprintf("there is no twitch category named %v", p.Category.Name)
+		default:
+			p.Resolved = false
+			p.Error = err.Error()
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(p)
+}
+
+// twitchError sends the response for an error of the twitch backend. It returns true if err is nil
+func (sc Controller) twitchError(err error, w http.ResponseWriter) bool {
+	switch err {
+	case nil:
+		return true
+	case errNotAuthorized:
+		sc.base.Response("", err.Error(), http.StatusUnauthorized, w)
+	case errNotSupported:
+		sc.base.Response("", "not supported by the social auth service", http.StatusNotImplemented, w)
+	default:
+		sc.base.LogError("while calling twitch", err, false)
+		sc.base.Response("", err.Error(), http.StatusBadGateway, w)
+	}
+
+	return false
+}
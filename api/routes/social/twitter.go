@@ -2,12 +2,13 @@ package social
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
-	"strconv"
 
-	"github.com/go-redis/redis"
+	"github.com/onestay/MarathonTools-API/api/models"
+	"github.com/onestay/MarathonTools-API/api/storage"
 
 	"github.com/julienschmidt/httprouter"
 )
@@ -23,7 +24,7 @@ func (sc Controller) TwitterCheckForAuth(w http.ResponseWriter, _ *http.Request,
 	if avail.Twitter {
 		sc.base.Response("true", "", 200, w)
 	} else {
-		sc.base.Response(sc.socialAuth.url, "", 200, w)
+		sc.base.Response(sc.socialAuth().url, "", 200, w)
 	}
 }
 
@@ -55,7 +56,7 @@ func (sc Controller) twitterSendUpdate() error {
 		Body: ts,
 	}
 
-	url := sc.socialAuth.url + "/api/v1/tweet"
+	url := sc.socialAuth().url + "/api/v1/tweet"
 	b, err := json.Marshal(&tweetBody)
 	if err != nil {
 		return err
@@ -67,7 +68,7 @@ func (sc Controller) twitterSendUpdate() error {
 	}
 
 	req.Header.Add("Content-Type", "application/json")
-	req.Header.Add("Authorization", sc.socialAuth.key)
+	req.Header.Add("Authorization", sc.socialAuth().key)
 
 	res, err := sc.base.HTTPClient.Do(req)
 	if err != nil {
@@ -81,9 +82,7 @@ func (sc Controller) twitterSendUpdate() error {
 }
 
 // TwitterSettings contains the settings for Twitter
-type TwitterSettings struct {
-	SendTweets bool `json:"sendTweets"`
-}
+type TwitterSettings = models.TwitterSettings
 
 // TwitterSetSettings is used to set settings for twitter
 func (sc Controller) TwitterSetSettings(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
@@ -91,7 +90,7 @@ func (sc Controller) TwitterSetSettings(w http.ResponseWriter, r *http.Request,
 
 	json.NewDecoder(r.Body).Decode(&body)
 
-	err := sc.base.RedisClient.Set("twitterSettings", strconv.FormatBool(body.SendTweets), 0).Err()
+	err := sc.base.Storage.Social.SaveTwitterSettings(context.Background(), body)
 	if err != nil {
 		sc.base.Response("", "error saving settings", http.StatusInternalServerError, w)
 		return
@@ -100,18 +99,18 @@ func (sc Controller) TwitterSetSettings(w http.ResponseWriter, r *http.Request,
 
 // TwitterGetSettings is used to get settings for twitter
 func (sc Controller) TwitterGetSettings(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
-	res, err := sc.base.RedisClient.Get("twitterSettings").Bytes()
+	ts, err := sc.base.Storage.Social.TwitterSettings(context.Background())
 	if err != nil {
-		if err == redis.Nil {
+		if err == storage.ErrNotFound {
 			w.WriteHeader(http.StatusNoContent)
 			return
 		}
 		sc.base.Response("", "error getting settings", http.StatusInternalServerError, w)
+		return
 	}
-	b, _ := strconv.ParseBool(string(res))
 	s := struct {
 		SendUpdates bool `json:"sendUpdates"`
-	}{b}
+	}{ts.SendTweets}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(s)
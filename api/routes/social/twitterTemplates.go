@@ -2,6 +2,7 @@ package social
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"math/rand"
@@ -9,19 +10,13 @@ import (
 	"strconv"
 	"text/template"
 
-	"gopkg.in/mgo.v2/bson"
-
-	"github.com/go-redis/redis"
 	"github.com/onestay/MarathonTools-API/api/models"
+	"github.com/onestay/MarathonTools-API/api/storage"
 
 	"github.com/julienschmidt/httprouter"
 )
 
-type twitterTemplate struct {
-	Text        string        `json:"text,omitempty"`
-	ForMultiple bool          `json:"forMultiple,omitempty"`
-	ForRun      bson.ObjectId `json:"forRun,omitempty"`
-}
+type twitterTemplate = models.TwitterTemplate
 
 type twitterTemplateOptions struct {
 	Game     string
@@ -29,56 +24,45 @@ type twitterTemplateOptions struct {
 	Platform string
 	Estimate string
 	Category string
+	Teams    []templateTeam
+	Versus   string
+	// Commentators are the commentators of the run and Host is the current host. Host is empty if nobody is hosting
+	Commentators []models.Person
+	Host         models.Person
 }
 
 type twitterTemplates []twitterTemplate
 
-// TwitterAddTemplate will add a template to redis
+var errNoTemplates = errors.New("no templates added")
+
+// TwitterAddTemplate will add a template
 func (sc Controller) TwitterAddTemplate(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	t := twitterTemplate{}
 	json.NewDecoder(r.Body).Decode(&t)
 	defer r.Body.Close()
 
-	b, err := sc.base.RedisClient.Get("twitterTemplates").Bytes()
-	if err == redis.Nil {
-		ts := make([]twitterTemplate, 1)
-		ts[0] = t
-
-		mRes, _ := json.Marshal(ts)
-
-		err := sc.base.RedisClient.Set("twitterTemplates", mRes, 0).Err()
-		if err != nil {
-			sc.base.Response("", "Error adding template", http.StatusInternalServerError, w)
-			return
-		}
-		sc.TwitterGetTemplates(w, r, ps)
-		return
-	} else if err != nil {
-		sc.base.Response("", "error getting templates from redis", http.StatusInternalServerError, w)
+	ta, err := sc.twitterGetTemplates()
+	if err != nil && err != errNoTemplates {
+		sc.base.Response("", err.Error(), http.StatusInternalServerError, w)
 		return
 	}
 
-	ta := twitterTemplates{}
-
-	json.Unmarshal(b, &ta)
-
 	ta = append(ta, t)
 
-	mRes, _ := json.Marshal(ta)
-
-	sc.base.RedisClient.Set("twitterTemplates", mRes, 0).Err()
+	err = sc.base.Storage.Social.SaveTwitterTemplates(context.Background(), ta)
 	if err != nil {
 		sc.base.Response("", "Error adding template", http.StatusInternalServerError, w)
+		return
 	}
 
 	sc.TwitterGetTemplates(w, r, ps)
 }
 
-// TwitterGetTemplates will return all templates from redis
+// TwitterGetTemplates will return all templates
 func (sc Controller) TwitterGetTemplates(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
 	t, err := sc.twitterGetTemplates()
 	if err != nil {
-		if err.Error() == "No templates added" {
+		if err == errNoTemplates {
 			sc.base.Response("", err.Error(), http.StatusOK, w)
 			return
 		}
@@ -90,48 +74,40 @@ func (sc Controller) TwitterGetTemplates(w http.ResponseWriter, _ *http.Request,
 	json.NewEncoder(w).Encode(t)
 }
 
-func (sc Controller) twitterGetTemplates() (*twitterTemplates, error) {
-	b, err := sc.base.RedisClient.Get("twitterTemplates").Bytes()
-	if err == redis.Nil {
-		return nil, errors.New("no templates added")
+func (sc Controller) twitterGetTemplates() (twitterTemplates, error) {
+	t, err := sc.base.Storage.Social.TwitterTemplates(context.Background())
+	if err == storage.ErrNotFound {
+		return nil, errNoTemplates
 	} else if err != nil {
-		return nil, errors.New("error getting templates from redis")
+		return nil, errors.New("error getting templates")
 	}
 
-	t := twitterTemplates{}
-
-	json.Unmarshal(b, &t)
-
-	return &t, nil
+	return t, nil
 }
 
 // TwitterDeleteTemplate will delete a template given by the index
 func (sc Controller) TwitterDeleteTemplate(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
-	b, err := sc.base.RedisClient.Get("twitterTemplates").Bytes()
-	if err == redis.Nil {
+	t, err := sc.twitterGetTemplates()
+	if err == errNoTemplates {
 		sc.base.Response("", "No templates added", http.StatusNotFound, w)
 		return
 	} else if err != nil {
-		sc.base.Response("", "Error getting templates from redis", http.StatusInternalServerError, w)
+		sc.base.Response("", err.Error(), http.StatusInternalServerError, w)
 		return
 	}
 
-	t := twitterTemplates{}
-
-	json.Unmarshal(b, &t)
-
 	i, err := strconv.Atoi(ps.ByName("index"))
-	if err != nil {
+	if err != nil || i < 0 || i >= len(t) {
 		sc.base.Response("", "index isn't a valid int", http.StatusBadRequest, w)
+		return
 	}
 
 	t = append(t[:i], t[i+1:]...)
 
-	mRes, _ := json.Marshal(t)
-
-	sc.base.RedisClient.Set("twitterTemplates", mRes, 0).Err()
+	err = sc.base.Storage.Social.SaveTwitterTemplates(context.Background(), t)
 	if err != nil {
-		sc.base.Response("", "Error adding template", http.StatusInternalServerError, w)
+		sc.base.Response("", "Error deleting template", http.StatusInternalServerError, w)
+		return
 	}
 
 	sc.TwitterGetTemplates(w, r, ps)
@@ -139,16 +115,18 @@ func (sc Controller) TwitterDeleteTemplate(w http.ResponseWriter, r *http.Reques
 
 func (sc Controller) twitterExecuteTemplate() (string, error) {
 
-	c := sc.base.CurrentRun
-	t := twitterTemplateOptions{c.GameInfo.GameName, c.Players, c.RunInfo.Platform, c.RunInfo.Estimate, c.RunInfo.Category}
+	c := sc.base.State.CurrentRun()
+	teams, versus := templateTeams(&c)
+	host, _ := sc.base.Hosts.Current()
+	t := twitterTemplateOptions{c.GameInfo.GameName, c.Players, c.RunInfo.Platform, c.RunInfo.Estimate, c.RunInfo.Category, teams, versus, c.Commentators, host}
 	templates, err := sc.twitterGetTemplates()
 	if err != nil {
 		return "", err
 	}
-	if len(*templates) == 0 {
-		return "", errors.New("no templates added")
+	if len(templates) == 0 {
+		return "", errNoTemplates
 	}
-	rTemplate := (*templates)[rand.Intn(len(*templates))]
+	rTemplate := templates[rand.Intn(len(templates))]
 
 	templ, err := template.New("tweet").Parse(rTemplate.Text)
 	if err != nil {
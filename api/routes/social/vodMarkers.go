@@ -0,0 +1,185 @@
+package social
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/onestay/MarathonTools-API/api/events"
+	"github.com/onestay/MarathonTools-API/api/models"
+	"github.com/onestay/MarathonTools-API/api/storage"
+)
+
+// maxMarkerDescription is the limit of the description of twitch stream markers
+const maxMarkerDescription = 140
+
+// recordMarker creates a twitch stream marker for the run of e and saves a vod marker. The vod marker is saved even if
+// twitch can't be asked so the chapters can still be exported
+func (sc Controller) recordMarker(e events.Event) error {
+	if e.Run == nil || e.Run.RunID.IsZero() {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	m := models.VODMarker{
+		Event: string(e.Type),
+		RunID: e.Run.RunID,
+		Title: runTitle(e.Run),
+		At:    e.At,
+	}
+
+	sc.markerMu.Lock()
+	defer sc.markerMu.Unlock()
+
+	markers, err := sc.base.Storage.Social.VODMarkers(ctx)
+	if err != nil && err != storage.ErrNotFound {
+		return err
+	}
+
+	login := sc.base.Settings.Get().Twitch.UpdateChannel
+	var twitchErr error
+	m.StreamStart, twitchErr = sc.twitch().streamStart(ctx, login)
+	if twitchErr != nil {
+		// without twitch the stream is assumed to still be the one of the last marker
+		m.StreamStart = m.At
+		if len(markers) != 0 {
+			m.StreamStart = markers[len(markers)-1].StreamStart
+		}
+	}
+	m.Offset = math.Max(0, m.At.Sub(m.StreamStart).Seconds())
+
+	if twitchErr == nil {
+		var position int
+		m.TwitchID, position, twitchErr = sc.twitch().createMarker(ctx, login, markerDescription(e, m.Title))
+		if twitchErr == nil {
+			m.Offset = float64(position)
+		}
+	}
+	if twitchErr != nil {
+		m.Error = twitchErr.Error()
+	}
+
+	err = sc.base.Storage.Social.SaveVODMarkers(ctx, append(markers, m))
+	if err != nil {
+		return err
+	}
+
+	if twitchErr == errNotSupported || twitchErr == errOffline {
+		return nil
+	}
+	return twitchErr
+}
+
+// runTitle is the name of a run in markers and chapters
+func runTitle(run *models.Run) string {
+	if len(run.RunInfo.Category) == 0 {
+		return run.GameInfo.GameName
+	}
+
+	return run.GameInfo.GameName + " (" + run.RunInfo.Category + ")"
+}
+
+// markerDescription is the description of the twitch stream marker for e
+func markerDescription(e events.Event, title string) string {
+	switch e.Type {
+	case events.TimerStarted:
+		title = "Start: " + title
+	case events.TimerFinished:
+		title = "Finish: " + title + " in " + formatOffset(e.Time)
+	}
+	if r := []rune(title); len(r) > maxMarkerDescription {
+		title = string(r[:maxMarkerDescription])
+	}
+
+	return title
+}
+
+// formatOffset formats seconds as h:mm:ss like youtube chapters
+func formatOffset(seconds float64) string {
+	s := int(seconds)
+	return fmt.Sprintf("%d:%02d:%02d", s/3600, s/60%60, s%60)
+}
+
+// TwitchGetMarkers returns all vod markers of the active marathon
+func (sc Controller) TwitchGetMarkers(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	markers, err := sc.base.Storage.Social.VODMarkers(r.Context())
+	if err == storage.ErrNotFound {
+		markers = []models.VODMarker{}
+	} else if err != nil {
+		sc.base.Response("", err.Error(), http.StatusInternalServerError, w)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(markers)
+}
+
+// TwitchDeleteMarkers removes all vod markers of the active marathon
+func (sc Controller) TwitchDeleteMarkers(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	sc.markerMu.Lock()
+	err := sc.base.Storage.Social.DeleteVODMarkers(r.Context())
+	sc.markerMu.Unlock()
+	if err != nil {
+		sc.base.Response("", err.Error(), http.StatusInternalServerError, w)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// TwitchChapters exports the runs of a stream as youtube chapters. Every run starts at its first marker. stream selects
+// the stream by its number starting at 1, the default is the last one
+func (sc Controller) TwitchChapters(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	markers, err := sc.base.Storage.Social.VODMarkers(r.Context())
+	if err != nil && err != storage.ErrNotFound {
+		sc.base.Response("", err.Error(), http.StatusInternalServerError, w)
+		return
+	}
+
+	var streams []time.Time
+	for _, m := range markers {
+		if len(streams) == 0 || !streams[len(streams)-1].Equal(m.StreamStart) {
+			streams = append(streams, m.StreamStart)
+		}
+	}
+	if len(streams) == 0 {
+		sc.base.Response("", "no markers have been recorded", http.StatusNotFound, w)
+		return
+	}
+
+	stream := len(streams)
+	if q := r.URL.Query().Get("stream"); len(q) != 0 {
+		stream, err = strconv.Atoi(q)
+		if err != nil || stream < 1 || stream > len(streams) {
+			sc.base.Response("", fmt.Sprintf("stream has to be between 1 and %v", len(streams)), http.StatusBadRequest, w)
+			return
+		}
+	}
+	start := streams[stream-1]
+
+	var lines []string
+	seen := make(map[string]bool)
+	for _, m := range markers {
+		// the finish of a run isn't the start of a chapter
+		if !m.StreamStart.Equal(start) || m.Event == string(events.TimerFinished) || seen[m.RunID.Hex()] {
+			continue
+		}
+		seen[m.RunID.Hex()] = true
+		// youtube only shows chapters if the first one starts at 0:00:00
+		if len(lines) == 0 && m.Offset >= 1 {
+			lines = append(lines, formatOffset(0)+" Intro")
+		}
+		lines = append(lines, formatOffset(m.Offset)+" "+m.Title)
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintln(w, strings.Join(lines, "\n"))
+}
@@ -0,0 +1,97 @@
+package timer
+
+import (
+	"sync"
+	"time"
+
+	"github.com/onestay/MarathonTools-API/api/common"
+	"github.com/onestay/MarathonTools-API/api/stopwatch"
+)
+
+// DefaultTimer is the name of the main timer which is bound to the current run
+const DefaultTimer = "default"
+
+// instance is a single timer. The default timer and all named timers are instances.
+// The state is kept by the stopwatch, the instance only takes care of sending out time updates while the stopwatch is running
+type instance struct {
+	name            string
+	sw              *stopwatch.Stopwatch
+	refreshInterval int
+	mu              sync.Mutex
+	ticker          *time.Ticker
+	done            chan struct{}
+	// onTick gets called with the current time every refresh interval
+	onTick func(t float64)
+}
+
+// newInstance returns a new stopped timer. onState gets called every time the state of the timer changes
+func newInstance(name string, refreshInterval int, clock stopwatch.Clock, onTick func(t float64), onState func(s common.TimerState)) *instance {
+	t := &instance{
+		name:            name,
+		sw:              stopwatch.New(clock),
+		refreshInterval: refreshInterval,
+		onTick:          onTick,
+	}
+
+	t.sw.Subscribe(func(e stopwatch.Event) {
+		if e.To == stopwatch.Running {
+			t.startLoop()
+		} else {
+			// send out the exact time the timer stopped at
+			t.stopLoop()
+			t.onTick(e.Elapsed.Seconds())
+		}
+		onState(e.To)
+	})
+
+	return t
+}
+
+// time returns the current time of the timer in seconds
+func (t *instance) time() float64 {
+	return t.sw.Elapsed().Seconds()
+}
+
+func (t *instance) startLoop() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.ticker != nil {
+		return
+	}
+
+	t.ticker = time.NewTicker(time.Duration(t.refreshInterval) * time.Millisecond)
+	t.done = make(chan struct{})
+
+	go func(ticker *time.Ticker, done chan struct{}) {
+		for {
+			select {
+			case <-ticker.C:
+				t.onTick(t.time())
+			case <-done:
+				return
+			}
+		}
+	}(t.ticker, t.done)
+}
+
+// setRefreshInterval changes the interval of time updates. A running loop uses it from the next update on
+func (t *instance) setRefreshInterval(refreshInterval int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.refreshInterval = refreshInterval
+	if t.ticker != nil {
+		t.ticker.Reset(time.Duration(refreshInterval) * time.Millisecond)
+	}
+}
+
+func (t *instance) stopLoop() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.ticker == nil {
+		return
+	}
+
+	t.ticker.Stop()
+	close(t.done)
+	t.ticker = nil
+}
@@ -0,0 +1,211 @@
+package timer
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/onestay/MarathonTools-API/api/common"
+	"github.com/onestay/MarathonTools-API/api/stopwatch"
+)
+
+type timerInfo struct {
+	Name  string            `json:"name"`
+	State common.TimerState `json:"state"`
+	Time  float64           `json:"time"`
+}
+
+func (t *instance) info() timerInfo {
+	return timerInfo{t.name, t.sw.State(), t.time()}
+}
+
+func (c *Controller) newNamedTimer(name string) *instance {
+	return newInstance(name, c.refreshInterval, c.clock, func(t float64) {
+		c.b.WSNamedTimeUpdate(name, t)
+	}, func(s common.TimerState) {
+		c.b.WSNamedStateUpdate(name, s)
+	})
+}
+
+// getTimer returns the timer with the given name. The default timer is also available under its name
+func (c *Controller) getTimer(name string) *instance {
+	if name == DefaultTimer {
+		return c.main
+	}
+
+	c.namedMu.RLock()
+	defer c.namedMu.RUnlock()
+	return c.named[name]
+}
+
+func (c *Controller) namedTimerFromParams(w http.ResponseWriter, ps httprouter.Params) *instance {
+	t := c.getTimer(ps.ByName("name"))
+	if t == nil {
+		c.b.Response("", "timer doesn't exist", http.StatusNotFound, w)
+	}
+
+	return t
+}
+
+// NamedTimerGetAll returns the state and time of all timers including the default timer
+func (c *Controller) NamedTimerGetAll(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
+	c.namedMu.RLock()
+	timers := make([]timerInfo, 0, len(c.named)+1)
+	timers = append(timers, c.main.info())
+	for _, t := range c.named {
+		timers = append(timers, t.info())
+	}
+	c.namedMu.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(timers)
+}
+
+// NamedTimerGet returns the state and time of a single timer
+func (c *Controller) NamedTimerGet(w http.ResponseWriter, _ *http.Request, ps httprouter.Params) {
+	t := c.namedTimerFromParams(w, ps)
+	if t == nil {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(t.info())
+}
+
+// NamedTimerCreate creates a new named timer in the stopped state
+func (c *Controller) NamedTimerCreate(w http.ResponseWriter, _ *http.Request, ps httprouter.Params) {
+	name := ps.ByName("name")
+	if name == DefaultTimer {
+		c.b.Response("", "the default timer can't be created", http.StatusBadRequest, w)
+		return
+	}
+
+	c.namedMu.Lock()
+	if _, ok := c.named[name]; ok {
+		c.namedMu.Unlock()
+		c.b.Response("", "timer already exists", http.StatusBadRequest, w)
+		return
+	}
+	t := c.newNamedTimer(name)
+	c.named[name] = t
+	c.namedMu.Unlock()
+
+	go c.b.WSNamedStateUpdate(name, t.sw.State())
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(t.info())
+}
+
+// NamedTimerDelete stops and removes a named timer
+func (c *Controller) NamedTimerDelete(w http.ResponseWriter, _ *http.Request, ps httprouter.Params) {
+	name := ps.ByName("name")
+	if name == DefaultTimer {
+		c.b.Response("", "the default timer can't be deleted", http.StatusBadRequest, w)
+		return
+	}
+
+	c.namedMu.Lock()
+	t, ok := c.named[name]
+	if !ok {
+		c.namedMu.Unlock()
+		c.b.Response("", "timer doesn't exist", http.StatusNotFound, w)
+		return
+	}
+	delete(c.named, name)
+	c.namedMu.Unlock()
+
+	t.stopLoop()
+	go c.b.WSNamedTimerDelete(name)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// NamedTimerStart will start a named timer
+// req state: stopped
+func (c *Controller) NamedTimerStart(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	if ps.ByName("name") == DefaultTimer {
+		c.TimerStart(w, r, ps)
+		return
+	}
+	t := c.namedTimerFromParams(w, ps)
+	if t == nil {
+		return
+	}
+	if _, ok := c.apply(t, stopwatch.Start, w); !ok {
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// NamedTimerPause will pause a named timer
+// req state: running
+func (c *Controller) NamedTimerPause(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	if ps.ByName("name") == DefaultTimer {
+		c.TimerPause(w, r, ps)
+		return
+	}
+	t := c.namedTimerFromParams(w, ps)
+	if t == nil {
+		return
+	}
+	if _, ok := c.apply(t, stopwatch.Pause, w); !ok {
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// NamedTimerResume will resume a named timer
+// req state: finished, pause
+func (c *Controller) NamedTimerResume(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	if ps.ByName("name") == DefaultTimer {
+		c.TimerResume(w, r, ps)
+		return
+	}
+	t := c.namedTimerFromParams(w, ps)
+	if t == nil {
+		return
+	}
+	if _, ok := c.apply(t, stopwatch.Resume, w); !ok {
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// NamedTimerFinish will finish a named timer
+// req state: running
+func (c *Controller) NamedTimerFinish(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	if ps.ByName("name") == DefaultTimer {
+		c.TimerFinish(w, r, ps)
+		return
+	}
+	t := c.namedTimerFromParams(w, ps)
+	if t == nil {
+		return
+	}
+	if _, ok := c.apply(t, stopwatch.Finish, w); !ok {
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// NamedTimerReset will reset a named timer
+// req state: finished, pause
+func (c *Controller) NamedTimerReset(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	if ps.ByName("name") == DefaultTimer {
+		c.TimerReset(w, r, ps)
+		return
+	}
+	t := c.namedTimerFromParams(w, ps)
+	if t == nil {
+		return
+	}
+	if _, ok := c.apply(t, stopwatch.Reset, w); !ok {
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
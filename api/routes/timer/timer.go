@@ -1,22 +1,31 @@
 package timer
 
 import (
-	"fmt"
+	"context"
+	"encoding/json"
 	"net/http"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/julienschmidt/httprouter"
 	"github.com/onestay/MarathonTools-API/api/common"
+	"github.com/onestay/MarathonTools-API/api/events"
+	"github.com/onestay/MarathonTools-API/api/models"
+	"github.com/onestay/MarathonTools-API/api/stopwatch"
 )
 
 // Controller is the time controller
 type Controller struct {
-	b               *common.Controller
-	ticker          *time.Ticker
+	b *common.Controller
+	// refreshInterval is guarded by namedMu since it's used for new named timers
 	refreshInterval int
-	startTime       time.Time
-	lastPaused      time.Time
+	clock           stopwatch.Clock
+	// main is the default timer. It's the one bound to the current run and the one the /timer routes operate on
+	main *instance
+	// named holds all additional timers, e.g. for relay teams or a setup timer
+	named   map[string]*instance
+	namedMu sync.RWMutex
 }
 
 func (c *Controller) registerRoutes(r *httprouter.Router) {
@@ -25,98 +34,112 @@ func (c *Controller) registerRoutes(r *httprouter.Router) {
 	r.POST("/timer/resume", c.TimerResume)
 	r.POST("/timer/finish", c.TimerFinish)
 	r.POST("/timer/player/finish/:id", c.TimerPlayerFinish)
+	r.POST("/timer/team/finish/:id", c.TimerTeamFinish)
+	r.GET("/timer/results", c.TimerResults)
 	r.POST("/timer/reset", c.TimerReset)
 
+	// httprouter doesn't allow a wildcard next to the static /timer routes so named timers live under /timers
+	r.GET("/timers", c.NamedTimerGetAll)
+	r.POST("/timers/:name", c.NamedTimerCreate)
+	r.DELETE("/timers/:name", c.NamedTimerDelete)
+	r.GET("/timers/:name", c.NamedTimerGet)
+	r.POST("/timers/:name/start", c.NamedTimerStart)
+	r.POST("/timers/:name/pause", c.NamedTimerPause)
+	r.POST("/timers/:name/resume", c.NamedTimerResume)
+	r.POST("/timers/:name/finish", c.NamedTimerFinish)
+	r.POST("/timers/:name/reset", c.NamedTimerReset)
 }
 
 // NewTimeController initializes and returns a new time controller. The refreshInterval is in ms
-func NewTimeController(b *common.Controller, refreshInterval int, router *httprouter.Router) {
+func NewTimeController(b *common.Controller, refreshInterval int, router *httprouter.Router) *Controller {
 	tc := Controller{
 		b:               b,
 		refreshInterval: refreshInterval,
+		clock:           stopwatch.RealClock,
+		named:           make(map[string]*instance),
 	}
 
+	tc.main = newInstance(DefaultTimer, refreshInterval, tc.clock, func(t float64) {
+		b.State.SetTimerTime(t)
+		b.WSTimeUpdate()
+	}, func(s common.TimerState) {
+		b.State.SetTimerState(s)
+		b.WSStateUpdate()
+	})
+
 	tc.registerRoutes(router)
-}
 
-func (c *Controller) timerLoop() {
-	c.ticker = time.NewTicker(time.Duration(c.refreshInterval) * time.Millisecond)
+	return &tc
+}
 
-	go func() {
-		for {
-			select {
-			case <-c.ticker.C:
-				// difference := t.Sub(c.startTime).Seconds()
-				difference := time.Now().Sub(c.startTime).Seconds()
-				c.b.TimerTime = difference
-				c.b.WSTimeUpdate()
-			}
-		}
-	}()
+// SetRefreshInterval changes the interval in ms in which all timers send time updates, running timers included
+func (c *Controller) SetRefreshInterval(refreshInterval int) {
+	c.namedMu.Lock()
+	defer c.namedMu.Unlock()
+	c.refreshInterval = refreshInterval
+	c.main.setRefreshInterval(refreshInterval)
+	for _, t := range c.named {
+		t.setRefreshInterval(refreshInterval)
+	}
 }
 
 // TimerStart will start the timer
 // req state: stopped
 func (c *Controller) TimerStart(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
-	if c.invalidState("start", w) {
+	if err := c.Start(); err != nil {
+		c.b.Response("", err.Error(), http.StatusBadRequest, w)
 		return
 	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Start will start the default timer. It fails if the checklist gate blocks
+func (c *Controller) Start() error {
+	if c.b.State.TimerState() == common.TimerStopped {
+		if err := c.b.CL.Gate(); err != nil {
+			return err
+		}
+	}
+	if _, err := c.main.sw.Apply(stopwatch.Start); err != nil {
+		return err
+	}
+	run := c.b.State.CurrentRun()
+	c.b.Events.Publish(events.Event{Type: events.TimerStarted, Run: &run})
 	go func() {
-		if c.b.CL.Finished || len(c.b.CL.Items) == 0 {
+		if c.b.CL.Finished() {
 			go c.b.UpdateUpNext()
 		}
 	}()
+	go c.b.Setup.Stop()
 
-	c.startTime = time.Now()
-	c.timerLoop()
-
-	c.b.TimerState = common.TimerRunning
-	c.b.WSStateUpdate()
-
-	w.WriteHeader(http.StatusNoContent)
+	return nil
 }
 
 // TimerPause will pause the timer
 // req state: running
 func (c *Controller) TimerPause(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
-	if c.invalidState("pause", w) {
+	if _, ok := c.apply(c.main, stopwatch.Pause, w); !ok {
 		return
 	}
 
-	c.lastPaused = time.Now()
-	c.ticker.Stop()
-
-	c.b.TimerState = common.TimerPaused
-	c.b.WSStateUpdate()
-
 	w.WriteHeader(http.StatusNoContent)
 }
 
 // TimerResume will resume the timer
 // req state: finished, pause
 func (c *Controller) TimerResume(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
-	if c.invalidState("resume", w) {
+	ev, ok := c.apply(c.main, stopwatch.Resume, w)
+	if !ok {
 		return
 	}
 
-	if c.b.TimerState == common.TimerFinished {
-		c.lastPaused = time.Now()
-		for i := 0; i < len(c.b.CurrentRun.Players); i++ {
-			c.b.CurrentRun.Players[i].Timer.Finished = false
-			c.b.CurrentRun.Players[i].Timer.Time = 0
-		}
+	if ev.From == stopwatch.Finished {
+		c.b.State.UpdateCurrentRun(func(r *models.Run) {
+			r.ResetTimers()
+		})
 	}
-
 	go c.b.WSCurrentUpdate()
-	go func() {
-		c.startTime = c.startTime.Add(time.Since(c.lastPaused))
-		go c.timerLoop()
-	}()
-
-	go func() {
-		c.b.TimerState = common.TimerRunning
-		c.b.WSStateUpdate()
-	}()
 
 	w.WriteHeader(http.StatusNoContent)
 }
@@ -124,43 +147,64 @@ func (c *Controller) TimerResume(w http.ResponseWriter, _ *http.Request, _ httpr
 // TimerFinish will be fired when all players are done, can also be manually called
 // req state: running
 func (c *Controller) TimerFinish(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
-	if c.invalidState("finish", w) {
+	ev, ok := c.apply(c.main, stopwatch.Finish, w)
+	if !ok {
 		return
 	}
-
-	c.ticker.Stop()
-
-	c.b.TimerState = common.TimerFinished
+	t := ev.Elapsed.Seconds()
 
 	// if the finish is manually called all players which are not done yet should be set to done and updated with the current time
-	for i := 0; i < len(c.b.CurrentRun.Players); i++ {
-		if !c.b.CurrentRun.Players[i].Timer.Finished {
-			c.b.CurrentRun.Players[i].Timer.Time = c.b.TimerTime
-			c.b.CurrentRun.Players[i].Timer.Finished = true
+	run := c.b.State.UpdateCurrentRun(func(r *models.Run) {
+		for i := 0; i < len(r.Players); i++ {
+			if !r.Players[i].Timer.Finished {
+				r.Players[i].Timer.Time = t
+				r.Players[i].Timer.Finished = true
+			}
 		}
-	}
-	go c.b.WSStateUpdate()
+		for i := 0; i < len(r.Teams); i++ {
+			if !r.Teams[i].Timer.Finished {
+				r.Teams[i].Timer.Time = t
+				r.Teams[i].Timer.Finished = true
+			}
+		}
+	})
 	go c.b.WSCurrentUpdate()
+	go c.saveResult(run, t)
+	c.b.Events.Publish(events.Event{Type: events.TimerFinished, Run: &run, Time: t})
 
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// saveResult stores the result of a finished run
+func (c *Controller) saveResult(run models.Run, t float64) {
+	if run.RunID.IsZero() {
+		return
+	}
+
+	res := models.RunResult{
+		RunID:    run.RunID,
+		Time:     t,
+		Players:  run.Players,
+		Teams:    run.TeamResults(),
+		Finished: time.Now(),
+	}
+
+	err := c.b.Storage.Results.Save(context.Background(), res)
+	if err != nil {
+		c.b.LogError("while saving run result", err, true)
+	}
+}
+
 // TimerReset will reset the timer
-// req state: finished
+// req state: finished, pause
 func (c *Controller) TimerReset(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
-	if c.invalidState("reset", w) {
+	if _, ok := c.apply(c.main, stopwatch.Reset, w); !ok {
 		return
 	}
-	c.ticker.Stop()
 
-	for i := 0; i < len(c.b.CurrentRun.Players); i++ {
-		c.b.CurrentRun.Players[i].Timer.Finished = false
-		c.b.CurrentRun.Players[i].Timer.Time = 0
-	}
-	c.b.TimerTime = 0
-	go c.b.WSTimeUpdate()
-	c.b.TimerState = common.TimerStopped
-	go c.b.WSStateUpdate()
+	c.b.State.UpdateCurrentRun(func(r *models.Run) {
+		r.ResetTimers()
+	})
 
 	w.WriteHeader(http.StatusNoContent)
 	c.b.WSCurrentUpdate()
@@ -170,7 +214,7 @@ func (c *Controller) TimerReset(w http.ResponseWriter, _ *http.Request, _ httpro
 // TimerPlayerFinish will finish a specific player
 // req state: running
 func (c *Controller) TimerPlayerFinish(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
-	if c.invalidState("playerFinish", w) {
+	if !c.requireRunning(c.main, "playerFinish", w) {
 		return
 	}
 
@@ -179,11 +223,29 @@ func (c *Controller) TimerPlayerFinish(w http.ResponseWriter, r *http.Request, p
 		c.b.Response("", "id not provided or not valid int", 400, w)
 		return
 	}
-	c.b.CurrentRun.Players[pID].Timer.Finished = true
-	c.b.CurrentRun.Players[pID].Timer.Time = c.b.TimerTime
+	t := c.main.time()
+	valid := true
+	run := c.b.State.UpdateCurrentRun(func(r *models.Run) {
+		if pID < 0 || pID >= len(r.Players) {
+			valid = false
+			return
+		}
+		r.Players[pID].Timer.Finished = true
+		r.Players[pID].Timer.Time = t
+
+		// the team of the player might be done now too
+		if tID := r.PlayerTeam(pID); tID != -1 && !r.Teams[tID].Timer.Finished && r.TeamDone(tID) {
+			r.Teams[tID].Timer.Finished = true
+			r.Teams[tID].Timer.Time = t
+		}
+	})
+	if !valid {
+		c.b.Response("", "no player with that id", 400, w)
+		return
+	}
 	go c.b.WSCurrentUpdate()
 
-	if c.allFinished() {
+	if allFinished(&run) {
 		c.TimerFinish(w, r, ps)
 		return
 	}
@@ -192,38 +254,99 @@ func (c *Controller) TimerPlayerFinish(w http.ResponseWriter, r *http.Request, p
 
 }
 
-func (c *Controller) invalidState(method string, w http.ResponseWriter) bool {
-	f := true
-	if method == "start" && c.b.TimerState == common.TimerStopped {
-		f = false
-	} else if method == "finish" && c.b.TimerState == common.TimerRunning {
-		f = false
-	} else if method == "resume" && c.b.TimerState == common.TimerPaused || c.b.TimerState == common.TimerFinished {
-		f = false
-	} else if method == "playerFinish" && c.b.TimerState == common.TimerRunning {
-		f = false
-	} else if method == "pause" && c.b.TimerState == common.TimerRunning {
-		f = false
-	} else if method == "reset" && c.b.TimerState == common.TimerFinished || c.b.TimerState == common.TimerPaused {
-		f = false
+// TimerTeamFinish will finish a whole team. All members of the team which are not done yet are finished with the current time
+// req state: running
+func (c *Controller) TimerTeamFinish(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	if !c.requireRunning(c.main, "teamFinish", w) {
+		return
 	}
 
-	if f {
-		c.b.Response("", fmt.Sprintf("method %v not allowed with state %v", method, c.b.TimerState), 400, w)
+	tID, err := strconv.Atoi(ps.ByName("id"))
+	if err != nil {
+		c.b.Response("", "id not provided or not valid int", 400, w)
+		return
 	}
-	return f
-}
 
-func (c Controller) allFinished() bool {
-	count := 0
-	for i := 0; i < len(c.b.CurrentRun.Players); i++ {
-		if c.b.CurrentRun.Players[i].Timer.Finished == true {
-			count++
+	t := c.main.time()
+	valid := true
+	run := c.b.State.UpdateCurrentRun(func(r *models.Run) {
+		if tID < 0 || tID >= len(r.Teams) {
+			valid = false
+			return
 		}
+		team := &r.Teams[tID]
+		for _, m := range team.Members {
+			if m >= 0 && m < len(r.Players) && !r.Players[m].Timer.Finished {
+				r.Players[m].Timer.Finished = true
+				r.Players[m].Timer.Time = t
+			}
+		}
+		team.Timer.Finished = true
+		team.Timer.Time = t
+	})
+	if !valid {
+		c.b.Response("", "no team with that id", 400, w)
+		return
+	}
+	go c.b.WSCurrentUpdate()
+
+	if allFinished(&run) {
+		c.TimerFinish(w, r, ps)
+		return
 	}
 
-	if count == len(c.b.CurrentRun.Players) {
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// TimerResults returns the player and team results of the current run
+func (c *Controller) TimerResults(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
+	run := c.b.State.CurrentRun()
+	res := struct {
+		Players []models.PlayerInfo `json:"players"`
+		Teams   []models.TeamResult `json:"teams"`
+	}{run.Players, run.TeamResults()}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
+
+// apply does the transition for the action on the timer and sends an error response if it isn't allowed
+func (c *Controller) apply(t *instance, a stopwatch.Action, w http.ResponseWriter) (stopwatch.Event, bool) {
+	ev, err := t.sw.Apply(a)
+	if err != nil {
+		c.b.Response("", err.Error(), http.StatusBadRequest, w)
+		return ev, false
+	}
+
+	return ev, true
+}
+
+// requireRunning is used for actions which don't change the state of the timer but need it to be running
+func (c *Controller) requireRunning(t *instance, method string, w http.ResponseWriter) bool {
+	if s := t.sw.State(); s != stopwatch.Running {
+		err := &stopwatch.TransitionError{Action: stopwatch.Action(method), State: s}
+		c.b.Response("", err.Error(), http.StatusBadRequest, w)
+		return false
+	}
+
+	return true
+}
+
+func allFinished(r *models.Run) bool {
+	// in a team race the run is over once every team is done
+	if len(r.Teams) != 0 {
+		for i := 0; i < len(r.Teams); i++ {
+			if !r.Teams[i].Timer.Finished {
+				return false
+			}
+		}
 		return true
 	}
-	return false
+
+	for i := 0; i < len(r.Players); i++ {
+		if !r.Players[i].Timer.Finished {
+			return false
+		}
+	}
+	return true
 }
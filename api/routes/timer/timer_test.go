@@ -0,0 +1,126 @@
+package timer
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/onestay/MarathonTools-API/api/common"
+	"github.com/onestay/MarathonTools-API/api/models"
+	"github.com/onestay/MarathonTools-API/api/storage"
+	"github.com/onestay/MarathonTools-API/api/storage/boltstore"
+	"github.com/onestay/MarathonTools-API/ws"
+)
+
+// newTestController returns a time controller on an embedded database with two runs
+func newTestController(t *testing.T) (*Controller, *httprouter.Router) {
+	t.Helper()
+	s, err := boltstore.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	backend := s.Backend(storage.NewActive(storage.DefaultMarathon))
+
+	runs := []models.Run{
+		{RunID: primitive.NewObjectID(), GameInfo: models.GameInfo{GameName: "A"}, Players: []models.PlayerInfo{{DisplayName: "a"}, {DisplayName: "b"}}},
+		{RunID: primitive.NewObjectID(), GameInfo: models.GameInfo{GameName: "B"}, Players: []models.PlayerInfo{{DisplayName: "c"}}},
+	}
+	if err := backend.Runs.ReplaceAll(context.Background(), runs); err != nil {
+		t.Fatal(err)
+	}
+
+	hub := ws.NewHub()
+	go hub.Run()
+	b := common.NewController(hub, backend, 0)
+	router := httprouter.New()
+	c := NewTimeController(b, 5, router)
+
+	return c, router
+}
+
+func request(router http.Handler, path string) int {
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("POST", path, nil))
+	return w.Code
+}
+
+func TestTimerHandlersConcurrent(t *testing.T) {
+	c, router := newTestController(t)
+
+	paths := []string{
+		"/timer/start",
+		"/timer/pause",
+		"/timer/resume",
+		"/timer/finish",
+		"/timer/reset",
+		"/timer/player/finish/0",
+		"/timer/player/finish/1",
+	}
+
+	var wg sync.WaitGroup
+	for _, p := range paths {
+		wg.Add(1)
+		go func(p string) {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				if code := request(router, p); code != http.StatusNoContent && code != http.StatusBadRequest {
+					t.Errorf("%v returned %v", p, code)
+				}
+			}
+		}(p)
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 200; i++ {
+			snap := c.b.State.Snapshot()
+			if snap.TimerTime < 0 {
+				t.Errorf("negative timer time %v", snap.TimerTime)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest("GET", "/timer/results", nil))
+		}
+	}()
+	wg.Wait()
+
+	// the state seen by the other controllers has to end up as the state of the stopwatch
+	if got, want := c.b.State.TimerState(), c.main.sw.State(); got != want {
+		t.Errorf("store has timer state %v, stopwatch %v", got, want)
+	}
+}
+
+func TestTimerFinishFinishesPlayers(t *testing.T) {
+	c, router := newTestController(t)
+
+	if code := request(router, "/timer/start"); code != http.StatusNoContent {
+		t.Fatalf("start returned %v", code)
+	}
+	if code := request(router, "/timer/player/finish/0"); code != http.StatusNoContent {
+		t.Fatalf("player finish returned %v", code)
+	}
+	if c.b.State.TimerState() != common.TimerRunning {
+		t.Fatal("timer finished before all players were done")
+	}
+	if code := request(router, "/timer/player/finish/1"); code != http.StatusNoContent {
+		t.Fatalf("player finish returned %v", code)
+	}
+
+	if s := c.main.sw.State(); s != common.TimerFinished {
+		t.Errorf("timer state is %v after all players finished", s)
+	}
+	for _, p := range c.b.State.CurrentRun().Players {
+		if !p.Timer.Finished {
+			t.Errorf("player %v isn't finished", p.DisplayName)
+		}
+	}
+
+	if code := request(router, "/timer/player/finish/5"); code != http.StatusBadRequest {
+		t.Errorf("finishing a player of a finished timer returned %v", code)
+	}
+}
@@ -0,0 +1,230 @@
+// Package stopwatch provides the state machine behind the marathon timers.
+//
+// A Stopwatch only changes its state through the transitions declared in the transition table. Every transition
+// is done while holding a lock and emits an Event to all listeners once the lock is released. Listeners get the events
+// in the order of the transitions.
+package stopwatch
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// State represents the state of a stopwatch
+type State = int
+
+const (
+	// Running represents a running timer
+	Running State = iota
+	// Paused represents a paused timer
+	Paused
+	// Stopped represents a stopped timer
+	Stopped
+	// Finished represents a finished timer
+	Finished
+)
+
+// Action is something that can be done with a stopwatch
+type Action string
+
+const (
+	// Start starts a stopped stopwatch
+	Start Action = "start"
+	// Pause pauses a running stopwatch
+	Pause Action = "pause"
+	// Resume continues a paused or finished stopwatch
+	Resume Action = "resume"
+	// Finish finishes a running stopwatch
+	Finish Action = "finish"
+	// Reset resets a paused or finished stopwatch back to zero
+	Reset Action = "reset"
+)
+
+// transitions declares for every state which actions are allowed and which state they lead to
+var transitions = map[State]map[Action]State{
+	Stopped: {
+		Start: Running,
+	},
+	Running: {
+		Pause:  Paused,
+		Finish: Finished,
+	},
+	Paused: {
+		Resume: Running,
+		Reset:  Stopped,
+	},
+	Finished: {
+		Resume: Running,
+		Reset:  Stopped,
+	},
+}
+
+// Clock is the source of time for a stopwatch
+type Clock interface {
+	Now() time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+// RealClock is a Clock using the system time
+var RealClock Clock = realClock{}
+
+// Event is emitted after every successful transition
+type Event struct {
+	Action  Action
+	From    State
+	To      State
+	Elapsed time.Duration
+	At      time.Time
+}
+
+// TransitionError is returned when an action isn't allowed in the current state
+type TransitionError struct {
+	Action Action
+	State  State
+}
+
+func (e *TransitionError) Error() string {
+	return fmt.Sprintf("method %v not allowed with state %v", e.Action, e.State)
+}
+
+// Stopwatch is a timer which can only be changed through the transitions of the transition table
+type Stopwatch struct {
+	mu sync.Mutex
+	// notifyMu is taken before mu is released and held while calling the listeners so concurrent transitions are
+	// delivered in order
+	notifyMu  sync.Mutex
+	clock     Clock
+	state     State
+	elapsed   time.Duration
+	since     time.Time
+	listeners []func(Event)
+}
+
+// New returns a new stopped stopwatch using the given clock. If clock is nil the system time is used
+func New(clock Clock) *Stopwatch {
+	if clock == nil {
+		clock = RealClock
+	}
+
+	return &Stopwatch{
+		clock: clock,
+		state: Stopped,
+	}
+}
+
+// Subscribe adds a listener which is called with every event. Listeners are called in the goroutine doing the transition.
+// They may read the stopwatch but mustn't apply actions
+func (s *Stopwatch) Subscribe(l func(Event)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.listeners = append(s.listeners, l)
+}
+
+// Can reports whether the action is allowed in the current state
+func (s *Stopwatch) Can(a Action) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := transitions[s.state][a]
+	return ok
+}
+
+// State returns the current state
+func (s *Stopwatch) State() State {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.state
+}
+
+// Elapsed returns the time the stopwatch has been running for
+func (s *Stopwatch) Elapsed() time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.elapsedLocked()
+}
+
+func (s *Stopwatch) elapsedLocked() time.Duration {
+	if s.state == Running {
+		return s.elapsed + s.clock.Now().Sub(s.since)
+	}
+	return s.elapsed
+}
+
+// Apply does the transition for the action and returns the emitted event. A *TransitionError is returned if the action isn't allowed
+func (s *Stopwatch) Apply(a Action) (Event, error) {
+	s.mu.Lock()
+	from := s.state
+	to, ok := transitions[from][a]
+	if !ok {
+		s.mu.Unlock()
+		return Event{}, &TransitionError{a, from}
+	}
+
+	now := s.clock.Now()
+	switch a {
+	case Start:
+		s.elapsed = 0
+		s.since = now
+	case Pause, Finish:
+		s.elapsed += now.Sub(s.since)
+	case Resume:
+		s.since = now
+	case Reset:
+		s.elapsed = 0
+	}
+	s.state = to
+
+	ev := Event{
+		Action:  a,
+		From:    from,
+		To:      to,
+		Elapsed: s.elapsed,
+		At:      now,
+	}
+	listeners := make([]func(Event), len(s.listeners))
+	copy(listeners, s.listeners)
+	s.notifyMu.Lock()
+	s.mu.Unlock()
+
+	for _, l := range listeners {
+		l(ev)
+	}
+	s.notifyMu.Unlock()
+
+	return ev, nil
+}
+
+// Start starts the stopwatch
+func (s *Stopwatch) Start() error {
+	_, err := s.Apply(Start)
+	return err
+}
+
+// Pause pauses the stopwatch
+func (s *Stopwatch) Pause() error {
+	_, err := s.Apply(Pause)
+	return err
+}
+
+// Resume resumes the stopwatch
+func (s *Stopwatch) Resume() error {
+	_, err := s.Apply(Resume)
+	return err
+}
+
+// Finish finishes the stopwatch
+func (s *Stopwatch) Finish() error {
+	_, err := s.Apply(Finish)
+	return err
+}
+
+// Reset resets the stopwatch
+func (s *Stopwatch) Reset() error {
+	_, err := s.Apply(Reset)
+	return err
+}
@@ -0,0 +1,236 @@
+package stopwatch
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock is a Clock which only moves when advanced
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// inState returns a stopwatch which has been brought into state through allowed transitions
+func inState(t *testing.T, state State, clock Clock) *Stopwatch {
+	t.Helper()
+	paths := map[State][]Action{
+		Stopped:  nil,
+		Running:  {Start},
+		Paused:   {Start, Pause},
+		Finished: {Start, Finish},
+	}
+
+	s := New(clock)
+	for _, a := range paths[state] {
+		if _, err := s.Apply(a); err != nil {
+			t.Fatalf("bringing stopwatch into state %v: %v", state, err)
+		}
+	}
+
+	return s
+}
+
+func TestTransitions(t *testing.T) {
+	tests := []struct {
+		from    State
+		action  Action
+		allowed bool
+		to      State
+	}{
+		{Stopped, Start, true, Running},
+		{Stopped, Pause, false, Stopped},
+		{Stopped, Resume, false, Stopped},
+		{Stopped, Finish, false, Stopped},
+		{Stopped, Reset, false, Stopped},
+
+		{Running, Start, false, Running},
+		{Running, Pause, true, Paused},
+		{Running, Resume, false, Running},
+		{Running, Finish, true, Finished},
+		{Running, Reset, false, Running},
+
+		{Paused, Start, false, Paused},
+		{Paused, Pause, false, Paused},
+		{Paused, Resume, true, Running},
+		{Paused, Finish, false, Paused},
+		{Paused, Reset, true, Stopped},
+
+		{Finished, Start, false, Finished},
+		{Finished, Pause, false, Finished},
+		{Finished, Resume, true, Running},
+		{Finished, Finish, false, Finished},
+		{Finished, Reset, true, Stopped},
+	}
+
+	for _, tt := range tests {
+		s := inState(t, tt.from, newFakeClock())
+
+		if got := s.Can(tt.action); got != tt.allowed {
+			t.Errorf("%v in state %v: Can = %v, want %v", tt.action, tt.from, got, tt.allowed)
+		}
+
+		ev, err := s.Apply(tt.action)
+		if tt.allowed {
+			if err != nil {
+				t.Errorf("%v in state %v: unexpected error %v", tt.action, tt.from, err)
+				continue
+			}
+			if ev.Action != tt.action || ev.From != tt.from || ev.To != tt.to {
+				t.Errorf("%v in state %v: event %+v, want from %v to %v", tt.action, tt.from, ev, tt.from, tt.to)
+			}
+		} else {
+			var te *TransitionError
+			if !errors.As(err, &te) {
+				t.Errorf("%v in state %v: error %v, want a *TransitionError", tt.action, tt.from, err)
+				continue
+			}
+			if te.Action != tt.action || te.State != tt.from {
+				t.Errorf("%v in state %v: error %+v has the wrong action or state", tt.action, tt.from, te)
+			}
+		}
+
+		if got := s.State(); got != tt.to {
+			t.Errorf("%v in state %v: state is %v, want %v", tt.action, tt.from, got, tt.to)
+		}
+	}
+}
+
+func TestTransitionTableCoversAllStates(t *testing.T) {
+	for _, state := range []State{Stopped, Running, Paused, Finished} {
+		if _, ok := transitions[state]; !ok {
+			t.Errorf("state %v has no transitions", state)
+		}
+	}
+}
+
+func TestElapsed(t *testing.T) {
+	type step struct {
+		advance time.Duration
+		action  Action
+		// elapsed is the expected elapsed time after the action
+		elapsed time.Duration
+	}
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{"start", []step{
+			{0, Start, 0},
+			{5 * time.Second, "", 5 * time.Second},
+		}},
+		{"pause keeps the time", []step{
+			{0, Start, 0},
+			{10 * time.Second, Pause, 10 * time.Second},
+			{time.Minute, "", 10 * time.Second},
+		}},
+		{"resume continues", []step{
+			{0, Start, 0},
+			{10 * time.Second, Pause, 10 * time.Second},
+			{time.Minute, Resume, 10 * time.Second},
+			{5 * time.Second, "", 15 * time.Second},
+		}},
+		{"finish", []step{
+			{0, Start, 0},
+			{90 * time.Second, Finish, 90 * time.Second},
+			{time.Hour, "", 90 * time.Second},
+		}},
+		{"finish after a pause", []step{
+			{0, Start, 0},
+			{20 * time.Second, Pause, 20 * time.Second},
+			{time.Minute, Resume, 20 * time.Second},
+			{30 * time.Second, Finish, 50 * time.Second},
+			{time.Minute, "", 50 * time.Second},
+		}},
+		{"resume after finish", []step{
+			{0, Start, 0},
+			{30 * time.Second, Finish, 30 * time.Second},
+			{time.Minute, Resume, 30 * time.Second},
+			{10 * time.Second, "", 40 * time.Second},
+		}},
+		{"reset", []step{
+			{0, Start, 0},
+			{30 * time.Second, Pause, 30 * time.Second},
+			{0, Reset, 0},
+			{time.Minute, "", 0},
+		}},
+		{"start after reset", []step{
+			{0, Start, 0},
+			{30 * time.Second, Finish, 30 * time.Second},
+			{0, Reset, 0},
+			{time.Minute, Start, 0},
+			{5 * time.Second, "", 5 * time.Second},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := newFakeClock()
+			s := New(clock)
+			for i, st := range tt.steps {
+				clock.Advance(st.advance)
+				if len(st.action) != 0 {
+					ev, err := s.Apply(st.action)
+					if err != nil {
+						t.Fatalf("step %v: %v", i, err)
+					}
+					if st.action != Start && st.action != Resume && ev.Elapsed != st.elapsed {
+						t.Errorf("step %v: event elapsed %v, want %v", i, ev.Elapsed, st.elapsed)
+					}
+					if !ev.At.Equal(clock.Now()) {
+						t.Errorf("step %v: event at %v, want %v", i, ev.At, clock.Now())
+					}
+				}
+				if got := s.Elapsed(); got != st.elapsed {
+					t.Errorf("step %v: elapsed %v, want %v", i, got, st.elapsed)
+				}
+			}
+		})
+	}
+}
+
+func TestListeners(t *testing.T) {
+	s := New(newFakeClock())
+	var got []Event
+	s.Subscribe(func(e Event) {
+		got = append(got, e)
+		// listeners are called without the lock so they can read the stopwatch
+		s.State()
+	})
+
+	s.Start()
+	s.Reset()
+	s.Finish()
+
+	if len(got) != 2 {
+		t.Fatalf("got %v events, want 2 since a rejected action emits nothing", len(got))
+	}
+	if got[0].Action != Start || got[1].Action != Finish {
+		t.Errorf("got events %+v, want start and finish", got)
+	}
+}
+
+func TestNewUsesRealClock(t *testing.T) {
+	s := New(nil)
+	if s.clock != RealClock {
+		t.Errorf("New(nil) doesn't use the real clock")
+	}
+}
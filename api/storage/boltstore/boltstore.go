@@ -0,0 +1,157 @@
+// Package boltstore implements all storage interfaces with an embedded bbolt database file.
+// It allows running the API as a single binary without MongoDB and Redis.
+package boltstore
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/onestay/MarathonTools-API/api/storage"
+)
+
+var (
+	// runsBucket holds the whole schedule under scheduleKey so the order of the runs is kept
+	runsBucket    = []byte("runs")
+	resultsBucket = []byte("results")
+	historyBucket = []byte("history")
+	// kvBucket holds settings, the checklist and everything social
+	kvBucket        = []byte("kv")
+	marathonsBucket = []byte("marathons")
+	runnersBucket   = []byte("runners")
+	scheduleKey     = []byte("schedule")
+)
+
+// Store holds the bbolt database
+type Store struct {
+	db *bolt.DB
+}
+
+// Open opens or creates the database file at path
+func Open(path string) (*Store, error) {
+	if dir := filepath.Dir(path); dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, err
+		}
+	}
+
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, b := range [][]byte{runsBucket, resultsBucket, kvBucket, marathonsBucket, runnersBucket} {
+			if _, err := tx.CreateBucketIfNotExists(b); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &Store{db}, nil
+}
+
+// Close closes the database file
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// Backend returns all repositories of the store. They operate on the marathon held by active
+func (s *Store) Backend(active *storage.Active) storage.Backend {
+	b := s.scoped(active.ID)
+	b.Marathons = marathonRepository{s}
+	b.Runners = runnerRepository{s}
+	b.Active = active
+	b.Event = func(id string) storage.Backend {
+		return s.scoped(storage.Fixed(id))
+	}
+	b.Close = s.Close
+
+	return b
+}
+
+func (s *Store) scoped(scope storage.Scope) storage.Backend {
+	return storage.Backend{
+		Runs:      runRepository{s, scope},
+		History:   historyRepository{s, scope},
+		Results:   resultRepository{s, scope},
+		Settings:  settingsRepository{s, scope},
+		Checklist: checklistRepository{s, scope},
+		Hosts:     hostRepository{s, scope},
+		Social:    socialRepository{s, scope},
+	}
+}
+
+// bucketName returns the name of the bucket for the scoped marathon. The default marathon uses the plain name
+func bucketName(name []byte, scope storage.Scope) []byte {
+	if id := scope(); id != storage.DefaultMarathon {
+		return []byte(string(name) + "/" + id)
+	}
+
+	return name
+}
+
+// readBucket returns the bucket for the scoped marathon. It's nil if nothing has been written to it yet
+func readBucket(tx *bolt.Tx, name []byte, scope storage.Scope) *bolt.Bucket {
+	return tx.Bucket(bucketName(name, scope))
+}
+
+// writeBucket returns the bucket for the scoped marathon and creates it if needed
+func writeBucket(tx *bolt.Tx, name []byte, scope storage.Scope) (*bolt.Bucket, error) {
+	return tx.CreateBucketIfNotExists(bucketName(name, scope))
+}
+
+func get(b *bolt.Bucket, key []byte, v interface{}) error {
+	if b == nil {
+		return storage.ErrNotFound
+	}
+	data := b.Get(key)
+	if data == nil {
+		return storage.ErrNotFound
+	}
+
+	return json.Unmarshal(data, v)
+}
+
+func put(b *bolt.Bucket, key []byte, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	return b.Put(key, data)
+}
+
+func (s *Store) getKV(scope storage.Scope, key string, v interface{}) error {
+	return s.db.View(func(tx *bolt.Tx) error {
+		return get(readBucket(tx, kvBucket, scope), []byte(key), v)
+	})
+}
+
+func (s *Store) putKV(scope storage.Scope, key string, v interface{}) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b, err := writeBucket(tx, kvBucket, scope)
+		if err != nil {
+			return err
+		}
+		return put(b, []byte(key), v)
+	})
+}
+
+func (s *Store) deleteKV(scope storage.Scope, key string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := readBucket(tx, kvBucket, scope)
+		if b == nil {
+			return nil
+		}
+		return b.Delete([]byte(key))
+	})
+}
@@ -0,0 +1,75 @@
+package boltstore
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/onestay/MarathonTools-API/api/models"
+	"github.com/onestay/MarathonTools-API/api/storage"
+)
+
+type historyRepository struct {
+	s     *Store
+	scope storage.Scope
+}
+
+// versionKey encodes the version big endian so the keys are sorted by version
+func versionKey(v int) []byte {
+	k := make([]byte, 8)
+	binary.BigEndian.PutUint64(k, uint64(v))
+	return k
+}
+
+func (r historyRepository) Add(_ context.Context, v models.ScheduleVersion) (int, error) {
+	err := r.s.db.Update(func(tx *bolt.Tx) error {
+		b, err := writeBucket(tx, historyBucket, r.scope)
+		if err != nil {
+			return err
+		}
+
+		seq, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+		v.Version = int(seq)
+
+		return put(b, versionKey(v.Version), v)
+	})
+
+	return v.Version, err
+}
+
+func (r historyRepository) List(_ context.Context) ([]models.ScheduleVersion, error) {
+	versions := []models.ScheduleVersion{}
+	err := r.s.db.View(func(tx *bolt.Tx) error {
+		b := readBucket(tx, historyBucket, r.scope)
+		if b == nil {
+			return nil
+		}
+
+		c := b.Cursor()
+		for k, data := c.Last(); k != nil; k, data = c.Prev() {
+			var v models.ScheduleVersion
+			if err := json.Unmarshal(data, &v); err != nil {
+				return err
+			}
+			v.Runs = nil
+			versions = append(versions, v)
+		}
+		return nil
+	})
+
+	return versions, err
+}
+
+func (r historyRepository) Get(_ context.Context, version int) (models.ScheduleVersion, error) {
+	var v models.ScheduleVersion
+	err := r.s.db.View(func(tx *bolt.Tx) error {
+		return get(readBucket(tx, historyBucket, r.scope), versionKey(version), &v)
+	})
+
+	return v, err
+}
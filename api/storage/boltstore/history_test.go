@@ -0,0 +1,54 @@
+package boltstore
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/onestay/MarathonTools-API/api/models"
+	"github.com/onestay/MarathonTools-API/api/storage"
+)
+
+func TestHistoryAddConcurrent(t *testing.T) {
+	s, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	h := s.Backend(storage.NewActive(storage.DefaultMarathon)).History
+
+	const n = 20
+	versions := make(chan int, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v, err := h.Add(context.Background(), models.ScheduleVersion{})
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			versions <- v
+		}()
+	}
+	wg.Wait()
+	close(versions)
+
+	seen := make(map[int]bool)
+	for v := range versions {
+		if seen[v] {
+			t.Errorf("version %v was allocated twice", v)
+		}
+		seen[v] = true
+	}
+
+	list, err := h.List(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != n {
+		t.Errorf("%v versions stored, want %v", len(list), n)
+	}
+}
@@ -0,0 +1,106 @@
+package boltstore
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/onestay/MarathonTools-API/api/models"
+	"github.com/onestay/MarathonTools-API/api/storage"
+)
+
+type marathonRepository struct {
+	s *Store
+}
+
+func (r marathonRepository) All(_ context.Context) ([]models.Marathon, error) {
+	marathons := []models.Marathon{}
+	err := r.s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(marathonsBucket).ForEach(func(_, v []byte) error {
+			var m models.Marathon
+			if err := json.Unmarshal(v, &m); err != nil {
+				return err
+			}
+			marathons = append(marathons, m)
+			return nil
+		})
+	})
+
+	sort.Slice(marathons, func(i, j int) bool {
+		return marathons[i].Created.Before(marathons[j].Created)
+	})
+
+	return marathons, err
+}
+
+func (r marathonRepository) Get(_ context.Context, id string) (models.Marathon, error) {
+	var m models.Marathon
+	err := r.s.db.View(func(tx *bolt.Tx) error {
+		return get(tx.Bucket(marathonsBucket), []byte(id), &m)
+	})
+
+	return m, err
+}
+
+func (r marathonRepository) Insert(_ context.Context, m models.Marathon) error {
+	return r.s.db.Update(func(tx *bolt.Tx) error {
+		return put(tx.Bucket(marathonsBucket), []byte(m.ID), m)
+	})
+}
+
+func (r marathonRepository) Update(_ context.Context, m models.Marathon) error {
+	return r.s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(marathonsBucket)
+		if b.Get([]byte(m.ID)) == nil {
+			return storage.ErrNotFound
+		}
+		return put(b, []byte(m.ID), m)
+	})
+}
+
+func (r marathonRepository) Active(ctx context.Context) (string, error) {
+	marathons, err := r.All(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	for _, m := range marathons {
+		if m.Active {
+			return m.ID, nil
+		}
+	}
+
+	return "", storage.ErrNotFound
+}
+
+func (r marathonRepository) SetActive(_ context.Context, id string) error {
+	return r.s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(marathonsBucket)
+		if b.Get([]byte(id)) == nil {
+			return storage.ErrNotFound
+		}
+
+		var marathons []models.Marathon
+		err := b.ForEach(func(_, v []byte) error {
+			var m models.Marathon
+			if err := json.Unmarshal(v, &m); err != nil {
+				return err
+			}
+			marathons = append(marathons, m)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, m := range marathons {
+			m.Active = m.ID == id
+			if err := put(b, []byte(m.ID), m); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,206 @@
+package boltstore
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+
+	bolt "go.etcd.io/bbolt"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/onestay/MarathonTools-API/api/models"
+	"github.com/onestay/MarathonTools-API/api/storage"
+)
+
+type resultRepository struct {
+	s     *Store
+	scope storage.Scope
+}
+
+func (r resultRepository) Save(_ context.Context, res models.RunResult) error {
+	return r.s.db.Update(func(tx *bolt.Tx) error {
+		b, err := writeBucket(tx, resultsBucket, r.scope)
+		if err != nil {
+			return err
+		}
+		return put(b, []byte(res.RunID.Hex()), res)
+	})
+}
+
+func (r resultRepository) Get(_ context.Context, runID primitive.ObjectID) (models.RunResult, error) {
+	var res models.RunResult
+	err := r.s.db.View(func(tx *bolt.Tx) error {
+		return get(readBucket(tx, resultsBucket, r.scope), []byte(runID.Hex()), &res)
+	})
+
+	return res, err
+}
+
+func (r resultRepository) All(_ context.Context) ([]models.RunResult, error) {
+	results := []models.RunResult{}
+	err := r.s.db.View(func(tx *bolt.Tx) error {
+		b := readBucket(tx, resultsBucket, r.scope)
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(_, v []byte) error {
+			var res models.RunResult
+			if err := json.Unmarshal(v, &res); err != nil {
+				return err
+			}
+			results = append(results, res)
+			return nil
+		})
+	})
+
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Finished.Before(results[j].Finished)
+	})
+
+	return results, err
+}
+
+type settingsRepository struct {
+	s     *Store
+	scope storage.Scope
+}
+
+func (r settingsRepository) Get(_ context.Context) (models.Settings, error) {
+	var settings models.Settings
+	err := r.s.getKV(r.scope, "settings", &settings)
+	return settings, err
+}
+
+func (r settingsRepository) Save(_ context.Context, settings models.Settings) error {
+	return r.s.putKV(r.scope, "settings", settings)
+}
+
+type checklistRepository struct {
+	s     *Store
+	scope storage.Scope
+}
+
+func (r checklistRepository) Get(_ context.Context) ([]models.ChecklistItem, error) {
+	var items []models.ChecklistItem
+	err := r.s.getKV(r.scope, "checklist", &items)
+	return items, err
+}
+
+func (r checklistRepository) Save(_ context.Context, items []models.ChecklistItem) error {
+	return r.s.putKV(r.scope, "checklist", items)
+}
+
+func (r checklistRepository) AddLog(_ context.Context, entry models.ChecklistLogEntry) error {
+	k := []byte("checklistLog:" + entry.RunID.Hex())
+	return r.s.db.Update(func(tx *bolt.Tx) error {
+		b, err := writeBucket(tx, kvBucket, r.scope)
+		if err != nil {
+			return err
+		}
+
+		var entries []models.ChecklistLogEntry
+		if err := get(b, k, &entries); err != nil && err != storage.ErrNotFound {
+			return err
+		}
+
+		return put(b, k, append(entries, entry))
+	})
+}
+
+func (r checklistRepository) Log(_ context.Context, runID primitive.ObjectID) ([]models.ChecklistLogEntry, error) {
+	entries := []models.ChecklistLogEntry{}
+	err := r.s.getKV(r.scope, "checklistLog:"+runID.Hex(), &entries)
+	if err == storage.ErrNotFound {
+		return entries, nil
+	}
+
+	return entries, err
+}
+
+type hostRepository struct {
+	s     *Store
+	scope storage.Scope
+}
+
+func (r hostRepository) Get(_ context.Context) ([]models.HostSlot, error) {
+	var slots []models.HostSlot
+	err := r.s.getKV(r.scope, "hosts", &slots)
+	return slots, err
+}
+
+func (r hostRepository) Save(_ context.Context, slots []models.HostSlot) error {
+	return r.s.putKV(r.scope, "hosts", slots)
+}
+
+type socialRepository struct {
+	s     *Store
+	scope storage.Scope
+}
+
+func (r socialRepository) TwitchSettings(_ context.Context) (models.TwitchSettings, error) {
+	var ts models.TwitchSettings
+	err := r.s.getKV(r.scope, "twitchSettings", &ts)
+	return ts, err
+}
+
+func (r socialRepository) SaveTwitchSettings(_ context.Context, ts models.TwitchSettings) error {
+	return r.s.putKV(r.scope, "twitchSettings", ts)
+}
+
+func (r socialRepository) TwitchToken(_ context.Context) (models.TwitchToken, error) {
+	var t models.TwitchToken
+	err := r.s.getKV(r.scope, "twitchToken", &t)
+	return t, err
+}
+
+func (r socialRepository) SaveTwitchToken(_ context.Context, t models.TwitchToken) error {
+	return r.s.putKV(r.scope, "twitchToken", t)
+}
+
+func (r socialRepository) DeleteTwitchToken(_ context.Context) error {
+	return r.s.deleteKV(r.scope, "twitchToken")
+}
+
+func (r socialRepository) TwitterSettings(_ context.Context) (models.TwitterSettings, error) {
+	var ts models.TwitterSettings
+	err := r.s.getKV(r.scope, "twitterSettings", &ts)
+	return ts, err
+}
+
+func (r socialRepository) SaveTwitterSettings(_ context.Context, ts models.TwitterSettings) error {
+	return r.s.putKV(r.scope, "twitterSettings", ts)
+}
+
+func (r socialRepository) TwitterTemplates(_ context.Context) ([]models.TwitterTemplate, error) {
+	var t []models.TwitterTemplate
+	err := r.s.getKV(r.scope, "twitterTemplates", &t)
+	return t, err
+}
+
+func (r socialRepository) SaveTwitterTemplates(_ context.Context, t []models.TwitterTemplate) error {
+	return r.s.putKV(r.scope, "twitterTemplates", t)
+}
+
+func (r socialRepository) AutomationRules(_ context.Context) ([]models.AutomationRule, error) {
+	var rules []models.AutomationRule
+	err := r.s.getKV(r.scope, "automationRules", &rules)
+	return rules, err
+}
+
+func (r socialRepository) SaveAutomationRules(_ context.Context, rules []models.AutomationRule) error {
+	return r.s.putKV(r.scope, "automationRules", rules)
+}
+
+func (r socialRepository) VODMarkers(_ context.Context) ([]models.VODMarker, error) {
+	var markers []models.VODMarker
+	err := r.s.getKV(r.scope, "vodMarkers", &markers)
+	return markers, err
+}
+
+func (r socialRepository) SaveVODMarkers(_ context.Context, markers []models.VODMarker) error {
+	return r.s.putKV(r.scope, "vodMarkers", markers)
+}
+
+func (r socialRepository) DeleteVODMarkers(_ context.Context) error {
+	return r.s.deleteKV(r.scope, "vodMarkers")
+}
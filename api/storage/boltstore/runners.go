@@ -0,0 +1,73 @@
+package boltstore
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strings"
+
+	bolt "go.etcd.io/bbolt"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/onestay/MarathonTools-API/api/models"
+	"github.com/onestay/MarathonTools-API/api/storage"
+)
+
+type runnerRepository struct {
+	s *Store
+}
+
+func (r runnerRepository) All(_ context.Context) ([]models.Runner, error) {
+	runners := []models.Runner{}
+	err := r.s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(runnersBucket).ForEach(func(_, v []byte) error {
+			var runner models.Runner
+			if err := json.Unmarshal(v, &runner); err != nil {
+				return err
+			}
+			runners = append(runners, runner)
+			return nil
+		})
+	})
+
+	sort.Slice(runners, func(i, j int) bool {
+		return strings.ToLower(runners[i].DisplayName) < strings.ToLower(runners[j].DisplayName)
+	})
+
+	return runners, err
+}
+
+func (r runnerRepository) Get(_ context.Context, id primitive.ObjectID) (models.Runner, error) {
+	var runner models.Runner
+	err := r.s.db.View(func(tx *bolt.Tx) error {
+		return get(tx.Bucket(runnersBucket), []byte(id.Hex()), &runner)
+	})
+
+	return runner, err
+}
+
+func (r runnerRepository) Insert(_ context.Context, runner models.Runner) error {
+	return r.s.db.Update(func(tx *bolt.Tx) error {
+		return put(tx.Bucket(runnersBucket), []byte(runner.ID.Hex()), runner)
+	})
+}
+
+func (r runnerRepository) Update(_ context.Context, runner models.Runner) error {
+	return r.s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(runnersBucket)
+		if b.Get([]byte(runner.ID.Hex())) == nil {
+			return storage.ErrNotFound
+		}
+		return put(b, []byte(runner.ID.Hex()), runner)
+	})
+}
+
+func (r runnerRepository) Delete(_ context.Context, id primitive.ObjectID) error {
+	return r.s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(runnersBucket)
+		if b.Get([]byte(id.Hex())) == nil {
+			return storage.ErrNotFound
+		}
+		return b.Delete([]byte(id.Hex()))
+	})
+}
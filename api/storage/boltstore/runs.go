@@ -0,0 +1,140 @@
+package boltstore
+
+import (
+	"context"
+
+	bolt "go.etcd.io/bbolt"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/onestay/MarathonTools-API/api/models"
+	"github.com/onestay/MarathonTools-API/api/storage"
+)
+
+type runRepository struct {
+	s     *Store
+	scope storage.Scope
+}
+
+func (r runRepository) getSchedule(tx *bolt.Tx) ([]models.Run, error) {
+	runs := []models.Run{}
+	err := get(readBucket(tx, runsBucket, r.scope), scheduleKey, &runs)
+	if err == storage.ErrNotFound {
+		return runs, nil
+	}
+
+	return runs, err
+}
+
+func (r runRepository) putSchedule(tx *bolt.Tx, runs []models.Run) error {
+	b, err := writeBucket(tx, runsBucket, r.scope)
+	if err != nil {
+		return err
+	}
+	return put(b, scheduleKey, runs)
+}
+
+// updateSchedule calls f with the schedule and saves what f returns
+func (r runRepository) updateSchedule(f func(runs []models.Run) ([]models.Run, error)) error {
+	return r.s.db.Update(func(tx *bolt.Tx) error {
+		runs, err := r.getSchedule(tx)
+		if err != nil {
+			return err
+		}
+
+		runs, err = f(runs)
+		if err != nil {
+			return err
+		}
+
+		return r.putSchedule(tx, runs)
+	})
+}
+
+func indexOf(runs []models.Run, id primitive.ObjectID) int {
+	for i := range runs {
+		if runs[i].RunID == id {
+			return i
+		}
+	}
+
+	return -1
+}
+
+func (r runRepository) All(_ context.Context) ([]models.Run, error) {
+	var runs []models.Run
+	err := r.s.db.View(func(tx *bolt.Tx) error {
+		var err error
+		runs, err = r.getSchedule(tx)
+		return err
+	})
+
+	return runs, err
+}
+
+func (r runRepository) Get(ctx context.Context, id primitive.ObjectID) (models.Run, error) {
+	runs, err := r.All(ctx)
+	if err != nil {
+		return models.Run{}, err
+	}
+
+	i := indexOf(runs, id)
+	if i == -1 {
+		return models.Run{}, storage.ErrNotFound
+	}
+
+	return runs[i], nil
+}
+
+func (r runRepository) Count(ctx context.Context) (int, error) {
+	runs, err := r.All(ctx)
+	return len(runs), err
+}
+
+func (r runRepository) Insert(_ context.Context, run models.Run) error {
+	return r.updateSchedule(func(runs []models.Run) ([]models.Run, error) {
+		return append(runs, run), nil
+	})
+}
+
+func (r runRepository) Update(_ context.Context, run models.Run) error {
+	return r.updateSchedule(func(runs []models.Run) ([]models.Run, error) {
+		i := indexOf(runs, run.RunID)
+		if i == -1 {
+			return nil, storage.ErrNotFound
+		}
+		if runs[i].Version != run.Version {
+			return nil, storage.ErrConflict
+		}
+		run.Version++
+		runs[i] = run
+		return runs, nil
+	})
+}
+
+func (r runRepository) Delete(_ context.Context, id primitive.ObjectID) error {
+	return r.updateSchedule(func(runs []models.Run) ([]models.Run, error) {
+		i := indexOf(runs, id)
+		if i == -1 {
+			return nil, storage.ErrNotFound
+		}
+		return append(runs[:i], runs[i+1:]...), nil
+	})
+}
+
+func (r runRepository) ReplaceAll(_ context.Context, runs []models.Run) error {
+	return r.s.db.Update(func(tx *bolt.Tx) error {
+		return r.putSchedule(tx, runs)
+	})
+}
+
+func (r runRepository) SetSetupResult(_ context.Context, id primitive.ObjectID, res models.SetupResult) error {
+	return r.updateSchedule(func(runs []models.Run) ([]models.Run, error) {
+		i := indexOf(runs, id)
+		if i == -1 {
+			return nil, storage.ErrNotFound
+		}
+		runs[i].SetupResult = &res
+		runs[i].Version++
+		return runs, nil
+	})
+}
@@ -0,0 +1,90 @@
+package mongostore
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/onestay/MarathonTools-API/api/models"
+	"github.com/onestay/MarathonTools-API/api/storage"
+)
+
+type historyRepository struct {
+	col func() *mongo.Collection
+	// counters holds the last allocated version number in the document with the id of the collection
+	counters func() *mongo.Collection
+	timeout  time.Duration
+}
+
+// Add allocates the version number with an atomic increment so concurrent edits never get the same number
+func (r *historyRepository) Add(ctx context.Context, v models.ScheduleVersion) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	version, err := r.nextVersion(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	v.Version = version
+	_, err = r.col().InsertOne(ctx, v)
+	return v.Version, err
+}
+
+// nextVersion increments the counter and returns the new value. The counter is raised to the latest stored version
+// first since versions written before the counter existed aren't counted
+func (r *historyRepository) nextVersion(ctx context.Context) (int, error) {
+	latest := models.ScheduleVersion{}
+	err := r.col().FindOne(ctx, bson.M{}, options.FindOne().SetSort(bson.M{"_id": -1}).SetProjection(bson.M{"runs": 0})).Decode(&latest)
+	if err != nil && err != mongo.ErrNoDocuments {
+		return 0, err
+	}
+
+	name := r.col().Name()
+	_, err = r.counters().UpdateOne(ctx, bson.M{"_id": name}, bson.M{"$max": bson.M{"seq": latest.Version}}, options.Update().SetUpsert(true))
+	if err != nil {
+		return 0, err
+	}
+
+	counter := struct {
+		Seq int `bson:"seq"`
+	}{}
+	err = r.counters().FindOneAndUpdate(ctx, bson.M{"_id": name}, bson.M{"$inc": bson.M{"seq": 1}},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)).Decode(&counter)
+
+	return counter.Seq, err
+}
+
+func (r *historyRepository) List(ctx context.Context) ([]models.ScheduleVersion, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	cur, err := r.col().Find(ctx, bson.M{}, options.Find().SetSort(bson.M{"_id": -1}).SetProjection(bson.M{"runs": 0}))
+	if err != nil {
+		return nil, err
+	}
+
+	versions := []models.ScheduleVersion{}
+	err = cur.All(ctx, &versions)
+	if err != nil {
+		return nil, err
+	}
+
+	return versions, nil
+}
+
+func (r *historyRepository) Get(ctx context.Context, version int) (models.ScheduleVersion, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	v := models.ScheduleVersion{}
+	err := r.col().FindOne(ctx, bson.M{"_id": version}).Decode(&v)
+	if err == mongo.ErrNoDocuments {
+		return v, storage.ErrNotFound
+	}
+
+	return v, err
+}
@@ -0,0 +1,92 @@
+package mongostore
+
+import (
+	"context"
+	"os"
+	"sync"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/onestay/MarathonTools-API/api/models"
+	"github.com/onestay/MarathonTools-API/api/storage"
+)
+
+// connectTest connects to the server in MONGO_TEST_URI and skips the test if it isn't set. Every test uses its own
+// database which is dropped afterwards
+func connectTest(t *testing.T) *Store {
+	t.Helper()
+	uri := os.Getenv("MONGO_TEST_URI")
+	if len(uri) == 0 {
+		t.Skip("MONGO_TEST_URI isn't set")
+	}
+
+	s, err := Connect(context.Background(), uri, "marathontest_"+primitive.NewObjectID().Hex(), DefaultTimeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		s.db(storage.DefaultMarathon).Drop(context.Background())
+		s.Close(context.Background())
+	})
+
+	return s
+}
+
+func TestHistoryAddConcurrent(t *testing.T) {
+	s := connectTest(t)
+	h := s.History(storage.Fixed(storage.DefaultMarathon))
+
+	const n = 20
+	versions := make(chan int, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v, err := h.Add(context.Background(), models.ScheduleVersion{})
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			versions <- v
+		}()
+	}
+	wg.Wait()
+	close(versions)
+
+	seen := make(map[int]bool)
+	for v := range versions {
+		if seen[v] {
+			t.Errorf("version %v was allocated twice", v)
+		}
+		seen[v] = true
+	}
+
+	list, err := h.List(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != n {
+		t.Errorf("%v versions stored, want %v", len(list), n)
+	}
+}
+
+func TestHistoryAddContinuesExistingVersions(t *testing.T) {
+	s := connectTest(t)
+	h := s.History(storage.Fixed(storage.DefaultMarathon))
+
+	// a version written before the counter existed
+	_, err := s.collection(storage.Fixed(storage.DefaultMarathon), "scheduleHistory")().InsertOne(context.Background(), models.ScheduleVersion{Version: 7})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v, err := h.Add(context.Background(), models.ScheduleVersion{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v != 8 {
+		t.Errorf("got version %v, want 8", v)
+	}
+}
@@ -0,0 +1,101 @@
+package mongostore
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/onestay/MarathonTools-API/api/models"
+	"github.com/onestay/MarathonTools-API/api/storage"
+)
+
+type marathonRepository struct {
+	col     *mongo.Collection
+	timeout time.Duration
+}
+
+func (r *marathonRepository) All(ctx context.Context) ([]models.Marathon, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	cur, err := r.col.Find(ctx, bson.M{}, options.Find().SetSort(bson.M{"created": 1}))
+	if err != nil {
+		return nil, err
+	}
+
+	marathons := []models.Marathon{}
+	err = cur.All(ctx, &marathons)
+	if err != nil {
+		return nil, err
+	}
+
+	return marathons, nil
+}
+
+func (r *marathonRepository) Get(ctx context.Context, id string) (models.Marathon, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	m := models.Marathon{}
+	err := r.col.FindOne(ctx, bson.M{"_id": id}).Decode(&m)
+	if err == mongo.ErrNoDocuments {
+		return m, storage.ErrNotFound
+	}
+
+	return m, err
+}
+
+func (r *marathonRepository) Insert(ctx context.Context, m models.Marathon) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	_, err := r.col.InsertOne(ctx, m)
+	return err
+}
+
+func (r *marathonRepository) Update(ctx context.Context, m models.Marathon) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	res, err := r.col.ReplaceOne(ctx, bson.M{"_id": m.ID}, m)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return storage.ErrNotFound
+	}
+
+	return nil
+}
+
+func (r *marathonRepository) Active(ctx context.Context) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	m := models.Marathon{}
+	err := r.col.FindOne(ctx, bson.M{"active": true}).Decode(&m)
+	if err == mongo.ErrNoDocuments {
+		return "", storage.ErrNotFound
+	}
+
+	return m.ID, err
+}
+
+func (r *marathonRepository) SetActive(ctx context.Context, id string) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	res, err := r.col.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{"active": true}})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return storage.ErrNotFound
+	}
+
+	_, err = r.col.UpdateMany(ctx, bson.M{"_id": bson.M{"$ne": id}}, bson.M{"$set": bson.M{"active": false}})
+	return err
+}
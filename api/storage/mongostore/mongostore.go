@@ -0,0 +1,96 @@
+// Package mongostore implements the storage interfaces with the official MongoDB driver.
+package mongostore
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/onestay/MarathonTools-API/api/storage"
+)
+
+// DefaultTimeout is the time every single database operation is allowed to take
+const DefaultTimeout = 5 * time.Second
+
+// Store holds the connection to the MongoDB server
+type Store struct {
+	client   *mongo.Client
+	database string
+	timeout  time.Duration
+}
+
+// Connect connects to the MongoDB server at uri and uses the given database. uri can also just be a host like it was
+// used with mgo
+func Connect(ctx context.Context, uri, database string, timeout time.Duration) (*Store, error) {
+	if !strings.HasPrefix(uri, "mongodb://") && !strings.HasPrefix(uri, "mongodb+srv://") {
+		uri = "mongodb://" + uri
+	}
+
+	cctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	client, err := mongo.Connect(cctx, options.Client().ApplyURI(uri))
+	if err != nil {
+		return nil, err
+	}
+
+	err = client.Ping(cctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Store{
+		client:   client,
+		database: database,
+		timeout:  timeout,
+	}, nil
+}
+
+// Close disconnects from the server
+func (s *Store) Close(ctx context.Context) error {
+	return s.client.Disconnect(ctx)
+}
+
+// db returns the database of the marathon with the given id. Every marathon but the default one gets its own database
+func (s *Store) db(marathon string) *mongo.Database {
+	if marathon == storage.DefaultMarathon {
+		return s.client.Database(s.database)
+	}
+
+	return s.client.Database(s.database + "_" + marathon)
+}
+
+// collection returns a function which returns the collection with the given name in the database of the scoped marathon
+func (s *Store) collection(scope storage.Scope, name string) func() *mongo.Collection {
+	return func() *mongo.Collection {
+		return s.db(scope()).Collection(name)
+	}
+}
+
+// Runs returns the repository for runs of the scoped marathon
+func (s *Store) Runs(scope storage.Scope) storage.RunRepository {
+	return &runRepository{s.collection(scope, "runs"), s.timeout}
+}
+
+// History returns the repository for schedule versions of the scoped marathon
+func (s *Store) History(scope storage.Scope) storage.HistoryRepository {
+	return &historyRepository{s.collection(scope, "scheduleHistory"), s.collection(scope, "counters"), s.timeout}
+}
+
+// Results returns the repository for run results of the scoped marathon
+func (s *Store) Results(scope storage.Scope) storage.ResultRepository {
+	return &resultRepository{s.collection(scope, "results"), s.timeout}
+}
+
+// Marathons returns the repository for marathons. They are stored in the database of the default marathon
+func (s *Store) Marathons() storage.MarathonRepository {
+	return &marathonRepository{s.db(storage.DefaultMarathon).Collection("marathons"), s.timeout}
+}
+
+// Runners returns the repository for the runner directory. It's stored in the database of the default marathon
+func (s *Store) Runners() storage.RunnerRepository {
+	return &runnerRepository{s.db(storage.DefaultMarathon).Collection("runners"), s.timeout}
+}
@@ -0,0 +1,58 @@
+package mongostore
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/onestay/MarathonTools-API/api/models"
+	"github.com/onestay/MarathonTools-API/api/storage"
+)
+
+type resultRepository struct {
+	col     func() *mongo.Collection
+	timeout time.Duration
+}
+
+func (r *resultRepository) Save(ctx context.Context, res models.RunResult) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	_, err := r.col().ReplaceOne(ctx, bson.M{"_id": res.RunID}, res, options.Replace().SetUpsert(true))
+	return err
+}
+
+func (r *resultRepository) Get(ctx context.Context, runID primitive.ObjectID) (models.RunResult, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	res := models.RunResult{}
+	err := r.col().FindOne(ctx, bson.M{"_id": runID}).Decode(&res)
+	if err == mongo.ErrNoDocuments {
+		return res, storage.ErrNotFound
+	}
+
+	return res, err
+}
+
+func (r *resultRepository) All(ctx context.Context) ([]models.RunResult, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	cur, err := r.col().Find(ctx, bson.M{}, options.Find().SetSort(bson.M{"finished": 1}))
+	if err != nil {
+		return nil, err
+	}
+
+	results := []models.RunResult{}
+	err = cur.All(ctx, &results)
+	if err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
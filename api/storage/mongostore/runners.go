@@ -0,0 +1,88 @@
+package mongostore
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/onestay/MarathonTools-API/api/models"
+	"github.com/onestay/MarathonTools-API/api/storage"
+)
+
+type runnerRepository struct {
+	col     *mongo.Collection
+	timeout time.Duration
+}
+
+func (r *runnerRepository) All(ctx context.Context) ([]models.Runner, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	cur, err := r.col.Find(ctx, bson.M{}, options.Find().SetSort(bson.M{"displayName": 1}))
+	if err != nil {
+		return nil, err
+	}
+
+	runners := []models.Runner{}
+	err = cur.All(ctx, &runners)
+	if err != nil {
+		return nil, err
+	}
+
+	return runners, nil
+}
+
+func (r *runnerRepository) Get(ctx context.Context, id primitive.ObjectID) (models.Runner, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	runner := models.Runner{}
+	err := r.col.FindOne(ctx, bson.M{"_id": id}).Decode(&runner)
+	if err == mongo.ErrNoDocuments {
+		return runner, storage.ErrNotFound
+	}
+
+	return runner, err
+}
+
+func (r *runnerRepository) Insert(ctx context.Context, runner models.Runner) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	_, err := r.col.InsertOne(ctx, runner)
+	return err
+}
+
+func (r *runnerRepository) Update(ctx context.Context, runner models.Runner) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	res, err := r.col.ReplaceOne(ctx, bson.M{"_id": runner.ID}, runner)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return storage.ErrNotFound
+	}
+
+	return nil
+}
+
+func (r *runnerRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	res, err := r.col.DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return storage.ErrNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,147 @@
+package mongostore
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/onestay/MarathonTools-API/api/models"
+	"github.com/onestay/MarathonTools-API/api/storage"
+)
+
+type runRepository struct {
+	col     func() *mongo.Collection
+	timeout time.Duration
+}
+
+func (r *runRepository) All(ctx context.Context) ([]models.Run, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	cur, err := r.col().Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+
+	runs := []models.Run{}
+	err = cur.All(ctx, &runs)
+	if err != nil {
+		return nil, err
+	}
+
+	return runs, nil
+}
+
+func (r *runRepository) Get(ctx context.Context, id primitive.ObjectID) (models.Run, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	run := models.Run{}
+	err := r.col().FindOne(ctx, bson.M{"_id": id}).Decode(&run)
+	if err == mongo.ErrNoDocuments {
+		return run, storage.ErrNotFound
+	}
+
+	return run, err
+}
+
+func (r *runRepository) Count(ctx context.Context) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	c, err := r.col().CountDocuments(ctx, bson.M{})
+	return int(c), err
+}
+
+func (r *runRepository) Insert(ctx context.Context, run models.Run) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	_, err := r.col().InsertOne(ctx, run)
+	return err
+}
+
+func (r *runRepository) Update(ctx context.Context, run models.Run) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	// runs saved before versions were introduced don't have a version field
+	var version interface{} = run.Version
+	if run.Version == 0 {
+		version = bson.M{"$in": bson.A{0, nil}}
+	}
+
+	run.Version++
+	res, err := r.col().ReplaceOne(ctx, bson.M{"_id": run.RunID, "version": version}, run)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount != 0 {
+		return nil
+	}
+
+	n, err := r.col().CountDocuments(ctx, bson.M{"_id": run.RunID})
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return storage.ErrNotFound
+	}
+
+	return storage.ErrConflict
+}
+
+func (r *runRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	res, err := r.col().DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return storage.ErrNotFound
+	}
+
+	return nil
+}
+
+func (r *runRepository) ReplaceAll(ctx context.Context, runs []models.Run) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	_, err := r.col().DeleteMany(ctx, bson.M{})
+	if err != nil {
+		return err
+	}
+
+	if len(runs) == 0 {
+		return nil
+	}
+
+	docs := make([]interface{}, len(runs))
+	for i := range runs {
+		docs[i] = runs[i]
+	}
+
+	_, err = r.col().InsertMany(ctx, docs)
+	return err
+}
+
+func (r *runRepository) SetSetupResult(ctx context.Context, id primitive.ObjectID, res models.SetupResult) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	u, err := r.col().UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{"setupResult": res}, "$inc": bson.M{"version": 1}})
+	if err != nil {
+		return err
+	}
+	if u.MatchedCount == 0 {
+		return storage.ErrNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,236 @@
+// Package redisstore implements the settings, checklist and social repositories with redis.
+// The keys and formats are the same ones the API used before the storage interfaces existed. Keys of marathons other
+// than the default one are prefixed with the marathon id.
+package redisstore
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+
+	"github.com/go-redis/redis"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/onestay/MarathonTools-API/api/models"
+	"github.com/onestay/MarathonTools-API/api/storage"
+)
+
+// Store holds the redis client
+type Store struct {
+	client *redis.Client
+}
+
+// New returns a new store using the redis server at addr
+func New(addr string) *Store {
+	client := redis.NewClient(&redis.Options{
+		Addr:     addr,
+		Password: "",
+		DB:       0,
+	})
+
+	return &Store{client}
+}
+
+// Close closes the redis client
+func (s *Store) Close() error {
+	return s.client.Close()
+}
+
+// Settings returns the settings repository of the scoped marathon
+func (s *Store) Settings(scope storage.Scope) storage.SettingsRepository {
+	return settingsRepository{s, scope}
+}
+
+// Checklist returns the checklist repository of the scoped marathon
+func (s *Store) Checklist(scope storage.Scope) storage.ChecklistRepository {
+	return checklistRepository{s, scope}
+}
+
+// Hosts returns the host rotation repository of the scoped marathon
+func (s *Store) Hosts(scope storage.Scope) storage.HostRepository {
+	return hostRepository{s, scope}
+}
+
+// Social returns the social repository of the scoped marathon
+func (s *Store) Social(scope storage.Scope) storage.SocialRepository {
+	return socialRepository{s, scope}
+}
+
+// key returns the key for the scoped marathon
+func key(scope storage.Scope, k string) string {
+	if id := scope(); id != storage.DefaultMarathon {
+		return "marathon:" + id + ":" + k
+	}
+
+	return k
+}
+
+func (s *Store) get(k string, v interface{}) error {
+	b, err := s.client.Get(k).Bytes()
+	if err == redis.Nil || (err == nil && len(b) == 0) {
+		return storage.ErrNotFound
+	} else if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(b, v)
+}
+
+func (s *Store) set(k string, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	return s.client.Set(k, b, 0).Err()
+}
+
+type settingsRepository struct {
+	s     *Store
+	scope storage.Scope
+}
+
+func (r settingsRepository) Get(_ context.Context) (models.Settings, error) {
+	var settings models.Settings
+	err := r.s.get(key(r.scope, "settings"), &settings)
+	return settings, err
+}
+
+func (r settingsRepository) Save(_ context.Context, settings models.Settings) error {
+	return r.s.set(key(r.scope, "settings"), settings)
+}
+
+type checklistRepository struct {
+	s     *Store
+	scope storage.Scope
+}
+
+func (r checklistRepository) Get(_ context.Context) ([]models.ChecklistItem, error) {
+	var items []models.ChecklistItem
+	err := r.s.get(key(r.scope, "checklist"), &items)
+	return items, err
+}
+
+func (r checklistRepository) Save(_ context.Context, items []models.ChecklistItem) error {
+	return r.s.set(key(r.scope, "checklist"), items)
+}
+
+func (r checklistRepository) AddLog(_ context.Context, entry models.ChecklistLogEntry) error {
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	return r.s.client.RPush(key(r.scope, "checklistLog:"+entry.RunID.Hex()), b).Err()
+}
+
+func (r checklistRepository) Log(_ context.Context, runID primitive.ObjectID) ([]models.ChecklistLogEntry, error) {
+	raw, err := r.s.client.LRange(key(r.scope, "checklistLog:"+runID.Hex()), 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]models.ChecklistLogEntry, len(raw))
+	for i, e := range raw {
+		if err := json.Unmarshal([]byte(e), &entries[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	return entries, nil
+}
+
+type hostRepository struct {
+	s     *Store
+	scope storage.Scope
+}
+
+func (r hostRepository) Get(_ context.Context) ([]models.HostSlot, error) {
+	var slots []models.HostSlot
+	err := r.s.get(key(r.scope, "hosts"), &slots)
+	return slots, err
+}
+
+func (r hostRepository) Save(_ context.Context, slots []models.HostSlot) error {
+	return r.s.set(key(r.scope, "hosts"), slots)
+}
+
+type socialRepository struct {
+	s     *Store
+	scope storage.Scope
+}
+
+func (r socialRepository) TwitchSettings(_ context.Context) (models.TwitchSettings, error) {
+	var ts models.TwitchSettings
+	err := r.s.get(key(r.scope, "twitchSettings"), &ts)
+	return ts, err
+}
+
+func (r socialRepository) SaveTwitchSettings(_ context.Context, ts models.TwitchSettings) error {
+	return r.s.set(key(r.scope, "twitchSettings"), ts)
+}
+
+func (r socialRepository) TwitchToken(_ context.Context) (models.TwitchToken, error) {
+	var t models.TwitchToken
+	err := r.s.get(key(r.scope, "twitchToken"), &t)
+	return t, err
+}
+
+func (r socialRepository) SaveTwitchToken(_ context.Context, t models.TwitchToken) error {
+	return r.s.set(key(r.scope, "twitchToken"), t)
+}
+
+func (r socialRepository) DeleteTwitchToken(_ context.Context) error {
+	return r.s.client.Del(key(r.scope, "twitchToken")).Err()
+}
+
+// the twitter settings are saved as a plain bool
+func (r socialRepository) TwitterSettings(_ context.Context) (models.TwitterSettings, error) {
+	res, err := r.s.client.Get(key(r.scope, "twitterSettings")).Bytes()
+	if err == redis.Nil {
+		return models.TwitterSettings{}, storage.ErrNotFound
+	} else if err != nil {
+		return models.TwitterSettings{}, err
+	}
+
+	b, _ := strconv.ParseBool(string(res))
+	return models.TwitterSettings{SendTweets: b}, nil
+}
+
+func (r socialRepository) SaveTwitterSettings(_ context.Context, ts models.TwitterSettings) error {
+	return r.s.client.Set(key(r.scope, "twitterSettings"), strconv.FormatBool(ts.SendTweets), 0).Err()
+}
+
+func (r socialRepository) TwitterTemplates(_ context.Context) ([]models.TwitterTemplate, error) {
+	var t []models.TwitterTemplate
+	err := r.s.get(key(r.scope, "twitterTemplates"), &t)
+	return t, err
+}
+
+func (r socialRepository) SaveTwitterTemplates(_ context.Context, t []models.TwitterTemplate) error {
+	return r.s.set(key(r.scope, "twitterTemplates"), t)
+}
+
+func (r socialRepository) AutomationRules(_ context.Context) ([]models.AutomationRule, error) {
+	var rules []models.AutomationRule
+	err := r.s.get(key(r.scope, "automationRules"), &rules)
+	return rules, err
+}
+
+func (r socialRepository) SaveAutomationRules(_ context.Context, rules []models.AutomationRule) error {
+	return r.s.set(key(r.scope, "automationRules"), rules)
+}
+
+func (r socialRepository) VODMarkers(_ context.Context) ([]models.VODMarker, error) {
+	var markers []models.VODMarker
+	err := r.s.get(key(r.scope, "vodMarkers"), &markers)
+	return markers, err
+}
+
+func (r socialRepository) SaveVODMarkers(_ context.Context, markers []models.VODMarker) error {
+	return r.s.set(key(r.scope, "vodMarkers"), markers)
+}
+
+func (r socialRepository) DeleteVODMarkers(_ context.Context) error {
+	return r.s.client.Del(key(r.scope, "vodMarkers")).Err()
+}
@@ -0,0 +1,212 @@
+// Package storage defines the interfaces through which all persistent data is read and written.
+package storage
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/onestay/MarathonTools-API/api/models"
+)
+
+// ErrNotFound is returned if the requested document doesn't exist
+var ErrNotFound = errors.New("not found")
+
+// ErrConflict is returned if a document was changed since it was read
+var ErrConflict = errors.New("conflict")
+
+// DefaultMarathon is the id of the marathon which existed before multiple marathons were supported.
+// Its data is stored where it always was so existing deployments keep their data
+const DefaultMarathon = "default"
+
+var marathonIDRe = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,31}$`)
+
+// ValidMarathonID reports whether id can be used as a marathon id. Ids are used in database names and keys
+// so they are limited to lowercase letters, digits and dashes
+func ValidMarathonID(id string) bool {
+	return marathonIDRe.MatchString(id)
+}
+
+// Scope returns the id of the marathon a repository operates on. It's called on every access so repositories follow a
+// switch of the active marathon
+type Scope func() string
+
+// Fixed returns a scope which always returns id
+func Fixed(id string) Scope {
+	return func() string {
+		return id
+	}
+}
+
+// Active holds the id of the active marathon. It's safe for concurrent use
+type Active struct {
+	mu sync.RWMutex
+	id string
+}
+
+// NewActive returns a new Active set to id
+func NewActive(id string) *Active {
+	return &Active{id: id}
+}
+
+// ID returns the id of the active marathon. It can be used as Scope
+func (a *Active) ID() string {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.id
+}
+
+// Set sets the id of the active marathon
+func (a *Active) Set(id string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.id = id
+}
+
+// RunRepository stores the runs of the schedule. The order in which runs are returned is the order of the schedule
+type RunRepository interface {
+	// All returns all runs in schedule order
+	All(ctx context.Context) ([]models.Run, error)
+	// Get returns the run with the given id or ErrNotFound
+	Get(ctx context.Context, id primitive.ObjectID) (models.Run, error)
+	// Count returns the number of runs
+	Count(ctx context.Context) (int, error)
+	// Insert adds a run at the end of the schedule
+	Insert(ctx context.Context, run models.Run) error
+	// Update replaces the run with the same id and increments its version. It returns ErrConflict if the stored version
+	// isn't run.Version or ErrNotFound
+	Update(ctx context.Context, run models.Run) error
+	// Delete removes the run with the given id or returns ErrNotFound
+	Delete(ctx context.Context, id primitive.ObjectID) error
+	// ReplaceAll replaces the whole schedule with the given runs
+	ReplaceAll(ctx context.Context, runs []models.Run) error
+	// SetSetupResult stores the setup result on the run with the given id
+	SetSetupResult(ctx context.Context, id primitive.ObjectID, res models.SetupResult) error
+}
+
+// HistoryRepository stores the versions of the schedule
+type HistoryRepository interface {
+	// Add stores the version and returns its number. Version numbers are assigned by the repository
+	Add(ctx context.Context, v models.ScheduleVersion) (int, error)
+	// List returns all versions without their runs, newest first
+	List(ctx context.Context) ([]models.ScheduleVersion, error)
+	// Get returns the version with the given number or ErrNotFound
+	Get(ctx context.Context, version int) (models.ScheduleVersion, error)
+}
+
+// ResultRepository stores the results of finished runs
+type ResultRepository interface {
+	// Save stores the result and replaces an earlier result of the same run
+	Save(ctx context.Context, res models.RunResult) error
+	// Get returns the result of the run with the given id or ErrNotFound
+	Get(ctx context.Context, runID primitive.ObjectID) (models.RunResult, error)
+	// All returns all results
+	All(ctx context.Context) ([]models.RunResult, error)
+}
+
+// SettingsRepository stores the general settings
+type SettingsRepository interface {
+	// Get returns the saved settings or ErrNotFound
+	Get(ctx context.Context) (models.Settings, error)
+	// Save replaces the saved settings
+	Save(ctx context.Context, s models.Settings) error
+}
+
+// ChecklistRepository stores the checklist
+type ChecklistRepository interface {
+	// Get returns the saved checklist items or ErrNotFound
+	Get(ctx context.Context) ([]models.ChecklistItem, error)
+	// Save replaces the saved checklist items
+	Save(ctx context.Context, items []models.ChecklistItem) error
+	// AddLog appends an entry to the checklist log of its run
+	AddLog(ctx context.Context, entry models.ChecklistLogEntry) error
+	// Log returns the checklist log of a run oldest first
+	Log(ctx context.Context, runID primitive.ObjectID) ([]models.ChecklistLogEntry, error)
+}
+
+// HostRepository stores the host rotation
+type HostRepository interface {
+	// Get returns the saved host slots or ErrNotFound
+	Get(ctx context.Context) ([]models.HostSlot, error)
+	// Save replaces the saved host slots
+	Save(ctx context.Context, slots []models.HostSlot) error
+}
+
+// SocialRepository stores the twitch and twitter settings, the twitch token, the twitter templates, the automation rules
+// and the vod markers
+type SocialRepository interface {
+	// TwitchSettings returns the twitch settings or ErrNotFound
+	TwitchSettings(ctx context.Context) (models.TwitchSettings, error)
+	SaveTwitchSettings(ctx context.Context, s models.TwitchSettings) error
+	// TwitchToken returns the twitch oauth token or ErrNotFound
+	TwitchToken(ctx context.Context) (models.TwitchToken, error)
+	SaveTwitchToken(ctx context.Context, t models.TwitchToken) error
+	// DeleteTwitchToken removes the twitch oauth token. Deleting a missing token isn't an error
+	DeleteTwitchToken(ctx context.Context) error
+	// TwitterSettings returns the twitter settings or ErrNotFound
+	TwitterSettings(ctx context.Context) (models.TwitterSettings, error)
+	SaveTwitterSettings(ctx context.Context, s models.TwitterSettings) error
+	// TwitterTemplates returns all twitter templates or ErrNotFound if none have been saved yet
+	TwitterTemplates(ctx context.Context) ([]models.TwitterTemplate, error)
+	SaveTwitterTemplates(ctx context.Context, t []models.TwitterTemplate) error
+	// AutomationRules returns the automation rules or ErrNotFound if none have been saved yet
+	AutomationRules(ctx context.Context) ([]models.AutomationRule, error)
+	SaveAutomationRules(ctx context.Context, rules []models.AutomationRule) error
+	// VODMarkers returns the vod markers in the order they were recorded or ErrNotFound if none have been saved yet
+	VODMarkers(ctx context.Context) ([]models.VODMarker, error)
+	SaveVODMarkers(ctx context.Context, markers []models.VODMarker) error
+	// DeleteVODMarkers removes all vod markers. Deleting missing markers isn't an error
+	DeleteVODMarkers(ctx context.Context) error
+}
+
+// RunnerRepository stores the runner directory. It isn't scoped to a marathon
+type RunnerRepository interface {
+	// All returns all runners sorted by display name
+	All(ctx context.Context) ([]models.Runner, error)
+	// Get returns the runner with the given id or ErrNotFound
+	Get(ctx context.Context, id primitive.ObjectID) (models.Runner, error)
+	// Insert adds a runner
+	Insert(ctx context.Context, r models.Runner) error
+	// Update replaces the runner with the same id or returns ErrNotFound
+	Update(ctx context.Context, r models.Runner) error
+	// Delete removes the runner with the given id or returns ErrNotFound
+	Delete(ctx context.Context, id primitive.ObjectID) error
+}
+
+// MarathonRepository stores the marathons and which one is active. It isn't scoped to a marathon
+type MarathonRepository interface {
+	// All returns all marathons
+	All(ctx context.Context) ([]models.Marathon, error)
+	// Get returns the marathon with the given id or ErrNotFound
+	Get(ctx context.Context, id string) (models.Marathon, error)
+	// Insert adds a marathon
+	Insert(ctx context.Context, m models.Marathon) error
+	// Update replaces the marathon with the same id or returns ErrNotFound
+	Update(ctx context.Context, m models.Marathon) error
+	// Active returns the id of the active marathon or ErrNotFound if none has been set yet
+	Active(ctx context.Context) (string, error)
+	// SetActive marks the marathon with the given id as active
+	SetActive(ctx context.Context, id string) error
+}
+
+// Backend bundles the repositories of a storage backend. All repositories but Marathons and Runners operate on the
+// marathon held by Active
+type Backend struct {
+	Runs      RunRepository
+	History   HistoryRepository
+	Results   ResultRepository
+	Settings  SettingsRepository
+	Checklist ChecklistRepository
+	Hosts     HostRepository
+	Social    SocialRepository
+	Marathons MarathonRepository
+	Runners   RunnerRepository
+	Active    *Active
+	// Event returns the repositories of the marathon with the given id. They stay bound to it when the active marathon changes
+	Event func(id string) Backend
+	// Close releases everything held by the backend
+	Close func() error
+}
@@ -1,44 +1,45 @@
 package main
 
 import (
+	"context"
 	"log"
 	"net/http"
 	"os"
-	"strconv"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
 
+	"github.com/onestay/MarathonTools-API/api/routes/countdown"
 	"github.com/onestay/MarathonTools-API/api/routes/donations"
+	"github.com/onestay/MarathonTools-API/api/routes/marathons"
+	"github.com/onestay/MarathonTools-API/api/routes/runners"
+	"github.com/onestay/MarathonTools-API/api/routes/schedule"
 
 	"github.com/onestay/MarathonTools-API/api/donationProviders"
 	"github.com/onestay/MarathonTools-API/api/routes/timer"
 
-	"github.com/go-redis/redis"
-
 	"github.com/joho/godotenv"
 	"github.com/onestay/MarathonTools-API/api/routes/social"
 
 	"github.com/julienschmidt/httprouter"
 	"github.com/onestay/MarathonTools-API/api/common"
+	"github.com/onestay/MarathonTools-API/api/config"
+	"github.com/onestay/MarathonTools-API/api/models"
 	"github.com/onestay/MarathonTools-API/api/routes/runs"
+	"github.com/onestay/MarathonTools-API/api/storage"
+	"github.com/onestay/MarathonTools-API/api/storage/boltstore"
+	"github.com/onestay/MarathonTools-API/api/storage/mongostore"
+	"github.com/onestay/MarathonTools-API/api/storage/redisstore"
 	"github.com/onestay/MarathonTools-API/ws"
-	"gopkg.in/mgo.v2"
 )
 
 var (
-	mgs                                          *mgo.Session
-	redisClient                                  *redis.Client
-	port                                         string
-	twitchClientID                               string
-	twitchClientSecret                           string
-	twitchCallback                               string
-	twitterKey                                   string
-	twitterSecret                                string
-	twitterCallback                              string
-	refreshInterval                              int
-	marathonSlug                                 string
-	gdqURL, gdqEventID, gdqUsername, gdqPassword string
-	mgoURL, redisURL                             string
-	socialAuthURL, socialAuthKey                 string
-	featuredChannelsKey                          string
+	backend storage.Backend
+	// configMu guards conf which is replaced on SIGHUP
+	configMu   sync.RWMutex
+	conf       config.Config
+	configPath string
 )
 
 type Server struct {
@@ -50,11 +51,16 @@ func init() {
 	if err != nil {
 		log.Println("Error loading .env file.")
 	}
-	parseEnvVars()
-	log.Printf("Connecting to mgo server at %v", mgoURL)
-	mgs = getMongoSession()
-	log.Printf("Connecting to redis server at %v", redisURL)
-	redisClient = getRedisClient()
+	configPath = os.Getenv("CONFIG_FILE")
+	if len(configPath) == 0 {
+		configPath = config.DefaultPath
+	}
+	conf, err = config.Load(configPath)
+	if err != nil {
+		log.Fatalf("Couldn't load config: %v", err)
+	}
+	common.SetLogLevel(conf.Log.Level)
+	backend = getStorageBackend()
 }
 
 func main() {
@@ -65,38 +71,32 @@ func startHTTPServer() {
 	r := httprouter.New()
 	hub := ws.NewHub()
 	log.Println("Initializing base controller...")
-	baseController := common.NewController(hub, mgs, 0, redisClient)
+	baseController := common.NewController(hub, backend, 0)
 	log.Println("Initializing social controller...")
-	social.NewSocialController(twitchClientID, twitchClientSecret, twitchCallback, twitterKey, twitterSecret, twitterCallback, socialAuthURL, socialAuthKey, featuredChannelsKey, baseController, r)
+	sc := conf.Social
+	socialController := social.NewSocialController(sc.TwitchClientID, sc.TwitchClientSecret, sc.TwitchCallback, sc.TwitterKey, sc.TwitterSecret, sc.TwitterCallback, sc.AuthURL, sc.AuthKey, sc.FeaturedChannelsKey, sc.Twitch(), baseController, r)
 	log.Println("Initializing time controller...")
-	timer.NewTimeController(baseController, refreshInterval, r)
+	timeController := timer.NewTimeController(baseController, conf.Timer.RefreshInterval, r)
 	log.Println("Initializing run controller")
-	runs.NewRunController(baseController, r)
-
-	var donProv donations.DonationProvider
-	donationsEnabled := true
-	var err error
-
-	if os.Getenv("DONATION_PROVIDER") == "gdq" {
-		log.Println("Creating new GDQ donation provider")
-		donProv, err = donationProviders.NewGDQDonationProvider(gdqURL, gdqEventID, gdqUsername, gdqPassword)
-		if err != nil {
-			log.Printf("Error during gdq donation provider creation: %v", err)
-			donationsEnabled = false
-		}
-	} else if os.Getenv("DONATION_PROVIDER") == "srcom" {
-		log.Println("Creating new speedrun.com donation provider")
-		donProv, err = donationProviders.NewSRComDonationProvider(marathonSlug)
-		if err != nil {
-			log.Printf("Error during donation provider creation: %v", err)
-			donationsEnabled = false
-		}
-	} else {
-		log.Print("No donation provider specified")
-		donationsEnabled = false
-	}
+	runController := runs.NewRunController(baseController, r)
+	log.Println("Initializing countdown controller...")
+	countdown.NewCountdownController(baseController, timeController.Start, runController.SwitchTo, r)
+	log.Println("Initializing marathon controller...")
+	marathons.NewMarathonController(baseController, r)
+	log.Println("Initializing runner controller...")
+	runners.NewRunnerController(baseController, r)
+	log.Println("Initializing schedule controller...")
+	schedule.NewScheduleController(baseController, r)
 
+	marathon, _ := baseController.Marathons.Active(context.Background())
+	donProv, donationsEnabled := newDonationProvider(marathon.Donations)
 	donationController := donations.NewDonationController(baseController, donProv, donationsEnabled)
+	baseController.Marathons.OnSwitch(func(m models.Marathon) {
+		donationController.SetProvider(newDonationProvider(m.Donations))
+	})
+	go reloadOnSignal(baseController, donationController, socialController, timeController)
+	log.Println("Initializing chat bot...")
+	social.NewChatBot(socialController, donationController.Total, r)
 
 	log.Println("Starting websocket hub...")
 	go hub.Run()
@@ -118,38 +118,190 @@ func startHTTPServer() {
 	r.PUT("/checklist/toggle", baseController.CL.ToggleItem)
 	r.GET("/checklist/done", baseController.CL.CheckDoneHTTP)
 	r.GET("/checklist", baseController.CL.GetChecklist)
+	r.GET("/checklist/template", baseController.CL.GetTemplate)
+	r.PUT("/checklist/template", baseController.CL.SetTemplate)
+	r.POST("/checklist/override", baseController.CL.Override)
+	r.GET("/checklist/log", baseController.CL.GetLog)
+	r.POST("/checklist/items", baseController.CL.AddItem)
+	r.PATCH("/checklist/items/:key", baseController.CL.UpdateItem)
+	r.DELETE("/checklist/items/:key", baseController.CL.DeleteItem)
+	r.POST("/checklist/items/:key/toggle", baseController.CL.ToggleItem)
+	r.PUT("/checklist/order", baseController.CL.ReorderItems)
+	r.GET("/checklist/export", baseController.CL.ExportTemplate)
+	r.POST("/checklist/import", baseController.CL.SetTemplate)
+
+	// host rotation
+	r.GET("/hosts", baseController.Hosts.GetHosts)
+	r.PUT("/hosts", baseController.Hosts.SetHosts)
+	r.POST("/hosts", baseController.Hosts.AddHost)
+	r.GET("/hosts/current", baseController.Hosts.GetCurrentHost)
+	r.DELETE("/hosts/:id", baseController.Hosts.DeleteHost)
+
+	// setup tracking
+	r.GET("/setup", baseController.Setup.GetSetup)
 
 	// settings stuff
 	r.POST("/settings", baseController.Settings.SetSettings)
 	r.GET("/settings", baseController.Settings.GetSettings)
+	r.PATCH("/settings", baseController.Settings.PatchSettings)
+	r.GET("/settings/schema", baseController.Settings.GetSchema)
+
+	// automation rules
+	r.GET("/automation/rules", baseController.Automation.GetRules)
+	r.PUT("/automation/rules", baseController.Automation.SetRules)
+	r.GET("/automation/actions", baseController.Automation.GetActions)
 
-	log.Println("server running on " + port)
-	log.Fatal(http.ListenAndServe(port, &Server{r}))
+	log.Println("server running on " + conf.Server.Port)
+	err := http.ListenAndServe(conf.Server.Port, &Server{r})
+	// the std logger is silenced at the error log level
+	common.Errorf("Server stopped: %v", err)
+	os.Exit(1)
 }
 
-func getMongoSession() *mgo.Session {
-	s, err := mgo.Dial(mgoURL)
-	if err != nil {
-		panic("Couldn't establish mgo session " + err.Error())
+// newDonationProvider creates the donation provider configured for a marathon. Marathons without their own config use
+// the provider of the config file
+func newDonationProvider(cfg models.DonationConfig) (donations.DonationProvider, bool) {
+	if len(cfg.Provider) == 0 {
+		configMu.RLock()
+		cfg = conf.Donations.Model()
+		configMu.RUnlock()
 	}
 
-	return s
+	switch cfg.Provider {
+	case "gdq":
+		log.Println("Creating new GDQ donation provider")
+		donProv, err := donationProviders.NewGDQDonationProvider(cfg.GDQURL, cfg.GDQEventID, cfg.GDQUsername, cfg.GDQPassword)
+		if err != nil {
+			log.Printf("Error during gdq donation provider creation: %v", err)
+			return nil, false
+		}
+		return donProv, true
+	case "srcom":
+		log.Println("Creating new speedrun.com donation provider")
+		donProv, err := donationProviders.NewSRComDonationProvider(cfg.MarathonSlug)
+		if err != nil {
+			log.Printf("Error during donation provider creation: %v", err)
+			return nil, false
+		}
+		return donProv, true
+	default:
+		log.Print("No donation provider specified")
+		return nil, false
+	}
 }
 
-func getRedisClient() *redis.Client {
-	client := redis.NewClient(&redis.Options{
-		Addr:     redisURL + ":6379",
-		Password: "",
-		DB:       0,
-	})
+// reloadOnSignal reloads the config file on SIGHUP. Everything except the server and storage sections is applied
+// right away
+func reloadOnSignal(b *common.Controller, dc *donations.DonationController, socialController social.Controller, tc *timer.Controller) {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGHUP)
+	for range sig {
+		log.Printf("Reloading config from %v", configPath)
+		c, err := config.Load(configPath)
+		if err != nil {
+			common.Errorf("Couldn't reload config, keeping the old one: %v", err)
+			continue
+		}
+
+		configMu.Lock()
+		old := conf
+		conf = c
+		configMu.Unlock()
 
-	return client
+		if sections := old.RestartRequired(c); len(sections) != 0 {
+			log.Printf("Changes to %v need a restart to be applied", strings.Join(sections, ", "))
+		}
+		if old.Log != c.Log {
+			common.SetLogLevel(c.Log.Level)
+			log.Printf("Log level is now %v", c.Log.Level)
+		}
+		if old.Timer != c.Timer {
+			tc.SetRefreshInterval(c.Timer.RefreshInterval)
+			log.Printf("Timer refresh interval is now %vms", c.Timer.RefreshInterval)
+		}
+		if old.Social != c.Social {
+			sc := c.Social
+			socialController.Reload(sc.TwitchClientID, sc.TwitchClientSecret, sc.TwitchCallback, sc.TwitterKey, sc.TwitterSecret, sc.TwitterCallback, sc.AuthURL, sc.AuthKey, sc.FeaturedChannelsKey, sc.Twitch())
+			log.Printf("Applied the social config, twitch backend is %v", sc.Twitch())
+		}
+		if old.Donations == c.Donations {
+			continue
+		}
+
+		marathon, err := b.Marathons.Active(context.Background())
+		if err != nil {
+			b.LogError("while getting the active marathon", err, false)
+			continue
+		}
+		if len(marathon.Donations.Provider) != 0 {
+			log.Printf("Marathon %v has its own donation provider, the default one isn't used", marathon.ID)
+			continue
+		}
+		dc.SetProvider(newDonationProvider(marathon.Donations))
+	}
+}
+
+// getStorageBackend returns the backend selected by storage.backend.
+// "embedded" keeps everything in a single data file, "mongo" (the default) uses mongo for runs and results and redis for everything else
+func getStorageBackend() storage.Backend {
+	active := storage.NewActive(storage.DefaultMarathon)
+
+	sc := conf.Storage
+	switch sc.Backend {
+	case "embedded":
+		log.Printf("Opening embedded database at %v", sc.DataFile)
+		s, err := boltstore.Open(sc.DataFile)
+		if err != nil {
+			log.Fatalf("Couldn't open embedded database: %v", err)
+		}
+
+		return s.Backend(active)
+	case "mongo":
+		log.Printf("Connecting to mongo server at %v", sc.MongoServer)
+		m, err := mongostore.Connect(context.Background(), sc.MongoServer, "marathon", mongostore.DefaultTimeout)
+		if err != nil {
+			log.Fatalf("Couldn't connect to mongo server: %v", err)
+		}
+		log.Printf("Connecting to redis server at %v", sc.RedisServer)
+		r := redisstore.New(sc.RedisServer + ":6379")
+
+		scoped := func(scope storage.Scope) storage.Backend {
+			return storage.Backend{
+				Runs:      m.Runs(scope),
+				History:   m.History(scope),
+				Results:   m.Results(scope),
+				Settings:  r.Settings(scope),
+				Checklist: r.Checklist(scope),
+				Hosts:     r.Hosts(scope),
+				Social:    r.Social(scope),
+			}
+		}
+
+		b := scoped(active.ID)
+		b.Marathons = m.Marathons()
+		b.Runners = m.Runners()
+		b.Active = active
+		b.Event = func(id string) storage.Backend {
+			return scoped(storage.Fixed(id))
+		}
+		b.Close = func() error {
+			r.Close()
+			return m.Close(context.Background())
+		}
+
+		return b
+	default:
+		log.Fatalf("Unknown storage backend %v", sc.Backend)
+	}
+
+	return storage.Backend{}
 }
 
 func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, DELETE, PUT, PATCH, OPTIONS, HEAD")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, X-Operator, If-Match")
+	w.Header().Set("Access-Control-Expose-Headers", "ETag")
 	if r.Method == "OPTIONS" {
 		// TODO: proper OPTIONS handling
 		w.WriteHeader(200)
@@ -157,44 +309,3 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		s.r.ServeHTTP(w, r)
 	}
 }
-
-func parseEnvVars() {
-	mgoURL = os.Getenv("MONGO_SERVER")
-	redisURL = os.Getenv("REDIS_SERVER")
-	twitchClientID = os.Getenv("TWITCH_CLIENT_ID")
-	twitchClientSecret = os.Getenv("TWITCH_CLIENT_SECRET")
-	twitchCallback = os.Getenv("TWITCH_CALLBACK")
-	twitterKey = os.Getenv("TWITTER_KEY")
-	twitterSecret = os.Getenv("TWITTER_SECRET")
-	twitterCallback = os.Getenv("TWITTER_CALLBACK")
-	socialAuthURL = os.Getenv("SOCIAL_AUTH_URL")
-	socialAuthKey = os.Getenv("SOCIAL_AUTH_KEY")
-	i, err := strconv.Atoi(os.Getenv("REFRESH_INTERVAL"))
-	if err != nil && len(os.Getenv("REFRESH_INTERVAL")) != 0 {
-		log.Println("Error parsing REFRESH_INTERVAL defaulting to 100ms")
-		i = 100
-	} else if err != nil {
-		i = 100
-	}
-	refreshInterval = i
-	port = os.Getenv("HTTP_PORT")
-	if len(port) == 0 {
-		port = ":3000"
-	}
-
-	if os.Getenv("DONATION_PROVIDER") == "gdq" {
-		gdqURL = os.Getenv("GDQ_TRACKER_URL")
-		gdqEventID = os.Getenv("GDQ_TRACKER_EVENT_ID")
-		gdqUsername = os.Getenv("GDQ_TRACKER_USERNAME")
-		gdqPassword = os.Getenv("GDQ_TRACKER_PASSWORD")
-	} else if os.Getenv("DONATION_PRODIVER") == "srcom" {
-		marathonSlug = os.Getenv("MARATHON_SLUG")
-	} else if len(os.Getenv("DONATION_PROVIDER")) == 0 {
-		log.Println("No donations provider specified. Donations disabled.")
-	} else {
-		log.Printf("Unknown donation provider %v. Donations disabled.", os.Getenv("DONATION_PROVIDER"))
-	}
-
-	featuredChannelsKey = os.Getenv("FEATURED_CHANNELS_KEY")
-
-}